@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A Role is the level of access a user has to a path. Each role allows everything
+// the roles before it allow.
+type Role int
+
+const (
+	RoleNone   Role = iota // no access at all
+	RoleReader             // may read databases, documents, and collections
+	RoleWriter             // may also create, change, and delete documents and collections
+	RoleAdmin              // may also create and delete databases and manage schemas and indexes
+)
+
+// Any user matches a grant whose user is this wildcard.
+const AnyUser = "*"
+
+// roleNames maps the names used in policy files to roles.
+var roleNames = map[string]Role{
+	"none":   RoleNone,
+	"reader": RoleReader,
+	"writer": RoleWriter,
+	"admin":  RoleAdmin,
+}
+
+// String returns the name of the role as used in policy files.
+func (role Role) String() string {
+	for name, r := range roleNames {
+		if r == role {
+			return name
+		}
+	}
+	return fmt.Sprintf("Role(%d)", int(role))
+}
+
+// A Grant gives a user a role on a path and everything below it. The path is a
+// database, document, or collection path like "/db/doc/col", and "/" is every
+// database. The user may be AnyUser to grant the role to every user.
+type Grant struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	Role string `json:"role"`
+}
+
+// A Policy holds the grants loaded from a policy file. The role a user has on a path
+// comes from the grant on the closest path above it, so grants are inherited down the
+// database, document, and collection hierarchy until a more specific grant overrides
+// them. On the same path, a grant to the user overrides a grant to AnyUser. Users
+// without any grant above a path have no access to it.
+type Policy struct {
+	grants []policyGrant
+}
+
+// A policyGrant is a Grant with its path split into names and its role parsed.
+type policyGrant struct {
+	user     string
+	pathList []string
+	role     Role
+}
+
+// LoadPolicy reads a policy file. The file holds a JSON object with a "grants" array
+// of objects with "user", "path", and "role" fields, where the role is one of none,
+// reader, writer, or admin.
+func LoadPolicy(filePath string) (*Policy, error) {
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var policyFile struct {
+		Grants []Grant `json:"grants"`
+	}
+	if err := json.Unmarshal(file, &policyFile); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	return NewPolicy(policyFile.Grants)
+}
+
+// NewPolicy returns a policy with the given grants. It returns an error if a grant
+// has no user or names an unknown role.
+func NewPolicy(grants []Grant) (*Policy, error) {
+	policy := &Policy{}
+	for _, grant := range grants {
+		if grant.User == "" {
+			return nil, fmt.Errorf("grant on %q has no user", grant.Path)
+		}
+		role, found := roleNames[grant.Role]
+		if !found {
+			return nil, fmt.Errorf("grant to %q has unknown role %q", grant.User, grant.Role)
+		}
+		policy.grants = append(policy.grants, policyGrant{
+			user:     grant.User,
+			pathList: SplitPath(grant.Path),
+			role:     role,
+		})
+	}
+	return policy, nil
+}
+
+// SplitPath splits a path like "/db/doc/col" into its names. The root path "/" has none.
+func SplitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// RoleFor returns the role the user has on the path given as a list of names.
+func (policy *Policy) RoleFor(username string, pathList []string) Role {
+	role := RoleNone
+	depth := -1
+	userGrant := false
+	for _, grant := range policy.grants {
+		if grant.user != username && grant.user != AnyUser {
+			continue
+		}
+		if !isPrefix(grant.pathList, pathList) {
+			continue
+		}
+		// The closest grant wins, and on the same path a grant to the user wins
+		isUser := grant.user == username
+		if len(grant.pathList) > depth || (len(grant.pathList) == depth && isUser && !userGrant) {
+			role, depth, userGrant = grant.role, len(grant.pathList), isUser
+		}
+	}
+	return role
+}
+
+// isPrefix reports whether prefix names the same path as the start of pathList.
+func isPrefix(prefix []string, pathList []string) bool {
+	if len(prefix) > len(pathList) {
+		return false
+	}
+	for i, name := range prefix {
+		if pathList[i] != name {
+			return false
+		}
+	}
+	return true
+}
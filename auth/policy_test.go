@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleFor(t *testing.T) {
+	policy, err := NewPolicy([]Grant{
+		{User: AnyUser, Path: "/", Role: "reader"},
+		{User: "alice", Path: "/", Role: "admin"},
+		{User: "bob", Path: "/shop", Role: "writer"},
+		{User: AnyUser, Path: "/shop/secrets", Role: "none"},
+		{User: "bob", Path: "/shop/secrets/plans", Role: "reader"},
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		user     string
+		path     string
+		expected Role
+	}{
+		{user: "carol", path: "/", expected: RoleReader},
+		{user: "carol", path: "/shop/doc", expected: RoleReader},
+		{user: "alice", path: "/shop", expected: RoleAdmin},
+		{user: "bob", path: "/other", expected: RoleReader},
+		{user: "bob", path: "/shop", expected: RoleWriter},
+		{user: "bob", path: "/shop/doc/col", expected: RoleWriter},
+		{user: "bob", path: "/shop/secrets", expected: RoleNone},
+		{user: "alice", path: "/shop/secrets/doc", expected: RoleNone},
+		{user: "bob", path: "/shop/secrets/plans/col", expected: RoleReader},
+		{user: "bob", path: "/shopping", expected: RoleReader},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.user+tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, policy.RoleFor(tc.user, SplitPath(tc.path)))
+		})
+	}
+
+	// Without any grant above a path, users have no access
+	empty, err := NewPolicy(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleNone, empty.RoleFor("alice", SplitPath("/db")))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "policy.json")
+	os.WriteFile(valid, []byte(`{"grants":[{"user":"alice","path":"/db","role":"writer"}]}`), 0o644)
+	policy, err := LoadPolicy(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleWriter, policy.RoleFor("alice", SplitPath("/db/doc")))
+
+	unknownRole := filepath.Join(dir, "unknown.json")
+	os.WriteFile(unknownRole, []byte(`{"grants":[{"user":"alice","path":"/","role":"owner"}]}`), 0o644)
+	_, err = LoadPolicy(unknownRole)
+	assert.Error(t, err)
+
+	_, err = LoadPolicy(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
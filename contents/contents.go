@@ -1,32 +1,25 @@
 package contents
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"strconv"
 	"time"
 
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
 	sse "github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
 )
 
-// For SSE logic
-type WriteFlusher interface {
-	http.ResponseWriter
-	http.Flusher
-}
-
 // A Collection represents a collection of documents.
-// It contains the name of the collection and the skiplist used for
-// storing documents.
+// It contains the name of the collection, the skiplist used for
+// storing documents, and the schema attached to the collection, if there is one.
 type Collection struct {
 	Name      string                             // Name of the collection
 	Documents skiplist.DBIndex[string, Document] // SkipList used to store the documents inside the collection
 	// The key type for this SkipList is a string and the value type is a Document struct.
-	Subscribers map[string]WriteFlusher
+	Schema    *jsondata.ValidSchema // nil unless a schema was attached
+	Ownership Ownership             // who may use the documents, see Ownership
 }
 
 type ValidSchema interface {
@@ -64,18 +57,40 @@ func GetCollection(collectionList skiplist.DBIndex[string, Collection], collecti
 //
 // Returns a boolean, either success (true) or failure (false), or an error if one occured.
 func PutCollection(collectionList skiplist.DBIndex[string, Collection], collectionName string) (bool, error) {
+	return PutCollectionWithSchema(collectionList, collectionName, nil)
+}
+
+// PutCollectionWithSchema works like PutCollection, but attaches the given schema to the
+// new collection. A nil schema creates a collection without one.
+func PutCollectionWithSchema(collectionList skiplist.DBIndex[string, Collection], collectionName string, schema *jsondata.ValidSchema) (bool, error) {
 	updateCheck := func(key string, currValue Collection, exists bool) (newValue Collection, err error) {
 		if exists {
 			return currValue, fmt.Errorf("database already exists")
 		}
 		newValue.Name = key
-		newValue.Documents = skiplist.NewSkipList[string, Document]()
+		newValue.Documents = NewDocumentList()
+		newValue.Schema = schema
 		return newValue, nil
 	}
 
 	return collectionList.Upsert(collectionName, updateCheck)
 }
 
+// SetCollectionSchema attaches the given schema to an existing collection, replacing the
+// one it had. A nil schema removes the collection's schema. Documents that are already
+// stored are not checked against the new schema. An error is returned if the collection
+// does not exist.
+func SetCollectionSchema(collectionList skiplist.DBIndex[string, Collection], collectionName string, schema *jsondata.ValidSchema) error {
+	_, err := collectionList.Upsert(collectionName, func(key string, currValue Collection, exists bool) (Collection, error) {
+		if !exists {
+			return currValue, fmt.Errorf("collection %s does not exist", key)
+		}
+		currValue.Schema = schema
+		return currValue, nil
+	})
+	return err
+}
+
 // DeleteDocument removes a given Collection from its respective skiplist. The inputs to this
 // function are collectionList (a skiplist representing a list of collection) and collectionName (a string representing
 // the collection that we are wanting to remove).
@@ -85,66 +100,32 @@ func PutCollection(collectionList skiplist.DBIndex[string, Collection], collecti
 
 func DeleteCollection(collectionList skiplist.DBIndex[string, Collection], collectionName string, subscriberHandler *sse.SubscriberHandler, fullPath string) (bool, error) {
 
-	col, found := collectionList.Find(collectionName)
+	_, found := collectionList.Find(collectionName)
 	if !found {
 		return false, fmt.Errorf("could not find collection named %s", collectionName)
 	}
 
-	subscriberHandler.Notify(fullPath, "delete", strconv.Quote(fullPath))
-	//subscriberHandler.Notify(fullPath, "delete", strconv.Quote(fullPath))
-	col.HandleColDelete()
-
-	// Now remove from the skiplist after handling delete with subscribers
 	_, removed := collectionList.Remove(collectionName)
 	if !removed {
 		return false, fmt.Errorf("could not delete document named %s", collectionName)
 	}
+	// Subscribers of the collection and of the paths containing it are told it is gone
+	subscriberHandler.Publish(sse.Event{Type: sse.Delete, Path: fullPath})
 	return true, nil
 }
 
-// Notify subscribers
-func (c *Collection) NotifySubscribers(eventName string, eventData string) {
-	for _, wf := range c.Subscribers {
-		var evt bytes.Buffer
-		evt.WriteString(fmt.Sprintf("event: %s\ndata: %s\nid: %d\n\n", eventName, eventData, time.Now().UnixMilli()))
-		wf.Write(evt.Bytes())
-		wf.Flush()
-	}
-}
-
-// Handle a document update in a collection
-func (c *Collection) HandleDocumentUpdate(doc *Document) {
-	metaJSON, err := json.Marshal(doc.Metadata)
-	if err != nil {
-		fmt.Printf("error serializing metadata: %v\n", err)
-		return
-	}
-	eventData := fmt.Sprintf(`{"path":"%s","doc":%s,"meta":%s}`, doc.Path, strconv.Quote(string(doc.Content)), metaJSON)
-	c.NotifySubscribers("update", eventData)
-}
-
-// Handle a document deletion in a collection
-func (c *Collection) HandleDocumentDelete(docPath string) {
-	eventData := strconv.Quote(docPath)
-	c.NotifySubscribers("delete", eventData)
-}
-
-// Handle deletion of a collection
-func (c *Collection) HandleColDelete() {
-	eventData := strconv.Quote(c.Name)
-	c.NotifySubscribers("delete", eventData)
-}
-
 // This struct represents a document in our database. The struct contains the name of the document,
-// the path to the document, the document's contents, the Metadata associated with the document,
-// the collections that are nested inside the document, and a map to the subscribers that are subscribed to the document.
+// the path to the document, the document's contents, its version and previous revisions, the Metadata associated with the document,
+// and the collections that are nested inside the document. Subscribers of the document are kept by sse.SubscriberHandler.
 type Document struct {
 	Name        string // name of the document
 	Path        string // path to the document in the database
 	Content     []byte
+	Version     int64                                // incremented every time the document is written
+	WrittenAt   int64                                // time this version was written in Unix milliseconds
+	History     []Revision                           // previous revisions, oldest first, bounded by HistoryLimit
 	Metadata    Metadata                             // contains information about creation/modification of the document
 	Collections skiplist.DBIndex[string, Collection] // skiplist holds the collections stored inside the document
-	Subscribers map[string]WriteFlusher              // map of subscribers holding the path to the subscriber/client
 }
 
 // This struct holds the information of which user created the document and the time
@@ -191,48 +172,114 @@ func GetDocument(documentList skiplist.DBIndex[string, Document], documentName s
 //
 // PutCollection returns true if successful, false if it fails, or an error.
 func PutDocument(documentList skiplist.DBIndex[string, Document], documentName string, documentContent []byte, user string, mode string, schema ValidSchema) (bool, error) {
+	_, err := PutDocumentIf(documentList, documentName, documentContent, user, mode, schema, Precondition{})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	updateCheck := func(key string, currValue Document, exists bool) (newValue Document, err error) {
-		// Creating the name and content for the document
-		newValue.Name = key
-		newValue.Content = documentContent
+// PutDocumentIf works like PutDocument, but only writes the document if the given
+// precondition holds for the document currently stored under documentName. The
+// precondition is checked inside the update check, so no other write can slip in
+// between the check and the write. If it does not hold, ErrPreconditionFailed is
+// returned. Every write gives the document the next version number, starting at 1,
+// and moves the replaced version into the document's history.
+//
+// PutDocumentIf returns the document as it was stored.
+func PutDocumentIf(documentList skiplist.DBIndex[string, Document], documentName string, documentContent []byte, user string, mode string, schema ValidSchema, precondition Precondition) (Document, error) {
+	var stored Document
+	updateCheck := func(key string, currValue Document, exists bool) (Document, error) {
+		// Check the request's preconditions against the stored document
+		if err := precondition.Check(currValue, exists); err != nil {
+			return currValue, err
+		}
+		newValue, err := writeDocument(key, currValue, exists, documentContent, user, mode, schema)
+		if err != nil {
+			return currValue, err
+		}
+		stored = newValue
+		return newValue, nil
+	}
+	_, err := documentList.Upsert(documentName, updateCheck)
+	return stored, err
+}
 
-		// Check that the document content matches the provided JSON Schema
-		_, err = schema.ValidateDocument(newValue.Content)
+// UpdateDocumentIf works like PutDocumentIf, but computes the new content of an existing
+// document by calling update with the content currently stored. Since update is called
+// inside the update check, it always sees the latest content, and concurrent updates of
+// the same document are applied one after another instead of overwriting each other.
+// If update returns an error, the document is left as it was and the error is returned.
+//
+// UpdateDocumentIf returns the document as it was stored.
+func UpdateDocumentIf(documentList skiplist.DBIndex[string, Document], documentName string, update func(content []byte) ([]byte, error), user string, schema ValidSchema, precondition Precondition) (Document, error) {
+	var stored Document
+	updateCheck := func(key string, currValue Document, exists bool) (Document, error) {
+		if !exists {
+			return currValue, fmt.Errorf("failed to find document")
+		}
+		if err := precondition.Check(currValue, exists); err != nil {
+			return currValue, err
+		}
+		content, err := update(currValue.Content)
 		if err != nil {
-			fmt.Errorf("Document content does not match the provided schema\n")
 			return currValue, err
 		}
-		// Handle when in nooverwrite mode
-		if exists && mode == "nooverwrite" {
-			return currValue, fmt.Errorf("document exists and mode is nooverwrite")
+		newValue, err := writeDocument(key, currValue, exists, content, user, "overwrite", schema)
+		if err != nil {
+			return currValue, err
 		}
-		// In overwrite or not specified mode, create/update like usual
-		if exists {
-			newValue.Metadata = Metadata{
-				CreatedBy:      currValue.Metadata.CreatedBy,
-				CreatedAt:      currValue.Metadata.CreatedAt,
-				LastModifiedBy: user,
-				LastModifiedAt: time.Now().Unix(),
-			}
-			// Handle the update for subscription
-			currValue.HandleUpdate(documentContent, user)
+		// Updating the content keeps the collections nested inside the document
+		newValue.Collections = currValue.Collections
+		stored = newValue
+		return newValue, nil
+	}
+	_, err := documentList.Upsert(documentName, updateCheck)
+	return stored, err
+}
 
-			return newValue, nil
-		}
-		// Create a new document if doc doesn't exist
-		newValue.Collections = skiplist.NewSkipList[string, Collection]()
+// writeDocument returns the document that replaces currValue when it is written with the
+// given content, or a new document if none exists yet. It is called inside update checks.
+func writeDocument(key string, currValue Document, exists bool, documentContent []byte, user string, mode string, schema ValidSchema) (newValue Document, err error) {
+	// Creating the name and content for the document
+	newValue.Name = key
+	newValue.Content = documentContent
+
+	// Check that the document content matches the provided JSON Schema
+	_, err = schema.ValidateDocument(newValue.Content)
+	if err != nil {
+		return currValue, fmt.Errorf("document content does not match the provided schema: %w", err)
+	}
+	// Handle when in nooverwrite mode
+	if exists && mode == "nooverwrite" {
+		return currValue, fmt.Errorf("document exists and mode is nooverwrite")
+	}
+	// In overwrite or not specified mode, create/update like usual
+	if exists {
+		// Overwriting replaces the document, along with the collections nested inside it
+		newValue.Collections = storage.New[string, Collection]()
+		newValue.Version = currValue.Version + 1
+		newValue.WrittenAt = time.Now().UnixMilli()
+		newValue.History = RecordRevision(currValue)
 		newValue.Metadata = Metadata{
-			CreatedBy:      user,
-			CreatedAt:      time.Now().Unix(),
-			LastModifiedBy: user,              // Since it's a new document, the creator is also the last modifier
-			LastModifiedAt: time.Now().Unix(), // Initial creation time is also the last modification time
+			CreatedBy:      currValue.Metadata.CreatedBy,
+			CreatedAt:      currValue.Metadata.CreatedAt,
+			LastModifiedBy: user,
+			LastModifiedAt: time.Now().Unix(),
 		}
-		// Notify subscribers about the new document
-		newValue.NotifySubscribers("create", fmt.Sprintf(`{"path":"%s"}`, newValue.Path))
 		return newValue, nil
 	}
-	return documentList.Upsert(documentName, updateCheck)
+	// Create a new document if doc doesn't exist
+	newValue.Collections = storage.New[string, Collection]()
+	newValue.Version = 1
+	newValue.WrittenAt = time.Now().UnixMilli()
+	newValue.Metadata = Metadata{
+		CreatedBy:      user,
+		CreatedAt:      time.Now().Unix(),
+		LastModifiedBy: user,              // Since it's a new document, the creator is also the last modifier
+		LastModifiedAt: time.Now().Unix(), // Initial creation time is also the last modification time
+	}
+	return newValue, nil
 }
 
 // DeleteDocument removes a given document from its respective skiplist. The inputs to this
@@ -247,54 +294,11 @@ func DeleteDocument(documentList skiplist.DBIndex[string, Document], documentNam
 		return false, fmt.Errorf("could not find document named %s", documentName)
 	}
 
-	doc.HandleDocDelete()
-	// Notify subscribers about the deletion
-	subscriberHandler.Notify(fullPath, "delete", strconv.Quote(fullPath))
-
-	// Now remove from the skiplist after handling subscribers
 	_, removed := documentList.Remove(documentName)
 	if !removed {
 		return false, fmt.Errorf("could not delete document named %s", documentName)
 	}
+	// Notify subscribers about the deletion, with the contents the document had
+	subscriberHandler.Publish(sse.Event{Type: sse.Delete, Path: fullPath, Content: doc.Content, Owner: doc.Metadata.CreatedBy})
 	return true, nil
 }
-
-// Notify subscribers
-func (d *Document) NotifySubscribers(eventName string, eventData string) {
-	for _, wf := range d.Subscribers {
-		var evt bytes.Buffer
-		evt.WriteString(fmt.Sprintf("event: %s\ndata: %s\nid: %d\n\n", eventName, eventData, time.Now().UnixMilli()))
-		wf.Write(evt.Bytes())
-		wf.Flush()
-	}
-}
-
-// AddSubscriber adds a new subscriber to the document
-func (d *Document) AddSubscriber(clientID string, wf WriteFlusher) {
-	if d.Subscribers == nil {
-		d.Subscribers = make(map[string]WriteFlusher)
-	}
-	d.Subscribers[clientID] = wf
-}
-
-// Handle an update to a doc
-func (d *Document) HandleUpdate(newContent []byte, user string) {
-	d.Content = newContent
-	d.Metadata.LastModifiedBy = user
-	d.Metadata.LastModifiedAt = time.Now().Unix()
-
-	metaJSON, err := json.Marshal(d.Metadata)
-	if err != nil {
-		fmt.Printf("error serializing metadata: %v\n", err)
-		return
-	}
-
-	eventData := fmt.Sprintf(`{"path":"%s","doc":%s,"meta":%s}`, d.Path, strconv.Quote(string(d.Content)), metaJSON)
-	d.NotifySubscribers("update", eventData)
-}
-
-// Handle a deletion of a doc
-func (d *Document) HandleDocDelete() {
-	eventData := strconv.Quote(d.Path)
-	d.NotifySubscribers("delete", eventData)
-}
@@ -0,0 +1,95 @@
+package contents
+
+import (
+	"sync/atomic"
+)
+
+// Number of previous revisions kept for each document unless SetHistoryLimit is called.
+const DefaultHistoryLimit = 10
+
+// Upper bound on the previous revisions kept for each document.
+var historyLimit atomic.Int64
+
+func init() {
+	historyLimit.Store(DefaultHistoryLimit)
+}
+
+// A Revision is one state a document has been in. It holds the version the document had
+// in that state, its contents and metadata, and when it was written in Unix milliseconds.
+type Revision struct {
+	Version   int64    `json:"version"`
+	Content   []byte   `json:"content"`
+	Metadata  Metadata `json:"metadata"`
+	WrittenAt int64    `json:"writtenAt"`
+}
+
+// SetHistoryLimit sets how many previous revisions are kept for each document. Older
+// revisions are dropped the next time a document is written. A limit of 0 keeps none.
+func SetHistoryLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	historyLimit.Store(int64(limit))
+}
+
+// HistoryLimit returns how many previous revisions are kept for each document.
+func HistoryLimit() int {
+	return int(historyLimit.Load())
+}
+
+// Revision returns the current state of the document as a revision.
+func (d Document) Revision() Revision {
+	return Revision{
+		Version:   d.Version,
+		Content:   d.Content,
+		Metadata:  d.Metadata,
+		WrittenAt: d.WrittenAt,
+	}
+}
+
+// RecordRevision returns the history a document should have after replacing previous:
+// the history of previous followed by previous itself, trimmed to the history limit.
+// The history of previous is never modified.
+func RecordRevision(previous Document) []Revision {
+	limit := HistoryLimit()
+	history := make([]Revision, 0, min(len(previous.History)+1, limit))
+	history = append(history, previous.History...)
+	history = append(history, previous.Revision())
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
+}
+
+// Revisions returns every revision of the document that is still known, from the
+// oldest to the current one.
+func (d Document) Revisions() []Revision {
+	revisions := make([]Revision, 0, len(d.History)+1)
+	revisions = append(revisions, d.History...)
+	return append(revisions, d.Revision())
+}
+
+// RevisionAt returns the revision of the document with the given version. It returns
+// false if the version never existed or is no longer kept.
+func (d Document) RevisionAt(version int64) (Revision, bool) {
+	for _, revision := range d.Revisions() {
+		if revision.Version == version {
+			return revision, true
+		}
+	}
+	return Revision{}, false
+}
+
+// RevisionAsOf returns the revision that was current at the given time in Unix
+// milliseconds. It returns false if the document did not exist yet at that time, or
+// if the revision that was current then is no longer kept.
+func (d Document) RevisionAsOf(unixMilli int64) (Revision, bool) {
+	revisions := d.Revisions()
+	for i := len(revisions) - 1; i >= 0; i-- {
+		// Each revision stays current until the next one is written
+		if revisions[i].WrittenAt <= unixMilli {
+			return revisions[i], true
+		}
+	}
+	return Revision{}, false
+}
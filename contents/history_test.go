@@ -0,0 +1,73 @@
+package contents
+
+import (
+	"testing"
+)
+
+// documentWithRevisions builds a document that has been written the given number of
+// times, where version v was written at time 100*v and holds the content v.
+func documentWithRevisions(versions int) Document {
+	var doc Document
+	for v := 1; v <= versions; v++ {
+		next := Document{Name: "doc", Content: []byte{byte('0' + v)}, Version: int64(v), WrittenAt: int64(100 * v)}
+		if v > 1 {
+			next.History = RecordRevision(doc)
+		}
+		doc = next
+	}
+	return doc
+}
+
+func TestRecordRevisionLimit(t *testing.T) {
+	SetHistoryLimit(3)
+	defer SetHistoryLimit(DefaultHistoryLimit)
+
+	doc := documentWithRevisions(6)
+	if len(doc.History) != 3 {
+		t.Fatalf("Expected 3 previous revisions but found %d", len(doc.History))
+	}
+	revisions := doc.Revisions()
+	for i, expected := range []int64{3, 4, 5, 6} {
+		if revisions[i].Version != expected {
+			t.Fatalf("Expected revision %d at position %d but found %d", expected, i, revisions[i].Version)
+		}
+	}
+
+	SetHistoryLimit(0)
+	if history := RecordRevision(doc); len(history) != 0 {
+		t.Fatalf("No revisions should be kept with a limit of 0")
+	}
+}
+
+func TestRevisionLookup(t *testing.T) {
+	SetHistoryLimit(3)
+	defer SetHistoryLimit(DefaultHistoryLimit)
+	doc := documentWithRevisions(5)
+
+	testCases := []struct {
+		name     string
+		lookup   func() (Revision, bool)
+		found    bool
+		expected int64
+	}{
+		{name: "current", lookup: func() (Revision, bool) { return doc.RevisionAt(5) }, found: true, expected: 5},
+		{name: "kept", lookup: func() (Revision, bool) { return doc.RevisionAt(3) }, found: true, expected: 3},
+		{name: "dropped", lookup: func() (Revision, bool) { return doc.RevisionAt(1) }, found: false},
+		{name: "future", lookup: func() (Revision, bool) { return doc.RevisionAt(6) }, found: false},
+		{name: "as of write", lookup: func() (Revision, bool) { return doc.RevisionAsOf(300) }, found: true, expected: 3},
+		{name: "as of between", lookup: func() (Revision, bool) { return doc.RevisionAsOf(450) }, found: true, expected: 4},
+		{name: "as of later", lookup: func() (Revision, bool) { return doc.RevisionAsOf(9999) }, found: true, expected: 5},
+		{name: "as of dropped", lookup: func() (Revision, bool) { return doc.RevisionAsOf(150) }, found: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			revision, found := tc.lookup()
+			if found != tc.found {
+				t.Fatalf("Expected found to be %v", tc.found)
+			}
+			if found && revision.Version != tc.expected {
+				t.Fatalf("Expected revision %d but received %d", tc.expected, revision.Version)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package contents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
+)
+
+// Number of locks that writes to an IndexedDocuments list are spread over.
+const indexLockStripes = 64
+
+// IndexedDocuments is the document list used by databases and collections. It stores
+// the documents in a skiplist and keeps any number of secondary indexes on fields of
+// the documents up to date, along with an order list for each metadata field documents
+// can be listed in the order of. Every Upsert and Remove goes through this list, so the
+// indexes and order lists stay consistent no matter which function changed the documents.
+//
+// Writes to the same document name are serialized by one of a fixed set of locks,
+// which is held across the change to the document and the change to the indexes.
+type IndexedDocuments struct {
+	documents skiplist.DBIndex[string, Document]
+	locks     [indexLockStripes]sync.Mutex
+	mu        sync.Mutex                                  // serializes creating and dropping indexes
+	indexes   atomic.Pointer[map[string]*documentIndex]   // replaced as a whole when indexes change
+	orders    map[string]skiplist.DBIndex[string, string] // order list of each field in OrderFields
+}
+
+// A documentIndex maps the value found at a JSON pointer in each document to the
+// names of the documents holding that value. It is backed by its own skiplist whose
+// keys are the encoded value followed by a zero byte and the document name, so the
+// keys sort in the same order as the values.
+type documentIndex struct {
+	pointer []string
+	entries skiplist.DBIndex[string, string]
+	ready   atomic.Bool // set once every existing document has been added
+}
+
+// NewDocumentList returns a new empty list of documents without any indexes.
+func NewDocumentList() skiplist.DBIndex[string, Document] {
+	list := &IndexedDocuments{documents: storage.New[string, Document](), orders: newOrders()}
+	list.indexes.Store(&map[string]*documentIndex{})
+	return list
+}
+
+// stripe returns the lock that guards writes to the given document name.
+func (d *IndexedDocuments) stripe(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &d.locks[h.Sum32()%indexLockStripes]
+}
+
+// Find returns the document with the given name.
+func (d *IndexedDocuments) Find(key string) (Document, bool) {
+	return d.documents.Find(key)
+}
+
+// Query returns the documents with names between start and end.
+func (d *IndexedDocuments) Query(ctx context.Context, start string, end string) ([]Document, error) {
+	return d.documents.Query(ctx, start, end)
+}
+
+// QueryRange returns the documents whose names are in the range.
+func (d *IndexedDocuments) QueryRange(ctx context.Context, keys skiplist.Range[string]) ([]Document, error) {
+	return d.documents.QueryRange(ctx, keys)
+}
+
+// All returns an iterator over the documents with names between start and end.
+func (d *IndexedDocuments) All(ctx context.Context, start string, end string) iter.Seq2[string, Document] {
+	return d.documents.All(ctx, start, end)
+}
+
+// Backward returns an iterator over the documents with names between start and end in
+// descending name order.
+func (d *IndexedDocuments) Backward(ctx context.Context, start string, end string) iter.Seq2[string, Document] {
+	return d.documents.Backward(ctx, start, end)
+}
+
+// Snapshot returns an iterator over the documents with names between start and end as
+// they were when the iteration began.
+func (d *IndexedDocuments) Snapshot(ctx context.Context, start string, end string) iter.Seq2[string, Document] {
+	return d.documents.Snapshot(ctx, start, end)
+}
+
+// Upsert inserts or updates the document with the given name like SkipList.Upsert does,
+// and then moves the document's entries in every index to its new values.
+func (d *IndexedDocuments) Upsert(key string, check skiplist.UpdateCheck[string, Document]) (bool, error) {
+	lock := d.stripe(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var oldValue, newValue Document
+	var hadOld bool
+	updated, err := d.documents.Upsert(key, func(key string, currValue Document, exists bool) (Document, error) {
+		value, err := check(key, currValue, exists)
+		if err == nil {
+			oldValue, hadOld, newValue = currValue, exists, value
+		}
+		return value, err
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	for _, index := range *d.indexes.Load() {
+		if hadOld {
+			index.remove(key, oldValue)
+		}
+		index.add(key, newValue)
+	}
+	if hadOld {
+		d.removeOrders(key, oldValue)
+	}
+	d.addOrders(key, newValue)
+	return updated, nil
+}
+
+// Remove removes the document with the given name along with its index entries.
+func (d *IndexedDocuments) Remove(key string) (Document, bool) {
+	lock := d.stripe(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	removedValue, removed := d.documents.Remove(key)
+	if removed {
+		for _, index := range *d.indexes.Load() {
+			index.remove(key, removedValue)
+		}
+		d.removeOrders(key, removedValue)
+	}
+	return removedValue, removed
+}
+
+// CreateIndex declares an index on the given JSON pointer and adds every existing
+// document to it. It returns false if the index already existed. An error is returned
+// if the pointer is invalid or the list does not support indexes.
+func CreateIndex(ctx context.Context, documentList skiplist.DBIndex[string, Document], pointer string) (bool, error) {
+	d, ok := documentList.(*IndexedDocuments)
+	if !ok {
+		return false, fmt.Errorf("document list does not support indexes")
+	}
+	tokens, err := query.ParsePointer(pointer)
+	if err != nil {
+		return false, err
+	}
+	pointer = query.FormatPointer(tokens)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := *d.indexes.Load()
+	if _, exists := current[pointer]; exists {
+		return false, nil
+	}
+	index := &documentIndex{pointer: tokens, entries: storage.New[string, string]()}
+
+	// Publish the index first so writers start maintaining it, then add the documents
+	// that already exist. Each one is added under its write lock, so a concurrent
+	// write to it either happens before (and is seen here) or after (and updates it).
+	next := make(map[string]*documentIndex, len(current)+1)
+	for key, value := range current {
+		next[key] = value
+	}
+	next[pointer] = index
+	d.indexes.Store(&next)
+
+	for name := range d.documents.All(ctx, "", "") {
+		lock := d.stripe(name)
+		lock.Lock()
+		if current, found := d.documents.Find(name); found {
+			index.add(name, current)
+		}
+		lock.Unlock()
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	index.ready.Store(true)
+	return true, nil
+}
+
+// DropIndex removes the index on the given JSON pointer. It returns false if there was
+// no such index.
+func DropIndex(documentList skiplist.DBIndex[string, Document], pointer string) bool {
+	d, ok := documentList.(*IndexedDocuments)
+	if !ok {
+		return false
+	}
+	tokens, err := query.ParsePointer(pointer)
+	if err != nil {
+		return false
+	}
+	pointer = query.FormatPointer(tokens)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := *d.indexes.Load()
+	if _, exists := current[pointer]; !exists {
+		return false
+	}
+	next := make(map[string]*documentIndex, len(current))
+	for key, value := range current {
+		if key != pointer {
+			next[key] = value
+		}
+	}
+	d.indexes.Store(&next)
+	return true
+}
+
+// Indexes returns the JSON pointers of every index on the document list in sorted order.
+func Indexes(documentList skiplist.DBIndex[string, Document]) []string {
+	d, ok := documentList.(*IndexedDocuments)
+	if !ok {
+		return nil
+	}
+	pointers := []string{}
+	for pointer := range *d.indexes.Load() {
+		pointers = append(pointers, pointer)
+	}
+	sort.Strings(pointers)
+	return pointers
+}
+
+// SetIndexes makes the indexes on the document list exactly the given JSON pointers,
+// creating and dropping indexes as needed.
+func SetIndexes(ctx context.Context, documentList skiplist.DBIndex[string, Document], pointers []string) error {
+	for _, pointer := range Indexes(documentList) {
+		if !slices.Contains(pointers, pointer) {
+			DropIndex(documentList, pointer)
+		}
+	}
+	for _, pointer := range pointers {
+		if _, err := CreateIndex(ctx, documentList, pointer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Candidates uses the indexes of the document list to find the names of the documents
+// that may match the given filter. The second result is false if no index could be
+// used, in which case every document has to be checked. The returned names are sorted,
+// and every matching document is among them, but the caller still has to check each
+// one against the filter.
+func Candidates(ctx context.Context, documentList skiplist.DBIndex[string, Document], filter query.Expr) ([]string, bool, error) {
+	d, ok := documentList.(*IndexedDocuments)
+	if !ok {
+		return nil, false, nil
+	}
+	indexes := *d.indexes.Load()
+	for _, constraint := range query.Constraints(filter) {
+		index, found := indexes[constraint.Pointer]
+		if !found || !index.ready.Load() {
+			continue
+		}
+		names, usable, err := index.lookup(ctx, constraint)
+		if err != nil {
+			return nil, false, err
+		}
+		if !usable {
+			continue
+		}
+		sort.Strings(names)
+		return slices.Compact(names), true, nil
+	}
+	return nil, false, nil
+}
+
+// indexKey returns the part of an index key that encodes the given value. Numbers
+// and strings are encoded so that byte order matches the order used by query.Compare.
+// Other values are not indexed and return false.
+func indexKey(value jsondata.JSONValue) (string, bool) {
+	scalar := query.ScalarOf(value)
+	switch scalar.Kind {
+	case "number":
+		f := scalar.Number
+		if f == 0 {
+			f = 0 // -0 and 0 are equal, so they must encode the same way
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) == 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return fmt.Sprintf("n%016x", bits), true
+	case "string":
+		return "s" + scalar.String, true
+	}
+	return "", false
+}
+
+// entryKey returns the key of the index entry for the given document, if it has one.
+func (index *documentIndex) entryKey(name string, doc Document) (string, bool) {
+	var content jsondata.JSONValue
+	if err := json.Unmarshal(doc.Content, &content); err != nil {
+		return "", false
+	}
+	value, found := query.Resolve(content, index.pointer)
+	if !found {
+		return "", false
+	}
+	key, ok := indexKey(value)
+	if !ok {
+		return "", false
+	}
+	return key + "\x00" + name, true
+}
+
+// add adds the entry for the given document to the index.
+func (index *documentIndex) add(name string, doc Document) {
+	if key, ok := index.entryKey(name, doc); ok {
+		index.entries.Upsert(key, func(key string, currValue string, exists bool) (string, error) {
+			return name, nil
+		})
+	}
+}
+
+// remove removes the entry for the given document from the index.
+func (index *documentIndex) remove(name string, doc Document) {
+	if key, ok := index.entryKey(name, doc); ok {
+		index.entries.Remove(key)
+	}
+}
+
+// lookup returns the names of the documents whose indexed value may satisfy the
+// constraint. It returns false if the constraint's values cannot be indexed.
+func (index *documentIndex) lookup(ctx context.Context, constraint query.Constraint) ([]string, bool, error) {
+	if constraint.Op == "==" || constraint.Op == "in" {
+		names := []string{}
+		for _, value := range constraint.Values {
+			key, ok := indexKey(value)
+			if !ok {
+				return nil, false, nil
+			}
+			// Every entry for this value sorts between these two keys
+			found, err := index.entries.Query(ctx, key+"\x00", key+"\x01")
+			if err != nil {
+				return nil, false, err
+			}
+			names = append(names, found...)
+		}
+		return names, true, nil
+	}
+
+	key, ok := indexKey(constraint.Values[0])
+	if !ok {
+		return nil, false, nil
+	}
+	// Only values of the same kind can satisfy an ordering, so stay within that kind
+	kind := key[:1]
+	start, end := kind, kind+"\xff"
+	switch constraint.Op {
+	case "<", "<=":
+		end = key + "\x01"
+	case ">", ">=":
+		start = key
+	}
+	names, err := index.entries.Query(ctx, start, end)
+	if err != nil {
+		return nil, false, err
+	}
+	return names, true, nil
+}
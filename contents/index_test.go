@@ -0,0 +1,121 @@
+package contents
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// putContent stores a document with the given content in documentList.
+func putContent(documentList skiplist.DBIndex[string, Document], name string, content string) {
+	documentList.Upsert(name, func(key string, currValue Document, exists bool) (Document, error) {
+		return Document{Name: key, Content: []byte(content)}, nil
+	})
+}
+
+type candidateTest struct {
+	filter   string
+	indexed  bool
+	expected []string
+}
+
+func TestIndexCandidates(t *testing.T) {
+	ctx := context.TODO()
+	documentList := NewDocumentList()
+	putContent(documentList, "julia", `{"name":"julia","age":22}`)
+	putContent(documentList, "april", `{"name":"april","age":21}`)
+	putContent(documentList, "sam", `{"name":"sam","age":-3.5}`)
+	putContent(documentList, "lee", `{"name":"lee","age":"unknown"}`)
+	putContent(documentList, "nobody", `{"name":"nobody"}`)
+
+	// Indexes declared after the documents exist still cover them
+	if created, err := CreateIndex(ctx, documentList, "/age"); err != nil || !created {
+		t.Fatalf("Index could not be created: %v", err)
+	}
+	if created, _ := CreateIndex(ctx, documentList, "/age"); created {
+		t.Fatalf("Creating an existing index should report false")
+	}
+
+	// Changes after the index exists move the entries
+	putContent(documentList, "april", `{"name":"april","age":30}`)
+	documentList.Remove("julia")
+	putContent(documentList, "owen", `{"name":"owen","age":22}`)
+
+	testCases := []candidateTest{
+		{filter: `/age == 22`, indexed: true, expected: []string{"owen"}},
+		{filter: `/age == 21`, indexed: true, expected: []string{}},
+		{filter: `/age in [22, 30]`, indexed: true, expected: []string{"april", "owen"}},
+		{filter: `/age < 0`, indexed: true, expected: []string{"sam"}},
+		{filter: `/age >= 22`, indexed: true, expected: []string{"april", "owen"}},
+		{filter: `/age <= 22`, indexed: true, expected: []string{"owen", "sam"}},
+		{filter: `/age == "unknown"`, indexed: true, expected: []string{"lee"}},
+		{filter: `/age > 0 and /name == "owen"`, indexed: true, expected: []string{"april", "owen"}},
+		{filter: `/age == null`, indexed: false},
+		{filter: `/age != 22`, indexed: false},
+		{filter: `/age > 0 or /name == "owen"`, indexed: false},
+		{filter: `/name == "owen"`, indexed: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filter, func(t *testing.T) {
+			filter, err := query.Parse(tc.filter)
+			if err != nil {
+				t.Fatalf("Filter failed to parse: %v", err)
+			}
+			names, indexed, err := Candidates(ctx, documentList, filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if indexed != tc.indexed {
+				t.Fatalf("Expected indexed to be %v", tc.indexed)
+			}
+			if indexed && !slices.Equal(names, tc.expected) {
+				t.Fatalf("Expected candidates %v but received %v", tc.expected, names)
+			}
+		})
+	}
+
+	if !DropIndex(documentList, "/age") || len(Indexes(documentList)) != 0 {
+		t.Fatalf("Index could not be dropped")
+	}
+	filter, _ := query.Parse(`/age == 22`)
+	if _, indexed, _ := Candidates(ctx, documentList, filter); indexed {
+		t.Fatalf("A dropped index should not be used")
+	}
+}
+
+func TestIndexConcurrentWrites(t *testing.T) {
+	ctx := context.TODO()
+	documentList := NewDocumentList()
+	CreateIndex(ctx, documentList, "/n")
+
+	// Every goroutine rewrites its own documents many times
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				putContent(documentList, fmt.Sprintf("doc%d", g), fmt.Sprintf(`{"n":%d}`, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Only the final value of each document may be left in the index
+	filter, _ := query.Parse(`/n >= 0`)
+	names, _, _ := Candidates(ctx, documentList, filter)
+	if len(names) != 8 {
+		t.Fatalf("Expected 8 index entries but found %d", len(names))
+	}
+	filter, _ = query.Parse(`/n == 49`)
+	names, _, _ = Candidates(ctx, documentList, filter)
+	if len(names) != 8 {
+		t.Fatalf("Expected every document to be indexed with its last value, found %v", names)
+	}
+}
@@ -0,0 +1,129 @@
+package contents
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
+)
+
+// Metadata fields that documents can be listed in the order of.
+const (
+	OrderByCreatedAt      = "createdAt"
+	OrderByLastModifiedAt = "lastModifiedAt"
+)
+
+// OrderFields returns the metadata fields that documents can be listed in the order of.
+func OrderFields() []string {
+	return []string{OrderByCreatedAt, OrderByLastModifiedAt}
+}
+
+// newOrders returns an empty order list for every field in OrderFields. An order list is
+// a skiplist from the order key of each document to its name.
+func newOrders() map[string]skiplist.DBIndex[string, string] {
+	orders := make(map[string]skiplist.DBIndex[string, string])
+	for _, field := range OrderFields() {
+		orders[field] = storage.New[string, string]()
+	}
+	return orders
+}
+
+// orderKey returns the key of the document in the order of the metadata field. It is the
+// field's value encoded so that byte order matches numeric order, followed by a zero byte
+// and the document name, so documents with equal values are ordered by name.
+func orderKey(field string, name string, doc Document) string {
+	var value int64
+	switch field {
+	case OrderByCreatedAt:
+		value = doc.Metadata.CreatedAt
+	case OrderByLastModifiedAt:
+		value = doc.Metadata.LastModifiedAt
+	}
+	return fmt.Sprintf("%016x\x00%s", uint64(value)^(1<<63), name)
+}
+
+// Ordered returns an iterator over the documents in documentList in ascending order of
+// the metadata field, or in descending order if descending is set. It yields the order
+// key of each document along with it instead of its name. Order keys sort in the order
+// of the iteration, so a later iteration can resume after one by passing it as from: the
+// iteration then starts at from, including it. An empty from starts at the beginning.
+//
+// The documents of an IndexedDocuments list are taken from an order list kept up to date
+// on every write, so the first documents are found without sorting the whole list, and
+// like All, writes during the iteration may or may not be seen. Other lists are sorted
+// from a snapshot. It returns an error if the field is not one of OrderFields.
+func Ordered(ctx context.Context, documentList skiplist.DBIndex[string, Document], field string, descending bool, from string) (iter.Seq2[string, Document], error) {
+	if !slices.Contains(OrderFields(), field) {
+		return nil, fmt.Errorf("documents cannot be ordered by %q", field)
+	}
+	d, ok := documentList.(*IndexedDocuments)
+	if !ok {
+		return sortedByField(ctx, documentList, field, descending, from), nil
+	}
+
+	order := d.orders[field]
+	entries := order.All(ctx, from, "")
+	if descending {
+		entries = order.Backward(ctx, "", from)
+	}
+	return func(yield func(string, Document) bool) {
+		for key, name := range entries {
+			// A document written since its entry was read has moved to another key,
+			// where the iteration returns it if it has not passed it yet
+			doc, found := d.documents.Find(name)
+			if !found || orderKey(field, name, doc) != key {
+				continue
+			}
+			if !yield(key, doc) {
+				return
+			}
+		}
+	}, nil
+}
+
+// sortedByField returns an iterator like Ordered does for a document list without order
+// lists, by sorting a snapshot of the whole list.
+func sortedByField(ctx context.Context, documentList skiplist.DBIndex[string, Document], field string, descending bool, from string) iter.Seq2[string, Document] {
+	return func(yield func(string, Document) bool) {
+		type entry struct {
+			key string
+			doc Document
+		}
+		var entries []entry
+		for name, doc := range documentList.Snapshot(ctx, "", "") {
+			entries = append(entries, entry{orderKey(field, name, doc), doc})
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+		if descending {
+			slices.Reverse(entries)
+		}
+		for _, e := range entries {
+			if from != "" && (!descending && e.key < from || descending && e.key > from) {
+				continue
+			}
+			if ctx.Err() != nil || !yield(e.key, e.doc) {
+				return
+			}
+		}
+	}
+}
+
+// addOrders adds the entries of the document to every order list.
+func (d *IndexedDocuments) addOrders(name string, doc Document) {
+	for field, order := range d.orders {
+		order.Upsert(orderKey(field, name, doc), func(key string, currValue string, exists bool) (string, error) {
+			return name, nil
+		})
+	}
+}
+
+// removeOrders removes the entries of the document from every order list.
+func (d *IndexedDocuments) removeOrders(name string, doc Document) {
+	for field, order := range d.orders {
+		order.Remove(orderKey(field, name, doc))
+	}
+}
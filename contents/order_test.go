@@ -0,0 +1,81 @@
+package contents
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// putModified stores a document with the given times in documentList.
+func putModified(documentList skiplist.DBIndex[string, Document], name string, createdAt int64, modifiedAt int64) {
+	documentList.Upsert(name, func(key string, currValue Document, exists bool) (Document, error) {
+		return Document{Name: key, Metadata: Metadata{CreatedAt: createdAt, LastModifiedAt: modifiedAt}}, nil
+	})
+}
+
+// orderedNames returns the names of the documents Ordered returns.
+func orderedNames(t *testing.T, documentList skiplist.DBIndex[string, Document], field string, descending bool, from string) []string {
+	documents, err := Ordered(context.TODO(), documentList, field, descending, from)
+	if err != nil {
+		t.Fatalf("Ordered failed: %v", err)
+	}
+	names := []string{}
+	for _, doc := range documents {
+		names = append(names, doc.Name)
+	}
+	return names
+}
+
+func TestOrdered(t *testing.T) {
+	lists := map[string]skiplist.DBIndex[string, Document]{
+		"indexed":  NewDocumentList(),
+		"snapshot": skiplist.NewSkipList[string, Document](),
+	}
+	for listName, documentList := range lists {
+		t.Run(listName, func(t *testing.T) {
+			putModified(documentList, "a", 1, 30)
+			putModified(documentList, "b", 2, 10)
+			putModified(documentList, "c", 3, 20)
+			putModified(documentList, "d", 4, 20)
+			// Writing a document again moves it in the order
+			putModified(documentList, "b", 2, 40)
+
+			testCases := []struct {
+				name       string
+				field      string
+				descending bool
+				expected   []string
+			}{
+				{"created", OrderByCreatedAt, false, []string{"a", "b", "c", "d"}},
+				{"created descending", OrderByCreatedAt, true, []string{"d", "c", "b", "a"}},
+				{"modified", OrderByLastModifiedAt, false, []string{"c", "d", "a", "b"}},
+				{"modified descending", OrderByLastModifiedAt, true, []string{"b", "a", "d", "c"}},
+			}
+			for _, tc := range testCases {
+				if names := orderedNames(t, documentList, tc.field, tc.descending, ""); !slices.Equal(names, tc.expected) {
+					t.Fatalf("%s: expected %v but received %v", tc.name, tc.expected, names)
+				}
+			}
+
+			// Resuming from an order key includes the document it belongs to
+			from := orderKey(OrderByLastModifiedAt, "d", Document{Metadata: Metadata{LastModifiedAt: 20}})
+			if names := orderedNames(t, documentList, OrderByLastModifiedAt, false, from); !slices.Equal(names, []string{"d", "a", "b"}) {
+				t.Fatalf("Expected [d a b] after the key of d but received %v", names)
+			}
+			if names := orderedNames(t, documentList, OrderByLastModifiedAt, true, from); !slices.Equal(names, []string{"d", "c"}) {
+				t.Fatalf("Expected [d c] before the key of d but received %v", names)
+			}
+
+			documentList.Remove("a")
+			if names := orderedNames(t, documentList, OrderByLastModifiedAt, false, ""); !slices.Equal(names, []string{"c", "d", "b"}) {
+				t.Fatalf("Expected removed documents to leave the order but received %v", names)
+			}
+		})
+	}
+
+	if _, err := Ordered(context.TODO(), NewDocumentList(), "name", false, ""); err == nil {
+		t.Fatalf("Expected an error for a field documents cannot be ordered by")
+	}
+}
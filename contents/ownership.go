@@ -0,0 +1,71 @@
+package contents
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// ErrNotOwner is returned when a write's precondition names an owner and the stored
+// document was created by someone else.
+var ErrNotOwner = errors.New("document belongs to another user")
+
+// An Ownership decides who may use the documents directly inside a database or
+// collection, based on who created each document.
+type Ownership string
+
+const (
+	OwnershipOff    Ownership = ""       // everyone may read and write every document
+	OwnershipWrites Ownership = "writes" // only a document's creator may overwrite, patch, or delete it
+	OwnershipReads  Ownership = "reads"  // only a document's creator may read it or write it
+)
+
+// ParseOwnership returns the ownership with the given name. Both "" and "off" name
+// OwnershipOff.
+func ParseOwnership(name string) (Ownership, error) {
+	switch name {
+	case "", "off":
+		return OwnershipOff, nil
+	case string(OwnershipWrites), string(OwnershipReads):
+		return Ownership(name), nil
+	}
+	return OwnershipOff, fmt.Errorf("unknown ownership %q, expected off, writes, or reads", name)
+}
+
+// String returns the name of the ownership, which is "off" for OwnershipOff.
+func (ownership Ownership) String() string {
+	if ownership == OwnershipOff {
+		return "off"
+	}
+	return string(ownership)
+}
+
+// RestrictsWrites reports whether only a document's creator may write it.
+func (ownership Ownership) RestrictsWrites() bool {
+	return ownership == OwnershipWrites || ownership == OwnershipReads
+}
+
+// RestrictsReads reports whether only a document's creator may read it.
+func (ownership Ownership) RestrictsReads() bool {
+	return ownership == OwnershipReads
+}
+
+// OwnedBy reports whether the document was created by the given user.
+func (d Document) OwnedBy(user string) bool {
+	return d.Metadata.CreatedBy == user
+}
+
+// SetCollectionOwnership sets the ownership of an existing collection. Documents that are
+// already stored keep the creator they have. An error is returned if the collection does
+// not exist.
+func SetCollectionOwnership(collectionList skiplist.DBIndex[string, Collection], collectionName string, ownership Ownership) error {
+	_, err := collectionList.Upsert(collectionName, func(key string, currValue Collection, exists bool) (Collection, error) {
+		if !exists {
+			return currValue, fmt.Errorf("collection %s does not exist", key)
+		}
+		currValue.Ownership = ownership
+		return currValue, nil
+	})
+	return err
+}
@@ -0,0 +1,44 @@
+package contents
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOwnership(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected Ownership
+		valid    bool
+	}{
+		{name: "", expected: OwnershipOff, valid: true},
+		{name: "off", expected: OwnershipOff, valid: true},
+		{name: "writes", expected: OwnershipWrites, valid: true},
+		{name: "reads", expected: OwnershipReads, valid: true},
+		{name: "owner", valid: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ownership, err := ParseOwnership(tc.name)
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid to be %v but received %v", tc.valid, err)
+			}
+			if tc.valid && ownership != tc.expected {
+				t.Fatalf("Expected %q but received %q", tc.expected, ownership)
+			}
+		})
+	}
+}
+
+func TestPreconditionOwner(t *testing.T) {
+	doc := Document{Name: "doc1", Version: 1, Metadata: Metadata{CreatedBy: "alice"}}
+	if err := (Precondition{Owner: "alice"}).Check(doc, true); err != nil {
+		t.Fatalf("The creator should be able to write the document: %v", err)
+	}
+	if err := (Precondition{Owner: "bob"}).Check(doc, true); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Expected ErrNotOwner but received %v", err)
+	}
+	if err := (Precondition{Owner: "bob"}).Check(Document{}, false); err != nil {
+		t.Fatalf("Anyone should be able to create a document: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package contents
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrPreconditionFailed is returned when a write's precondition does not hold for the
+// document that is currently stored.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// A Precondition holds the If-Match and If-None-Match headers of a request. Each is
+// either empty, "*", or a comma separated list of entity tags. If Owner is set, an
+// existing document may only be written if it was created by that user.
+type Precondition struct {
+	IfMatch     string
+	IfNoneMatch string
+	Owner       string
+}
+
+// ETag returns the entity tag of the given version of a document.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Check returns ErrPreconditionFailed unless the precondition holds for the stored
+// document. If-Match holds if the document exists and, unless it is "*", one of the
+// listed tags is the document's. If-None-Match holds if the document does not exist,
+// or, unless it is "*", none of the listed tags is the document's. ErrNotOwner is
+// returned instead if the precondition names an owner the document does not belong to.
+func (p Precondition) Check(currValue Document, exists bool) error {
+	if p.Owner != "" && exists && !currValue.OwnedBy(p.Owner) {
+		return ErrNotOwner
+	}
+	if p.IfMatch != "" {
+		if !exists || !matchesETag(p.IfMatch, currValue.Version) {
+			return ErrPreconditionFailed
+		}
+	}
+	if p.IfNoneMatch != "" {
+		if exists && matchesETag(p.IfNoneMatch, currValue.Version) {
+			return ErrPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// matchesETag reports whether the header value is "*" or lists the tag of the given
+// version. Weak tags are compared like strong ones, since each version has one tag.
+func matchesETag(header string, version int64) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag := ETag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
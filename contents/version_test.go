@@ -0,0 +1,38 @@
+package contents
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPreconditionCheck(t *testing.T) {
+	doc := Document{Name: "doc1", Version: 3}
+	testCases := []struct {
+		name         string
+		precondition Precondition
+		exists       bool
+		holds        bool
+	}{
+		{name: "none", precondition: Precondition{}, exists: true, holds: true},
+		{name: "if-match current", precondition: Precondition{IfMatch: `"3"`}, exists: true, holds: true},
+		{name: "if-match list", precondition: Precondition{IfMatch: `"1", W/"3"`}, exists: true, holds: true},
+		{name: "if-match stale", precondition: Precondition{IfMatch: `"2"`}, exists: true, holds: false},
+		{name: "if-match any", precondition: Precondition{IfMatch: "*"}, exists: true, holds: true},
+		{name: "if-match missing", precondition: Precondition{IfMatch: "*"}, exists: false, holds: false},
+		{name: "if-none-match any", precondition: Precondition{IfNoneMatch: "*"}, exists: true, holds: false},
+		{name: "if-none-match missing", precondition: Precondition{IfNoneMatch: "*"}, exists: false, holds: true},
+		{name: "if-none-match current", precondition: Precondition{IfNoneMatch: `"3"`}, exists: true, holds: false},
+		{name: "if-none-match stale", precondition: Precondition{IfNoneMatch: `"2"`}, exists: true, holds: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.precondition.Check(doc, tc.exists)
+			if tc.holds && err != nil {
+				t.Fatalf("Expected precondition to hold but received %v", err)
+			}
+			if !tc.holds && !errors.Is(err, ErrPreconditionFailed) {
+				t.Fatalf("Expected ErrPreconditionFailed but received %v", err)
+			}
+		})
+	}
+}
@@ -7,18 +7,22 @@ package database
 import (
 	"context"
 	"fmt"
-	"strconv"
 
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
 )
 
 // This Database struct is how we represent databases. The struct holds the
-// name of the database and a list of its top-level documents.
+// name of the database, a list of its top-level documents, the schema
+// attached to the database, if there is one, and who may use its top-level documents.
 type Database struct {
 	Name      string
 	Documents skiplist.DBIndex[string, contents.Document] // initialized as an empty map
+	Schema    *jsondata.ValidSchema                       // nil unless a schema was attached
+	Ownership contents.Ownership
 }
 
 // GetDatabase retrieves all (or some) contents of a database in the given databaseList with the name databaseName.
@@ -40,28 +44,24 @@ func GetDatabase(databaseList skiplist.DBIndex[string, Database], databaseName s
 	if start == "" && end == "" {
 		return database, nil
 	}
-	// only executes if we're trying to query a range of documents
-	var results []contents.Document
-	var err error
-
-	// Querying over the specified range
-	results, err = database.Documents.Query(ctx, start, end)
-	if err != nil {
-		return database, fmt.Errorf("failed to query documents")
-	}
-
-	// Set the queried documents back to the database (without modifying the skiplist)
-	newDocuments := skiplist.NewSkipList[string, contents.Document]()
-	for _, doc := range results {
-		newDocuments.Upsert(doc.Name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+	// only executes if we're trying to query a range of documents. The range is copied from a
+	// snapshot, so the copy is consistent even if documents change while it is made
+	newDocuments := storage.New[string, contents.Document]()
+	for name, doc := range database.Documents.Snapshot(ctx, start, end) {
+		newDocuments.Upsert(name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
 			return doc, nil
 		})
 	}
+	if ctx.Err() != nil {
+		return database, fmt.Errorf("failed to query documents")
+	}
 
 	// Returns a database only containing the contents in the given range
 	return Database{
 		Name:      database.Name,
 		Documents: newDocuments,
+		Schema:    database.Schema,
+		Ownership: database.Ownership,
 	}, nil
 }
 
@@ -73,6 +73,12 @@ func GetDatabase(databaseList skiplist.DBIndex[string, Database], databaseName s
 // The function creates the name and the empty skiplist used for the database's document list,
 // and then calls Upsert to add the newly created database to its respective skiplist.
 func PutDatabase(databaseList skiplist.DBIndex[string, Database], databaseName string, subscriberHandler *sse.SubscriberHandler, fullPath string) (bool, error) {
+	return PutDatabaseWithSchema(databaseList, databaseName, nil, subscriberHandler, fullPath)
+}
+
+// PutDatabaseWithSchema works like PutDatabase, but attaches the given schema to the new
+// database. A nil schema creates a database without one.
+func PutDatabaseWithSchema(databaseList skiplist.DBIndex[string, Database], databaseName string, schema *jsondata.ValidSchema, subscriberHandler *sse.SubscriberHandler, fullPath string) (bool, error) {
 	// Check if a database with databaseName already exists in databaseList
 	updateCheck := func(key string, currValue Database, exists bool) (newValue Database, err error) {
 		if exists {
@@ -80,12 +86,43 @@ func PutDatabase(databaseList skiplist.DBIndex[string, Database], databaseName s
 		}
 		// Assign the name and initialize the documentList for the database
 		newValue.Name = key
-		newValue.Documents = skiplist.NewSkipList[string, contents.Document]()
+		newValue.Documents = contents.NewDocumentList()
+		newValue.Schema = schema
 		return newValue, nil
 	}
 	// Upsert the database into the given databaseList
-	subscriberHandler.Notify(fullPath, "update", `{"path":"`+fullPath+`"}`)
-	return databaseList.Upsert(databaseName, updateCheck)
+	updated, err := databaseList.Upsert(databaseName, updateCheck)
+	if err == nil {
+		subscriberHandler.Publish(sse.Event{Type: sse.Create, Path: fullPath})
+	}
+	return updated, err
+}
+
+// SetSchema attaches the given schema to an existing database, replacing the one it had.
+// A nil schema removes the database's schema. Documents that are already stored are not
+// checked against the new schema. An error is returned if the database does not exist.
+func SetSchema(databaseList skiplist.DBIndex[string, Database], databaseName string, schema *jsondata.ValidSchema) error {
+	_, err := databaseList.Upsert(databaseName, func(key string, currValue Database, exists bool) (Database, error) {
+		if !exists {
+			return currValue, fmt.Errorf("database %s does not exist", key)
+		}
+		currValue.Schema = schema
+		return currValue, nil
+	})
+	return err
+}
+
+// SetOwnership sets the ownership of the top-level documents of an existing database.
+// An error is returned if the database does not exist.
+func SetOwnership(databaseList skiplist.DBIndex[string, Database], databaseName string, ownership contents.Ownership) error {
+	_, err := databaseList.Upsert(databaseName, func(key string, currValue Database, exists bool) (Database, error) {
+		if !exists {
+			return currValue, fmt.Errorf("database %s does not exist", key)
+		}
+		currValue.Ownership = ownership
+		return currValue, nil
+	})
+	return err
 }
 
 // DeleteDatabase removes the given database from the provided databaseList skiplist.
@@ -97,7 +134,7 @@ func DeleteDatabase(databaseList skiplist.DBIndex[string, Database], database Da
 	if !removed {
 		return false, fmt.Errorf("database %s could not be removed", database.Name)
 	}
-	subscriberHandler.Notify(fullPath, "delete", strconv.Quote(fullPath))
+	subscriberHandler.Publish(sse.Event{Type: sse.Delete, Path: fullPath})
 
 	return true, nil
 }
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+)
+
+// WithPolicy returns a copy of the database list that only lets users do what the
+// policy grants them. A database list without a policy lets every user do anything.
+func (databaseList DatabaseList) WithPolicy(policy *auth.Policy) DatabaseList {
+	databaseList.policy = policy
+	return databaseList
+}
+
+// allowed reports whether the user has at least the given role on the path.
+func (databaseList DatabaseList) allowed(username string, pathList []string, role auth.Role) bool {
+	if databaseList.policy == nil {
+		return true
+	}
+	return databaseList.policy.RoleFor(username, pathList) >= role
+}
+
+// requiredRole returns the role a user needs on the path of a request to send it.
+// Reading needs the reader role. Creating and deleting databases and managing schemas,
+// indexes, and ownership rules needs the admin role. Every other change needs the writer role.
+func requiredRole(r *http.Request, pathList []string) auth.Role {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet:
+		return auth.RoleReader
+	case query.Has("index") || query.Has("schema") || query.Has("ownership"):
+		return auth.RoleAdmin
+	case len(pathList) == 1 && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+		return auth.RoleAdmin
+	default:
+		return auth.RoleWriter
+	}
+}
+
+// authorize checks that the user who sent the request has the given role on the path.
+// If not, it responds with 403 and returns false.
+func (databaseList DatabaseList) authorize(w http.ResponseWriter, r *http.Request, pathList []string, role auth.Role) bool {
+	username, _ := auth.UsernameFromContext(r.Context())
+	if databaseList.allowed(username, pathList, role) {
+		return true
+	}
+	respondWithError(w, http.StatusForbidden, fmt.Sprintf("User %q needs the %s role on /%s for this request", username, role, strings.Join(pathList, "/")))
+	return false
+}
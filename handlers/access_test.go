@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: auth.AnyUser, Path: "/", Role: "reader"},
+		{User: "admin", Path: "/", Role: "admin"},
+		{User: "writer", Path: "/db1", Role: "writer"},
+		{User: auth.AnyUser, Path: "/db1/secret", Role: "none"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	testDBList := New(&testSchema, nil).WithPolicy(policy)
+
+	// Requests go through the auth middleware so they carry the user's name
+	am := auth.NewAuthManager(time.Hour)
+	tokens := map[string]string{}
+	for _, user := range []string{"admin", "writer", "reader"} {
+		tokens[user], _ = am.Login(user)
+	}
+	handler := am.Middleware(http.HandlerFunc(testDBList.V1Handler))
+	send := func(user string, method string, target string, body string) int {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+tokens[user])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	testCases := []struct {
+		name         string
+		user         string
+		method       string
+		target       string
+		body         string
+		expectedCode int
+	}{
+		{name: "writer cannot create database", user: "writer", method: http.MethodPut, target: "/v1/db1", expectedCode: http.StatusForbidden},
+		{name: "admin creates database", user: "admin", method: http.MethodPut, target: "/v1/db1", expectedCode: http.StatusCreated},
+		{name: "reader cannot write", user: "reader", method: http.MethodPut, target: "/v1/db1/doc1", body: `{"name":"julia","age":22}`, expectedCode: http.StatusForbidden},
+		{name: "writer writes", user: "writer", method: http.MethodPut, target: "/v1/db1/doc1", body: `{"name":"julia","age":22}`, expectedCode: http.StatusCreated},
+		{name: "reader reads", user: "reader", method: http.MethodGet, target: "/v1/db1/doc1", expectedCode: http.StatusOK},
+		{name: "override takes access away", user: "reader", method: http.MethodGet, target: "/v1/db1/secret", expectedCode: http.StatusForbidden},
+		{name: "writer cannot manage indexes", user: "writer", method: http.MethodPut, target: "/v1/db1?index=/name", expectedCode: http.StatusForbidden},
+		{name: "writer cannot delete database", user: "writer", method: http.MethodDelete, target: "/v1/db1", expectedCode: http.StatusForbidden},
+		{name: "writer cannot write in secret", user: "writer", method: http.MethodPost, target: "/v1/db1/$transaction", body: `{"operations":[{"op":"PUT","path":"/secret","doc":{"name":"x"}}]}`, expectedCode: http.StatusForbidden},
+		{name: "writer deletes document", user: "writer", method: http.MethodDelete, target: "/v1/db1/doc1", expectedCode: http.StatusNoContent},
+		{name: "admin deletes database", user: "admin", method: http.MethodDelete, target: "/v1/db1", expectedCode: http.StatusNoContent},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := send(tc.user, tc.method, tc.target, tc.body); code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d", tc.expectedCode, code)
+			}
+		})
+	}
+}
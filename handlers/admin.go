@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/persist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
+)
+
+// consistentCapture returns the whole database tree as it was at a single point in time.
+// It follows the same idea as the count check in SkipList.Query: the tree is walked
+// only while no write is in progress, and the walk is retried if any write started
+// before it finished. This way no half-applied write can end up in the result.
+func (databaseList DatabaseList) consistentCapture(ctx context.Context) ([]persist.Node, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		started := databaseList.writes.started.Load()
+		if databaseList.writes.finished.Load() != started {
+			// A write is still being applied, wait for it to finish
+			time.Sleep(time.Millisecond)
+			continue
+		}
+
+		databases, err := persist.Capture(ctx, databaseList.databaseList)
+		if err != nil {
+			return nil, err
+		}
+
+		// If no write started while walking the tree, the walk is consistent
+		if databaseList.writes.started.Load() == started {
+			return databases, nil
+		}
+	}
+}
+
+// BackupHandler handles GET requests to /admin/backup. It streams a self-describing
+// archive of every database, document, collection, and metadata record to the client.
+// The server keeps serving other requests while the backup is taken. If access is
+// restricted by a policy, only users with the admin role on "/" may take backups.
+func (databaseList DatabaseList) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !databaseList.authorize(w, r, nil, auth.RoleAdmin) {
+		return
+	}
+
+	databases, err := databaseList.consistentCapture(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to capture databases")
+		return
+	}
+	archive := persist.Archive{
+		Format:    persist.ArchiveFormat,
+		Version:   persist.ArchiveVersion,
+		CreatedAt: time.Now().UnixMilli(),
+		Databases: databases,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"owldb-backup-%d.json\"", archive.CreatedAt))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(archive)
+}
+
+// RestoreHandler handles POST requests to /admin/restore. The request body must be an
+// archive produced by BackupHandler. The archive is first loaded into a fresh list of
+// databases, and only if that succeeds are the current databases replaced by it.
+// Subscribers of the replaced databases are sent delete events, and subscribers of the
+// restored ones create events. Like backups, restores need the admin role on "/".
+func (databaseList DatabaseList) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !databaseList.authorize(w, r, nil, auth.RoleAdmin) {
+		return
+	}
+
+	var archive persist.Archive
+	if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid backup archive")
+		return
+	}
+	if archive.Format != persist.ArchiveFormat || archive.Version != persist.ArchiveVersion {
+		respondWithError(w, http.StatusBadRequest, "Unsupported backup archive format")
+		return
+	}
+
+	// Load the archive into a fresh list before touching the current databases
+	fresh := storage.New[string, database.Database]()
+	if err := persist.Restore(fresh, archive.Databases); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid backup archive: %v", err))
+		return
+	}
+	restored, err := fresh.Query(r.Context(), "", "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load backup archive")
+		return
+	}
+
+	unlock := databaseList.lockTree()
+	defer unlock()
+
+	// Record the change before applying it, so a restore that cannot be recorded never happens
+	current, err := databaseList.databaseList.Query(r.Context(), "", "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to query databases")
+		return
+	}
+	records := []persist.Record{}
+	for _, db := range current {
+		records = append(records, persist.Record{Op: persist.OpDelete, Path: db.Name})
+	}
+	for _, node := range archive.Databases {
+		records = treeRecords(records, fresh, node.Name, node)
+	}
+	if len(records) > 0 {
+		if err := databaseList.appendRecords(records...); err != nil {
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+	}
+
+	// Remove every current database
+	for _, db := range current {
+		databaseList.databaseList.Remove(db.Name)
+		databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Delete, Path: db.Name})
+	}
+
+	// Move the restored databases into place
+	for _, db := range restored {
+		databaseList.databaseList.Upsert(db.Name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
+			return db, nil
+		})
+		databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Create, Path: db.Name})
+	}
+
+	response, _ := json.Marshal(map[string]int{"databases": len(restored)})
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// treeRecords appends the write-ahead log records of the node at path in databaseList,
+// and of everything nested under it, to records.
+func treeRecords(records []persist.Record, databaseList skiplist.DBIndex[string, database.Database], path string, node persist.Node) []persist.Record {
+	if stored, found := persist.Lookup(databaseList, path); found {
+		records = append(records, persist.Record{Op: persist.OpPut, Path: path, Node: &stored})
+	}
+	for _, child := range node.Children {
+		records = treeRecords(records, databaseList, path+"/"+child.Name, child)
+	}
+	return records
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/persist"
+)
+
+// doRequest sends a request through the V1Handler of the given database list.
+func doRequest(databaseList DatabaseList, method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer test_token")
+	w := httptest.NewRecorder()
+	databaseList.V1Handler(w, r)
+	return w
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	source := New(&testSchema, nil)
+	doRequest(source, http.MethodPut, "/v1/db1", "")
+	doRequest(source, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+	doRequest(source, http.MethodPut, "/v1/db1/doc1/col1", "")
+	doRequest(source, http.MethodPut, "/v1/db1/doc1/col1/doc2", `{"name":"april","age":21}`)
+
+	// Take the backup
+	w := httptest.NewRecorder()
+	source.BackupHandler(w, httptest.NewRequest(http.MethodGet, "/admin/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Backup failed with status %d", w.Code)
+	}
+	backup := w.Body.Bytes()
+	var archive persist.Archive
+	if err := json.Unmarshal(backup, &archive); err != nil {
+		t.Fatalf("Backup is not a valid archive: %v", err)
+	}
+	if archive.Format != persist.ArchiveFormat || len(archive.Databases) != 1 {
+		t.Fatalf("Backup archive does not describe the databases: %+v", archive)
+	}
+
+	// Restore it over a server that has different contents
+	target := New(&testSchema, nil)
+	doRequest(target, http.MethodPut, "/v1/other", "")
+	w = httptest.NewRecorder()
+	target.RestoreHandler(w, httptest.NewRequest(http.MethodPost, "/admin/restore", bytes.NewReader(backup)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Restore failed with status %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(target, http.MethodGet, "/v1/other", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Databases that are not in the backup should be removed, got status %d", w.Code)
+	}
+	w = doRequest(target, http.MethodGet, "/v1/db1/doc1/col1/doc2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Restored document could not be retrieved, got status %d", w.Code)
+	}
+	var responses []DocumentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil || len(responses) != 1 {
+		t.Fatalf("Unexpected response for restored document: %s", w.Body.String())
+	}
+	if responses[0].Meta.CreatedAt == 0 {
+		t.Fatalf("Restored document lost its metadata")
+	}
+}
+
+func TestRestoreRejectsInvalidArchive(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{name: "not json", body: "blah blah blah"},
+		{name: "wrong format", body: `{"format":"other","version":1,"databases":[]}`},
+		{name: "wrong version", body: `{"format":"owldb-backup","version":99,"databases":[]}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := New(&testSchema, nil)
+			doRequest(target, http.MethodPut, "/v1/keep", "")
+			w := httptest.NewRecorder()
+			target.RestoreHandler(w, httptest.NewRequest(http.MethodPost, "/admin/restore", strings.NewReader(tc.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400 but received %d", w.Code)
+			}
+			if w := doRequest(target, http.MethodGet, "/v1/keep", ""); w.Code != http.StatusOK {
+				t.Fatalf("A rejected restore should leave the databases alone")
+			}
+		})
+	}
+}
+
+func TestWriteFailsWhenLogFails(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	store, err := persist.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Store could not be opened: %v", err)
+	}
+	databaseList, err := NewDurable(&testSchema, nil, store)
+	if err != nil {
+		t.Fatalf("Database list could not be created: %v", err)
+	}
+	if w := doRequest(databaseList, http.MethodPut, "/v1/db", ""); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+	doRequest(databaseList, http.MethodPut, "/v1/db/kept", `{"name":"julia","age":22}`)
+	doRequest(databaseList, http.MethodPut, "/v1/db/kept/col", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db/kept/col/doc", `{"name":"esther","age":41}`)
+	listing := doRequest(databaseList, http.MethodGet, "/v1/db", "").Body.String()
+
+	// Writes that cannot be recorded are not reported as successful, and are not applied
+	store.Close()
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodPut, "/v1/db/doc", `{"name":"julia","age":22}`},
+		{http.MethodPut, "/v1/db/kept", `{"name":"april","age":21}`},
+		{http.MethodPatch, "/v1/db/kept", `[{"op":"ObjectAdd","path":"/age","value":23}]`},
+		{http.MethodPost, "/v1/db/", `{"name":"april","age":21}`},
+		{http.MethodPost, "/v1/db/$transaction", `{"operations":[{"op":"PUT","path":"kept","doc":{"name":"april","age":21}},{"op":"PUT","path":"doc","doc":{"name":"april","age":21}}]}`},
+		{http.MethodDelete, "/v1/db/kept/col", ""},
+		{http.MethodDelete, "/v1/db/kept", ""},
+		{http.MethodDelete, "/v1/db", ""},
+		{http.MethodPut, "/v1/other", ""},
+	}
+	for _, tt := range tests {
+		if w := doRequest(databaseList, tt.method, tt.target, tt.body); w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status 500 for %s %s but received %d", tt.method, tt.target, w.Code)
+		}
+		if got := doRequest(databaseList, http.MethodGet, "/v1/db", "").Body.String(); got != listing {
+			t.Fatalf("Expected %s %s to change nothing, but the database holds %s", tt.method, tt.target, got)
+		}
+		if w := doRequest(databaseList, http.MethodGet, "/v1/db/kept/col/doc", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected %s %s to keep the nested document but received %d", tt.method, tt.target, w.Code)
+		}
+	}
+	if w := doRequest(databaseList, http.MethodGet, "/v1/other", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected the database to not be created but received %d", w.Code)
+	}
+}
+
+func TestRecoverNestedCollections(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		kept   bool
+	}{
+		{"overwrite", http.MethodPut, "/v1/db/doc", `{"name":"april","age":21}`, false},
+		{"patch", http.MethodPatch, "/v1/db/doc", `[{"op":"ObjectAdd","path":"/age","value":23}]`, true},
+		{"transaction overwrite", http.MethodPost, "/v1/db/$transaction", `{"operations":[{"op":"PUT","path":"doc","doc":{"name":"april","age":21}}]}`, false},
+		{"transaction patch", http.MethodPost, "/v1/db/$transaction", `{"operations":[{"op":"PATCH","path":"doc","patches":[{"op":"ObjectAdd","path":"/age","value":23}]}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := persist.Open(dir)
+			if err != nil {
+				t.Fatalf("Store could not be opened: %v", err)
+			}
+			databaseList, err := NewDurable(&testSchema, nil, store)
+			if err != nil {
+				t.Fatalf("Database list could not be created: %v", err)
+			}
+			doRequest(databaseList, http.MethodPut, "/v1/db", "")
+			doRequest(databaseList, http.MethodPut, "/v1/db/doc", `{"name":"julia","age":22}`)
+			doRequest(databaseList, http.MethodPut, "/v1/db/doc/col", "")
+			doRequest(databaseList, http.MethodPut, "/v1/db/doc/col/doc2", `{"name":"esther","age":41}`)
+			if w := doRequest(databaseList, tt.method, tt.target, tt.body); w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200 but received %d: %s", w.Code, w.Body.String())
+			}
+			store.Close()
+
+			// The recovered tree holds the collection only if the running server kept it
+			store, err = persist.Open(dir)
+			if err != nil {
+				t.Fatalf("Store could not be reopened: %v", err)
+			}
+			defer store.Close()
+			recovered, err := NewDurable(&testSchema, nil, store)
+			if err != nil {
+				t.Fatalf("Database list could not be recovered: %v", err)
+			}
+			for _, list := range []DatabaseList{databaseList, recovered} {
+				kept := doRequest(list, http.MethodGet, "/v1/db/doc/col/doc2", "").Code == http.StatusOK
+				if kept != tt.kept {
+					t.Fatalf("Expected the collection to be kept: %v, but it was kept: %v", tt.kept, kept)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// Places ArrayAddUnique can add a value to an array.
+const (
+	orderEnd    = "end"    // after the last element, the default
+	orderStart  = "start"  // before the first element
+	orderSorted = "sorted" // before the first larger element, keeping a sorted array sorted
+)
+
+type IncrementVisitor struct {
+	Path string
+	By   jsondata.JSONValue
+	Min  *float64
+	Max  *float64
+}
+
+// This function adds a number to the number at the path. A missing member counts as 0, so
+// counters do not have to be created first. If the result would be below Min or above Max,
+// the number is left as it was and an error is returned.
+func (v *IncrementVisitor) VisitMap(data map[string]interface{}) error {
+	tokens, err := pointerTokens(v.Path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("cannot increment the whole document")
+	}
+	by, err := jsondata.Accept[float64](v.By, numberVisitor{})
+	if err != nil {
+		return fmt.Errorf("increment value: %w", err)
+	}
+
+	current := 0.0
+	existing, err := valueAt(data, tokens)
+	exists := err == nil
+	if exists {
+		number, ok := existing.(float64)
+		if !ok {
+			return fmt.Errorf("value at path %s is not a number", v.Path)
+		}
+		current = number
+	}
+
+	result := current + by
+	if v.Min != nil && result < *v.Min {
+		return fmt.Errorf("value at path %s would fall below %v", v.Path, *v.Min)
+	}
+	if v.Max != nil && result > *v.Max {
+		return fmt.Errorf("value at path %s would rise above %v", v.Path, *v.Max)
+	}
+	return updateDocument(data, tokens, func(container interface{}, token string) (interface{}, error) {
+		if exists {
+			return replaceValue(container, token, result)
+		}
+		return addValue(container, token, result)
+	})
+}
+
+type CompareAndSetVisitor struct {
+	Path     string
+	Expected jsondata.JSONValue
+	Value    jsondata.JSONValue
+}
+
+// This function replaces the value at the path with Value, but only if it is currently
+// equal to Expected. The value must exist, and a missing Expected stands for null.
+func (v *CompareAndSetVisitor) VisitMap(data map[string]interface{}) error {
+	tokens, err := pointerTokens(v.Path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("cannot compare and set the whole document")
+	}
+	current, err := valueAt(data, tokens)
+	if err != nil {
+		return err
+	}
+	currentValue, err := jsondata.NewJSONValue(current)
+	if err != nil {
+		return fmt.Errorf("failed to convert value to JSONValue: %w", err)
+	}
+	if !currentValue.Equal(v.Expected) {
+		return fmt.Errorf("value at path %s is not the expected value", v.Path)
+	}
+	value, err := decodedValue(v.Value)
+	if err != nil {
+		return err
+	}
+	return updateDocument(data, tokens, func(container interface{}, token string) (interface{}, error) {
+		return replaceValue(container, token, value)
+	})
+}
+
+type ArrayAddUniqueVisitor struct {
+	Path  string
+	Value jsondata.JSONValue
+	Order string
+}
+
+// This function adds Value to the array at the path unless the array already holds an
+// equal element, in which case the array is left as it is. Order says where the value is
+// added: at the "end" (the default), at the "start", or "sorted", before the first
+// element larger than it. Sorted arrays may only hold numbers or only strings.
+func (v *ArrayAddUniqueVisitor) VisitMap(data map[string]interface{}) error {
+	tokens, err := pointerTokens(v.Path)
+	if err != nil {
+		return err
+	}
+	current, err := valueAt(data, tokens)
+	if err != nil {
+		return err
+	}
+	array, ok := current.([]interface{})
+	if !ok {
+		return fmt.Errorf("value at path %s is not an array", v.Path)
+	}
+	value, err := decodedValue(v.Value)
+	if err != nil {
+		return err
+	}
+	for _, element := range array {
+		if equalValues(element, value) {
+			return nil
+		}
+	}
+
+	var index int
+	switch v.Order {
+	case "", orderEnd:
+		index = len(array)
+	case orderStart:
+		index = 0
+	case orderSorted:
+		index = len(array)
+		for i, element := range array {
+			order, err := compareValues(value, element)
+			if err != nil {
+				return fmt.Errorf("cannot keep the array at path %s sorted: %w", v.Path, err)
+			}
+			if order < 0 {
+				index = i
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("invalid order %q, expected %s, %s, or %s", v.Order, orderEnd, orderStart, orderSorted)
+	}
+
+	added := make([]interface{}, 0, len(array)+1)
+	added = append(added, array[:index]...)
+	added = append(added, value)
+	added = append(added, array[index:]...)
+	return updateDocument(data, tokens, func(container interface{}, token string) (interface{}, error) {
+		return replaceValue(container, token, added)
+	})
+}
+
+// compareValues compares two numbers or two strings. Values of any other types cannot be
+// compared.
+func compareValues(a interface{}, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %v with %v", a, b)
+}
+
+// decodedValue returns the plain value a JSONValue holds, as json.Unmarshal would decode it.
+func decodedValue(value jsondata.JSONValue) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// numberVisitor returns the number a JSON value holds, and an error for any other value.
+type numberVisitor struct{}
+
+func (numberVisitor) Map(map[string]jsondata.JSONValue) (float64, error) {
+	return 0, fmt.Errorf("expected a number but found an object")
+}
+
+func (numberVisitor) Slice([]jsondata.JSONValue) (float64, error) {
+	return 0, fmt.Errorf("expected a number but found an array")
+}
+
+func (numberVisitor) Bool(bool) (float64, error) {
+	return 0, fmt.Errorf("expected a number but found a boolean")
+}
+
+func (numberVisitor) Float64(number float64) (float64, error) {
+	return number, nil
+}
+
+func (numberVisitor) String(string) (float64, error) {
+	return 0, fmt.Errorf("expected a number but found a string")
+}
+
+func (numberVisitor) Null() (float64, error) {
+	return 0, fmt.Errorf("expected a number but found null")
+}
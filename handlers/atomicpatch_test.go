@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestAtomicPatchVisitors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		expected string // "" if the operation should fail
+	}{
+		{"increment", `{"views":2}`, `{"op":"Increment","path":"/views","value":3}`, `{"views":5}`},
+		{"decrement", `{"stock":2}`, `{"op":"Increment","path":"/stock","value":-2,"min":0}`, `{"stock":0}`},
+		{"increment missing member", `{}`, `{"op":"Increment","path":"/views","value":1}`, `{"views":1}`},
+		{"increment array element", `{"a":[1,2]}`, `{"op":"Increment","path":"/a/1","value":0.5}`, `{"a":[1,2.5]}`},
+		{"increment below min", `{"stock":1}`, `{"op":"Increment","path":"/stock","value":-2,"min":0}`, ""},
+		{"increment above max", `{"seats":9}`, `{"op":"Increment","path":"/seats","value":2,"max":10}`, ""},
+		{"increment not a number", `{"views":"2"}`, `{"op":"Increment","path":"/views","value":1}`, ""},
+		{"increment by a string", `{"views":2}`, `{"op":"Increment","path":"/views","value":"1"}`, ""},
+		{"increment missing parent", `{}`, `{"op":"Increment","path":"/a/views","value":1}`, ""},
+		{"compare and set", `{"status":"open"}`, `{"op":"CompareAndSet","path":"/status","expected":"open","value":"closed"}`, `{"status":"closed"}`},
+		{"compare and set object", `{"a":{"b":[1]}}`, `{"op":"CompareAndSet","path":"/a","expected":{"b":[1]},"value":null}`, `{"a":null}`},
+		{"compare and set null", `{"owner":null}`, `{"op":"CompareAndSet","path":"/owner","value":"bob"}`, `{"owner":"bob"}`},
+		{"compare and set mismatch", `{"status":"closed"}`, `{"op":"CompareAndSet","path":"/status","expected":"open","value":"closed"}`, ""},
+		{"compare and set missing", `{}`, `{"op":"CompareAndSet","path":"/status","value":"open"}`, ""},
+		{"add unique", `{"tags":["a"]}`, `{"op":"ArrayAddUnique","path":"/tags","value":"b"}`, `{"tags":["a","b"]}`},
+		{"add unique existing", `{"tags":["a","b"]}`, `{"op":"ArrayAddUnique","path":"/tags","value":"a"}`, `{"tags":["a","b"]}`},
+		{"add unique existing object", `{"a":[{"b":1}]}`, `{"op":"ArrayAddUnique","path":"/a","value":{"b":1}}`, `{"a":[{"b":1}]}`},
+		{"add unique at start", `{"tags":["a"]}`, `{"op":"ArrayAddUnique","path":"/tags","value":"b","order":"start"}`, `{"tags":["b","a"]}`},
+		{"add unique sorted", `{"a":[1,3,5]}`, `{"op":"ArrayAddUnique","path":"/a","value":4,"order":"sorted"}`, `{"a":[1,3,4,5]}`},
+		{"add unique sorted last", `{"a":["x","y"]}`, `{"op":"ArrayAddUnique","path":"/a","value":"z","order":"sorted"}`, `{"a":["x","y","z"]}`},
+		{"add unique sorted mixed", `{"a":[1,"x"]}`, `{"op":"ArrayAddUnique","path":"/a","value":2,"order":"sorted"}`, ""},
+		{"add unique unknown order", `{"a":[]}`, `{"op":"ArrayAddUnique","path":"/a","value":2,"order":"middle"}`, ""},
+		{"add unique not an array", `{"a":{}}`, `{"op":"ArrayAddUnique","path":"/a","value":2}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch PatchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("Invalid test patch: %v", err)
+			}
+			var visitor Visitor
+			switch patch.Op {
+			case "Increment":
+				visitor = &IncrementVisitor{Path: patch.Path, By: patch.Value, Min: patch.Min, Max: patch.Max}
+			case "CompareAndSet":
+				visitor = &CompareAndSetVisitor{Path: patch.Path, Expected: patch.Expected, Value: patch.Value}
+			case "ArrayAddUnique":
+				visitor = &ArrayAddUniqueVisitor{Path: patch.Path, Value: patch.Value, Order: patch.Order}
+			}
+			result, err := patchDocument([]byte(tt.document), visitor)
+			if tt.expected == "" {
+				if err == nil {
+					t.Fatalf("Expected the operation to fail but received %s", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Operation failed: %v", err)
+			}
+			if !sameJSON(t, string(result), tt.expected) {
+				t.Fatalf("Expected %s but received %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestConcurrentIncrement(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22,"views":0,"tags":[]}`)
+
+	const patches = 50
+	var wg sync.WaitGroup
+	for i := 0; i < patches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doRequest(databaseList, http.MethodPatch, "/v1/db1/doc1", `[{"op":"Increment","path":"/views","value":1}]`)
+			body := fmt.Sprintf(`[{"op":"ArrayAddUnique","path":"/tags","value":%d,"order":"sorted"}]`, i%5)
+			doRequest(databaseList, http.MethodPatch, "/v1/db1/doc1", body)
+		}(i)
+	}
+	wg.Wait()
+
+	document := doRequest(databaseList, http.MethodGet, "/v1/db1/doc1", "").Body.String()
+	if !strings.Contains(document, `"views":50`) || !strings.Contains(document, `"tags":[0,1,2,3,4]`) {
+		t.Fatalf("Expected 50 views and 5 sorted tags: %s", document)
+	}
+
+	// A decrement below the minimum leaves the document unchanged
+	response := doRequest(databaseList, http.MethodPatch, "/v1/db1/doc1", `[{"op":"Increment","path":"/views","value":-51,"min":0}]`)
+	var patchResponse PatchResponse
+	if err := json.Unmarshal(response.Body.Bytes(), &patchResponse); err != nil || !patchResponse.PatchFailed {
+		t.Fatalf("Expected the patch to fail: %s", response.Body.String())
+	}
+	document = doRequest(databaseList, http.MethodGet, "/v1/db1/doc1", "").Body.String()
+	if !strings.Contains(document, `"views":50`) {
+		t.Fatalf("Expected the views to stay at 50: %s", document)
+	}
+}
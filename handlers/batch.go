@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The path that batch requests are sent to.
+const batchPath = "/v1/$batch"
+
+// Number of operations of a batch that run at the same time unless WithBatchLimit is used.
+const DefaultBatchLimit = 8
+
+// Largest number of operations a single batch may hold.
+const maxBatchOperations = 1000
+
+// This struct represents one operation inside a batch request. Method and Path are those
+// of a request to the /v1/ API, where the /v1 prefix of the path may be left out, and
+// Body is the request body, if any. Headers are added to the request, so an operation
+// can for example carry If-Match.
+type BatchOperation struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// BatchResult holds the response to one operation of a batch. Body is the JSON the
+// handler responded with, or the response as a JSON string if it was not JSON. Headers
+// holds the response headers that describe the result, such as ETag and Location.
+type BatchResult struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response headers copied into the result of each operation of a batch.
+var batchResultHeaders = []string{"ETag", "Location", nextCursorHeader}
+
+// WithBatchLimit returns a copy of the database list that runs at most limit operations
+// of a batch request at the same time. A limit below 1 uses DefaultBatchLimit.
+func (databaseList DatabaseList) WithBatchLimit(limit int) DatabaseList {
+	databaseList.batchLimit = limit
+	return databaseList
+}
+
+// batchRecorder is the response writer that each operation of a batch writes its
+// response to.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *batchRecorder) Header() http.Header {
+	return recorder.header
+}
+
+func (recorder *batchRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.body.Write(b)
+}
+
+func (recorder *batchRecorder) WriteHeader(status int) {
+	// Like a real response, only the first status counts
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+}
+
+// BatchHandler handles POST requests to /v1/$batch. The request body holds an array of
+// operations, each of which is sent through V1Handler like a request of its own, as the
+// user who sent the batch. The response holds an array with the status, headers, and body
+// of every operation, in the order of the operations. The operations are not atomic: each
+// one succeeds or fails on its own, and up to the batch limit of them run at the same time,
+// so operations that depend on each other should be sent in separate batches, or in a
+// transaction.
+func (databaseList DatabaseList) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var operations []BatchOperation
+	if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid batch request body")
+		return
+	}
+	if len(operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Batch has no operations")
+		return
+	}
+	if len(operations) > maxBatchOperations {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Batch has more than %d operations", maxBatchOperations))
+		return
+	}
+
+	limit := databaseList.batchLimit
+	if limit < 1 {
+		limit = DefaultBatchLimit
+	}
+	results := make([]BatchResult, len(operations))
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, operation := range operations {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = databaseList.runBatchOperation(r, operation)
+		}()
+	}
+	wg.Wait()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// runBatchOperation sends one operation of a batch through V1Handler and returns its
+// result. The operation's request carries the context of the batch request, so it runs
+// as the same user and stops if the batch is cancelled.
+func (databaseList DatabaseList) runBatchOperation(r *http.Request, operation BatchOperation) BatchResult {
+	path := operation.Path
+	if !strings.HasPrefix(path, "/v1/") {
+		path = "/v1/" + strings.TrimPrefix(path, "/")
+	}
+	method := strings.ToUpper(operation.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), method, path, bytes.NewReader(operation.Body))
+	if err != nil {
+		return batchFailure(http.StatusBadRequest, fmt.Sprintf("Invalid operation: %v", err))
+	}
+	// Batches cannot be nested, and streaming responses never end
+	if strings.TrimSuffix(request.URL.Path, "/") == batchPath {
+		return batchFailure(http.StatusBadRequest, "Batches cannot contain batches")
+	}
+	if strings.EqualFold(request.URL.Query().Get("mode"), "subscribe") {
+		return batchFailure(http.StatusBadRequest, "Batches cannot contain subscriptions")
+	}
+	for name, value := range operation.Headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+	recorder := &batchRecorder{header: http.Header{}}
+	databaseList.V1Handler(recorder, request)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	result := BatchResult{Status: recorder.status}
+	for _, name := range batchResultHeaders {
+		if value := recorder.header.Get(name); value != "" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = value
+		}
+	}
+	body := bytes.TrimSpace(recorder.body.Bytes())
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		result.Body = body
+	default:
+		result.Body, _ = json.Marshal(string(body))
+	}
+	return result
+}
+
+// batchFailure returns the result of a batch operation that could not be run.
+func batchFailure(status int, message string) BatchResult {
+	body, _ := json.Marshal(message)
+	return BatchResult{Status: status, Body: body}
+}
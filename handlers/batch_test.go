@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestBatchHandler(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil).WithBatchLimit(2)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+
+	body := `[
+		{"method":"GET","path":"/v1/db1/doc1"},
+		{"method":"PUT","path":"/db1/doc2","body":{"name":"april","age":21}},
+		{"method":"PUT","path":"db1/doc3","body":{"name":"may"}},
+		{"method":"DELETE","path":"/v1/db1/missing"},
+		{"method":"PUT","path":"/v1/db1/doc1","body":{"name":"julia","age":23},"headers":{"If-Match":"\"999\""}},
+		{"method":"POST","path":"/v1/$batch","body":[]},
+		{"method":"GET","path":"/v1/db1/doc1?mode=subscribe"}
+	]`
+	w := doRequest(databaseList, http.MethodPost, "/v1/$batch", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but received %d: %s", w.Code, w.Body.String())
+	}
+	var results []BatchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Could not decode response: %s", w.Body.String())
+	}
+
+	expected := []int{
+		http.StatusOK,
+		http.StatusCreated,
+		http.StatusBadRequest,
+		http.StatusNotFound,
+		http.StatusPreconditionFailed,
+		http.StatusBadRequest,
+		http.StatusBadRequest,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results but received %d", len(expected), len(results))
+	}
+	for i, status := range expected {
+		if results[i].Status != status {
+			t.Fatalf("Expected status %d for operation %d but received %d: %s", status, i, results[i].Status, results[i].Body)
+		}
+	}
+	if !strings.Contains(string(results[0].Body), `"julia"`) || results[0].Headers["ETag"] == "" {
+		t.Fatalf("Expected the GET result to hold the document and its ETag: %+v", results[0])
+	}
+	if w := doRequest(databaseList, http.MethodGet, "/v1/db1/doc2", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the batch to create doc2 but received %d", w.Code)
+	}
+
+	// Many operations finish even though only a few run at once
+	operations := []BatchOperation{}
+	for i := 0; i < 50; i++ {
+		operations = append(operations, BatchOperation{
+			Method: http.MethodPut,
+			Path:   "/v1/db1/many" + strconv.Itoa(i),
+			Body:   json.RawMessage(`{"name":"many","age":1}`),
+		})
+	}
+	manyBody, _ := json.Marshal(operations)
+	w = doRequest(databaseList, http.MethodPost, "/v1/$batch/", string(manyBody))
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || len(results) != 50 {
+		t.Fatalf("Expected 50 results: %s", w.Body.String())
+	}
+	for i, result := range results {
+		if result.Status != http.StatusCreated {
+			t.Fatalf("Expected operation %d to create its document but received %d", i, result.Status)
+		}
+	}
+
+	invalid := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"not an array", http.MethodPost, `{"method":"GET"}`, http.StatusBadRequest},
+		{"empty", http.MethodPost, `[]`, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doRequest(databaseList, tt.method, "/v1/$batch", tt.body); w.Code != tt.status {
+				t.Fatalf("Expected status %d but received %d", tt.status, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+)
+
+// Value of the mode parameter of POST requests that import documents in bulk.
+const bulkMode = "bulk"
+
+// Value of the format parameter of GET requests that export documents as JSON Lines.
+const jsonLinesFormat = "jsonl"
+
+// Content type of JSON Lines request and response bodies.
+const jsonLinesContentType = "application/jsonl"
+
+// This struct represents one line of a bulk import or export. Name is the name of the
+// document, which is generated like for POST requests if an imported line leaves it out,
+// and Doc holds its contents. Imported lines may set Mode to nooverwrite to leave existing
+// documents alone. Exported lines also carry the document's metadata in Meta, which is
+// ignored on import, so an export can be imported again as it is.
+type BulkLine struct {
+	Name string             `json:"name,omitempty"`
+	Doc  json.RawMessage    `json:"doc"`
+	Mode string             `json:"mode,omitempty"`
+	Meta *contents.Metadata `json:"meta,omitempty"`
+}
+
+// BulkLineResult reports what happened to one line of a bulk import. Line counts from 1.
+// Status is the status code a PUT of the line's document would have returned, and either
+// URI or Message is set depending on whether it succeeded.
+type BulkLineResult struct {
+	Line    int    `json:"line"`
+	Status  int    `json:"status"`
+	URI     string `json:"uri,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkImportResponse is the response to a bulk import. It counts the lines that were
+// imported and the lines that failed, and holds the result of every line in order.
+type BulkImportResponse struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Results  []BulkLineResult `json:"results"`
+}
+
+// BulkImportHandler handles POST requests with mode=bulk on a database or collection path.
+// The request body holds one JSON object per line, each with the name and contents of a
+// document to put into the database or collection. Blank lines are skipped. Every line is
+// imported on its own like a PUT of the document would be: its contents are checked
+// against the schema, the ownership rule applies, and subscribers are notified. A line
+// that fails does not stop the lines after it, and the response reports the result of
+// each line.
+func (databaseList DatabaseList) BulkImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 0 {
+		respondWithError(w, http.StatusBadRequest, "Documents can only be imported into databases and collections")
+		return
+	}
+	documentList, found := databaseList.findDocumentList(pathList)
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+		return
+	}
+	username, _ := auth.UsernameFromContext(r.Context())
+	owner := databaseList.requiredOwner(username, pathList, false)
+	schema := databaseList.schemaFor(pathList)
+
+	response := BulkImportResponse{Results: []BulkLineResult{}}
+	reader := bufio.NewReader(r.Body)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read line %d", number))
+			return
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			result := databaseList.importLine(path, documentList, line, username, owner, schema)
+			result.Line = number
+			if result.Message == "" {
+				response.Imported++
+			} else {
+				response.Failed++
+			}
+			response.Results = append(response.Results, result)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// importLine puts the document on one line of a bulk import into the document list of
+// the database or collection at path, and returns the result of the line.
+func (databaseList DatabaseList) importLine(path string, documentList skiplist.DBIndex[string, contents.Document], line []byte, username string, owner string, schema Valid) BulkLineResult {
+	var bulkLine BulkLine
+	if err := json.Unmarshal(line, &bulkLine); err != nil {
+		return BulkLineResult{Status: http.StatusBadRequest, Message: "Line is not a JSON object"}
+	}
+	if bulkLine.Name == "" {
+		bulkLine.Name = generateDocName()
+	}
+	if strings.Contains(bulkLine.Name, "/") {
+		return BulkLineResult{Status: http.StatusBadRequest, Message: "Document name should not contain /"}
+	}
+	// Lines in nooverwrite mode only create documents that do not exist yet
+	precondition := contents.Precondition{Owner: owner}
+	switch bulkLine.Mode {
+	case "", "overwrite":
+	case "nooverwrite":
+		precondition.IfNoneMatch = "*"
+	default:
+		return BulkLineResult{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid mode: %v", bulkLine.Mode)}
+	}
+	var documentContent jsondata.JSONValue
+	if err := json.Unmarshal(bulkLine.Doc, &documentContent); err != nil {
+		return BulkLineResult{Status: http.StatusBadRequest, Message: "Invalid document contents"}
+	}
+	contentBytes, err := json.Marshal(documentContent)
+	if err != nil {
+		return BulkLineResult{Status: http.StatusBadRequest, Message: "Invalid document contents"}
+	}
+
+	documentPath := path + "/" + bulkLine.Name
+	unlock := databaseList.lockWrites(strings.Split(path, "/")[0])
+	defer unlock()
+	restore := databaseList.saveState(documentPath)
+	stored, err := contents.PutDocumentIf(documentList, bulkLine.Name, contentBytes, username, "overwrite", schema, precondition)
+	if errors.Is(err, contents.ErrNotOwner) {
+		return BulkLineResult{Status: http.StatusForbidden, Message: "Only the user who created this document may use it"}
+	}
+	if errors.Is(err, contents.ErrPreconditionFailed) {
+		return BulkLineResult{Status: http.StatusPreconditionFailed, Message: "Document exists and mode is nooverwrite"}
+	}
+	if err != nil {
+		return BulkLineResult{Status: http.StatusBadRequest, Message: "Document contents did not match provided JSON schema"}
+	}
+	if err := databaseList.journal(documentPath); err != nil {
+		restore()
+		return BulkLineResult{Status: http.StatusInternalServerError, Message: journalFailed}
+	}
+	event := sse.Update
+	if stored.Version == 1 {
+		event = sse.Create
+	}
+	databaseList.subscriberHandler.Publish(sse.Event{Type: event, Path: documentPath, Content: stored.Content, Owner: stored.Metadata.CreatedBy})
+
+	status := http.StatusOK
+	if stored.Version == 1 {
+		status = http.StatusCreated
+	}
+	return BulkLineResult{Status: status, URI: "/v1/" + documentPath}
+}
+
+// ExportHandler handles GET requests with format=jsonl on a database or collection path.
+// It writes the documents in the database or collection one per line, in the same form
+// BulkImportHandler reads, so an export can be imported elsewhere. The documents are
+// streamed from a snapshot as they are written, without holding the whole listing in
+// memory. Like listings, the export honors the interval parameter and leaves out the
+// documents the ownership rule hides from the user.
+func (databaseList DatabaseList) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 0 {
+		respondWithError(w, http.StatusBadRequest, "Only databases and collections can be exported")
+		return
+	}
+	var keys skiplist.Range[string]
+	if interval := r.URL.Query().Get("interval"); interval != "" {
+		var err error
+		keys, err = parseInterval(interval)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid interval: %v", err))
+			return
+		}
+	}
+	documentList, found := databaseList.findDocumentList(pathList)
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+		return
+	}
+	username, _ := auth.UsernameFromContext(r.Context())
+	keep := databaseList.readableFilter(username, pathList)
+
+	w.Header().Set("Content-Type", jsonLinesContentType)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	for name, doc := range documentList.Snapshot(r.Context(), keys.Start, keys.End) {
+		if !keys.Contains(name) || keep != nil && !keep(doc) {
+			continue
+		}
+		meta := doc.Metadata
+		if encoder.Encode(BulkLine{Name: name, Doc: doc.Content, Meta: &meta}) != nil {
+			// The client went away
+			return
+		}
+		// Flush now and then so the client sees the documents as they come
+		written++
+		if flusher != nil && written%100 == 0 {
+			flusher.Flush()
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
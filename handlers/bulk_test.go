@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestBulkImport(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+
+	body := strings.Join([]string{
+		`{"name":"doc1","doc":{"name":"julia","age":23}}`,
+		`{"name":"doc2","doc":{"name":"april","age":21}}`,
+		``,
+		`{"name":"doc3","doc":{"name":"may"}}`,
+		`not json`,
+		`{"name":"doc1","doc":{"name":"julia","age":24},"mode":"nooverwrite"}`,
+		`{"doc":{"name":"june","age":30}}`,
+		`{"name":"a/b","doc":{"name":"july","age":31}}`,
+	}, "\n")
+	w := doRequest(databaseList, http.MethodPost, "/v1/db1/?mode=bulk", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but received %d: %s", w.Code, w.Body.String())
+	}
+	var response BulkImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Could not decode response: %s", w.Body.String())
+	}
+	if response.Imported != 3 || response.Failed != 4 {
+		t.Fatalf("Expected 3 imported and 4 failed lines but received %+v", response)
+	}
+
+	expected := []BulkLineResult{
+		{Line: 1, Status: http.StatusOK, URI: "/v1/db1/doc1"},
+		{Line: 2, Status: http.StatusCreated, URI: "/v1/db1/doc2"},
+		{Line: 4, Status: http.StatusBadRequest},
+		{Line: 5, Status: http.StatusBadRequest},
+		{Line: 6, Status: http.StatusPreconditionFailed},
+		{Line: 7, Status: http.StatusCreated},
+		{Line: 8, Status: http.StatusBadRequest},
+	}
+	for i, want := range expected {
+		got := response.Results[i]
+		if got.Line != want.Line || got.Status != want.Status || (want.URI != "" && got.URI != want.URI) {
+			t.Fatalf("Expected result %+v but received %+v", want, got)
+		}
+	}
+
+	w = doRequest(databaseList, http.MethodGet, "/v1/db1/doc1", "")
+	if !strings.Contains(w.Body.String(), `"age":23`) {
+		t.Fatalf("Expected the first line to overwrite doc1: %s", w.Body.String())
+	}
+	if w := doRequest(databaseList, http.MethodPost, "/v1/missing/?mode=bulk", body); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing database but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodPost, "/v1/db1/doc1?mode=bulk", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a document path but received %d", w.Code)
+	}
+}
+
+func TestExport(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	source := New(&testSchema, nil)
+	doRequest(source, http.MethodPut, "/v1/db1", "")
+	doRequest(source, http.MethodPut, "/v1/db1/doc", `{"name":"doc","age":1}`)
+	doRequest(source, http.MethodPut, "/v1/db1/doc/col", "")
+	for _, name := range []string{"a", "b", "c"} {
+		doRequest(source, http.MethodPut, "/v1/db1/doc/col/"+name, `{"name":"`+name+`","age":20}`)
+	}
+
+	w := doRequest(source, http.MethodGet, "/v1/db1/doc/col/?format=jsonl", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != jsonLinesContentType {
+		t.Fatalf("Expected a JSON Lines response but received %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	names := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var line BulkLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Meta == nil {
+			t.Fatalf("Unexpected export line: %s", scanner.Text())
+		}
+		names = append(names, line.Name)
+	}
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Fatalf("Expected a, b, and c to be exported but received %v", names)
+	}
+
+	// An export can be imported again as it is
+	target := New(&testSchema, nil)
+	doRequest(target, http.MethodPut, "/v1/db2", "")
+	w = doRequest(target, http.MethodPost, "/v1/db2/?mode=bulk", w.Body.String())
+	var response BulkImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Imported != 3 {
+		t.Fatalf("Expected the export to import: %s", w.Body.String())
+	}
+	if w := doRequest(target, http.MethodGet, "/v1/db2/b", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the imported document to exist but received %d", w.Code)
+	}
+
+	w = doRequest(source, http.MethodGet, "/v1/db1/doc/col/?format=jsonl&interval=(a,]", "")
+	if strings.Count(w.Body.String(), "\n") != 2 {
+		t.Fatalf("Expected the interval to leave out a: %s", w.Body.String())
+	}
+	if w := doRequest(source, http.MethodGet, "/v1/db1/missing/col/?format=jsonl", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing collection but received %d", w.Code)
+	}
+}
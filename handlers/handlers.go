@@ -5,32 +5,56 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/persist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
 )
 
 // This struct holds all of the databases. It holds a skiplist,
 // where each item in the skiplist represents an individual database,
 // and a schema field which holds the valid schema that will be used
-// to validate documents in the respective database.
+// to validate documents in the respective database. The store field
+// is only set when the server was started with durable storage, and the policy
+// field is only set when access to the databases is restricted.
 type DatabaseList struct {
 	databaseList      skiplist.DBIndex[string, database.Database]
 	schema            Valid
 	subscriberHandler *sse.SubscriberHandler
+	store             *persist.Store
+	writes            *writeCounter
+	locks             *databaseLocks // taken by every read and write, see lockWrites
+	webSockets        *wsSessions    // open /ws connections, see CloseWebSockets
+	policy            *auth.Policy
+	batchLimit        int // operations of a batch run at the same time, see WithBatchLimit
+}
+
+// This struct counts the writes that have started and finished on a database list.
+// Like the count field of a skiplist, it lets readers that walk the whole tree tell
+// whether a write happened while they were walking it.
+type writeCounter struct {
+	started  atomic.Int64
+	finished atomic.Int64
 }
 
 // This struct holds the informatio for a document response. It contains
@@ -42,11 +66,16 @@ type DocumentResponse struct {
 }
 
 // This struct represents an operation for the PATCH request. It holds the operation for the request,
-// the path for the request, and the JSON data being used for the request.
+// the path for the request, the JSON data being used for the request, and the options of the
+// Increment, CompareAndSet, and ArrayAddUnique operations.
 type PatchOperation struct {
-	Op    string             `json:"op"`
-	Path  string             `json:"path"`
-	Value jsondata.JSONValue `json:"value"`
+	Op       string             `json:"op"`
+	Path     string             `json:"path"`
+	Value    jsondata.JSONValue `json:"value"`
+	Expected jsondata.JSONValue `json:"expected"`        // value CompareAndSet expects to find
+	Min      *float64           `json:"min,omitempty"`   // lowest result Increment may leave
+	Max      *float64           `json:"max,omitempty"`   // highest result Increment may leave
+	Order    string             `json:"order,omitempty"` // where ArrayAddUnique adds the value
 }
 
 // PatchResponse struct enforces a fixed order for the JSON response
@@ -62,12 +91,234 @@ type PatchResponse struct {
 func New(schema Valid, subscriberHandler *sse.SubscriberHandler) DatabaseList {
 
 	return DatabaseList{
-		databaseList:      skiplist.NewSkipList[string, database.Database](),
+		databaseList:      storage.New[string, database.Database](),
 		schema:            schema,
 		subscriberHandler: subscriberHandler,
+		writes:            &writeCounter{},
+		locks:             &databaseLocks{databases: map[string]*databaseLock{}},
+		webSockets:        &wsSessions{active: map[*wsSession]struct{}{}},
+	}
+}
+
+// NewDurable initializes a database list that is backed by the given store. It
+// rebuilds every database, document, and collection from the store's snapshot and
+// write-ahead log, and every change applied afterwards is appended to the log.
+func NewDurable(schema Valid, subscriberHandler *sse.SubscriberHandler, store *persist.Store) (DatabaseList, error) {
+	databaseList := New(schema, subscriberHandler)
+	if err := store.Recover(databaseList.databaseList); err != nil {
+		return databaseList, fmt.Errorf("failed to recover databases: %w", err)
+	}
+	databaseList.store = store
+	return databaseList, nil
+}
+
+// Snapshot writes the whole database tree to the store and truncates its write-ahead
+// log. It does nothing if the database list is not backed by a store. No write is
+// applied while the snapshot is taken.
+func (databaseList DatabaseList) Snapshot(ctx context.Context) error {
+	if databaseList.store == nil {
+		return nil
+	}
+	unlock := databaseList.lockTree()
+	defer unlock()
+	return databaseList.store.Snapshot(ctx, databaseList.databaseList)
+}
+
+// This struct holds the locks that order the requests to each database. Writes to a
+// database hold its lock exclusively and reads share it, so no reader sees part of a
+// transaction, while requests to different databases never wait for each other. Every
+// write also shares the tree lock, which snapshots and restores of the whole tree hold
+// exclusively.
+type databaseLocks struct {
+	tree      sync.RWMutex
+	mu        sync.Mutex // guards databases
+	databases map[string]*databaseLock
+}
+
+// This struct is the lock of one database. It counts the requests that hold it or wait
+// for it, and is dropped once there are none, so deleted databases leave nothing behind.
+type databaseLock struct {
+	sync.RWMutex
+	users int
+}
+
+// acquire returns the lock of the named database and counts the caller as one of its users.
+func (locks *databaseLocks) acquire(name string) *databaseLock {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	lock, found := locks.databases[name]
+	if !found {
+		lock = &databaseLock{}
+		locks.databases[name] = lock
+	}
+	lock.users++
+	return lock
+}
+
+// release stops counting the caller as a user of the lock of the named database.
+func (locks *databaseLocks) release(name string, lock *databaseLock) {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	lock.users--
+	if lock.users == 0 {
+		delete(locks.databases, name)
 	}
 }
 
+// lockWrites blocks other requests to the named database, and snapshots of the whole
+// tree, while a change is applied, so that changes to a path reach the write-ahead log in
+// the same order they reach the database tree, and nothing else is read or written in the
+// middle of a transaction. It also counts the write as in progress until the returned
+// function, which releases the locks, is called.
+func (databaseList DatabaseList) lockWrites(databaseName string) func() {
+	unlockDatabase := func() {}
+	if databaseList.locks != nil {
+		databaseList.locks.tree.RLock()
+		lock := databaseList.locks.acquire(databaseName)
+		lock.Lock()
+		unlockDatabase = func() {
+			lock.Unlock()
+			databaseList.locks.release(databaseName, lock)
+			databaseList.locks.tree.RUnlock()
+		}
+	}
+	if databaseList.writes != nil {
+		databaseList.writes.started.Add(1)
+	}
+	return func() {
+		if databaseList.writes != nil {
+			databaseList.writes.finished.Add(1)
+		}
+		unlockDatabase()
+	}
+}
+
+// lockReads waits for the write in progress on the named database, if there is one, and
+// blocks new writes to it until the returned function is called. Any number of reads may
+// hold the lock at the same time.
+func (databaseList DatabaseList) lockReads(databaseName string) func() {
+	if databaseList.locks == nil {
+		return func() {}
+	}
+	lock := databaseList.locks.acquire(databaseName)
+	lock.RLock()
+	return func() {
+		lock.RUnlock()
+		databaseList.locks.release(databaseName, lock)
+	}
+}
+
+// lockTree waits for every write in progress and blocks new ones until the returned
+// function is called. It is used by changes to the whole tree, such as restores and
+// snapshots.
+func (databaseList DatabaseList) lockTree() func() {
+	if databaseList.locks == nil {
+		return func() {}
+	}
+	databaseList.locks.tree.Lock()
+	if databaseList.writes != nil {
+		databaseList.writes.started.Add(1)
+	}
+	return func() {
+		if databaseList.writes != nil {
+			databaseList.writes.finished.Add(1)
+		}
+		databaseList.locks.tree.Unlock()
+	}
+}
+
+// journal appends the current state of the database, document, or collection at the
+// given path to the write-ahead log. If nothing exists at the path anymore, a delete
+// is recorded instead. The caller must hold the lock from lockWrites or lockTree.
+//
+// journal returns an error if the change could not be recorded, in which case the
+// caller must undo the change, see saveState, and not report it as successful.
+func (databaseList DatabaseList) journal(path string) error {
+	if databaseList.store == nil {
+		return nil
+	}
+	return databaseList.appendRecords(databaseList.record(persist.OpPut, path))
+}
+
+// journalPatch works like journal, but records that the document at the given path was
+// patched, so that replaying the record keeps the collections nested inside the document.
+func (databaseList DatabaseList) journalPatch(path string) error {
+	if databaseList.store == nil {
+		return nil
+	}
+	return databaseList.appendRecords(databaseList.record(persist.OpPatch, path))
+}
+
+// journalDelete records that the node at the given path is deleted. Unlike journal, it
+// is called before the change is applied, since the record does not depend on it, so a
+// delete that cannot be recorded is never applied.
+func (databaseList DatabaseList) journalDelete(path string) error {
+	return databaseList.appendRecords(persist.Record{Op: persist.OpDelete, Path: path})
+}
+
+// record returns a record with the given operation and the current state of the node at
+// path, or a delete if nothing exists at the path.
+func (databaseList DatabaseList) record(op string, path string) persist.Record {
+	record := persist.Record{Op: persist.OpDelete, Path: path}
+	if node, found := persist.Lookup(databaseList.databaseList, path); found {
+		record.Op = op
+		record.Node = &node
+	}
+	return record
+}
+
+// appendRecords appends the records to the write-ahead log, either all of them or none.
+// It does nothing if the database list is not backed by a store.
+func (databaseList DatabaseList) appendRecords(records ...persist.Record) error {
+	if databaseList.store == nil {
+		return nil
+	}
+	if err := databaseList.store.Append(records...); err != nil {
+		slog.Error("failed to append to write-ahead log", "path", records[0].Path, "error", err)
+		return fmt.Errorf("failed to record %s in the write-ahead log: %w", records[0].Path, err)
+	}
+	return nil
+}
+
+// saveState returns a function that puts the database, document, or collection at the
+// given path back the way it is now, or removes it if nothing is there yet. Writes call it
+// before applying a change, so that the change can be undone if it cannot be recorded in
+// the write-ahead log. The caller must hold the lock from lockWrites.
+func (databaseList DatabaseList) saveState(path string) func() {
+	pathList := strings.Split(path, "/")
+	switch {
+	case len(pathList) == 1:
+		return saveEntry(databaseList.databaseList, pathList[0])
+	case len(pathList)%2 == 0:
+		if documentList, found := databaseList.findDocumentList(pathList[:len(pathList)-1]); found {
+			return saveEntry(documentList, pathList[len(pathList)-1])
+		}
+	default:
+		if collectionList, found := databaseList.findCollectionList(pathList); found {
+			return saveEntry(collectionList, pathList[len(pathList)-1])
+		}
+	}
+	return func() {}
+}
+
+// saveEntry returns a function that puts the named entry of the list back the way it is now.
+func saveEntry[V any](list skiplist.DBIndex[string, V], name string) func() {
+	previous, existed := list.Find(name)
+	return func() {
+		if !existed {
+			list.Remove(name)
+			return
+		}
+		list.Upsert(name, func(key string, currValue V, exists bool) (V, error) {
+			return previous, nil
+		})
+	}
+}
+
+// journalFailed is the message of the response to a write that could not be recorded in
+// the write-ahead log.
+const journalFailed = "Failed to record the change durably"
+
 // type SSE interface {
 // 	SSEHandler(w http.ResponseWriter, r *http.Request)
 // }
@@ -86,13 +337,74 @@ func (databaseList DatabaseList) ServeHTTP(w http.ResponseWriter, r *http.Reques
 
 // V1Handler directs incoming HTTP requests to the correct handler method. It supports
 // OPTIONS, GET, PUT, POST, DELETE, and PATCH.
-// The function sets the CORS headers and logs the request details.
+// The function sets the CORS headers and logs the request details. If access is
+// restricted by a policy, requests the user has no role for are refused with 403.
 func (databaseList DatabaseList) V1Handler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Allow", "OPTIONS, GET, PUT, POST, DELETE, PATCH")
 	w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, PUT, POST, DELETE, PATCH")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	fmt.Println("Received request:", r.Method, r.URL.Path)
+	slog.Info("Received request", "method", r.Method, "path", r.URL.Path)
+
+	// Batches are made of requests of their own, which are checked one at a time
+	if strings.TrimSuffix(r.URL.Path, "/") == batchPath && r.Method != http.MethodOptions {
+		databaseList.BatchHandler(w, r)
+		return
+	}
+
+	// Subscription stats only include resources the user is an admin of
+	if strings.TrimSuffix(r.URL.Path, "/") == subscriptionsPath && r.Method != http.MethodOptions {
+		databaseList.SubscriptionStatsHandler(w, r)
+		return
+	}
+
+	// Check that the user may send this request to this path
+	if r.Method != http.MethodOptions {
+		pathList := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/")
+		if !databaseList.authorize(w, r, pathList, requiredRole(r, pathList)) {
+			return
+		}
+	}
+
+	// Requests that manage the indexes of a database or collection
+	if r.URL.Query().Has("index") && r.Method != http.MethodOptions {
+		databaseList.IndexHandler(w, r)
+		return
+	}
+
+	// Requests that manage the schema of a database or collection
+	if r.URL.Query().Has("schema") && r.Method != http.MethodOptions {
+		databaseList.SchemaHandler(w, r)
+		return
+	}
+
+	// Requests that manage the ownership rule of a database or collection
+	if r.URL.Query().Has("ownership") && r.Method != http.MethodOptions {
+		databaseList.OwnershipHandler(w, r)
+		return
+	}
+
+	// Requests that restore an old revision of a document
+	if r.Method == http.MethodPost && r.URL.Query().Has("restore") {
+		databaseList.RestoreRevisionHandler(w, r)
+		return
+	}
+
+	// Requests that import or export many documents at once as JSON Lines
+	if r.Method == http.MethodPost && r.URL.Query().Get("mode") == bulkMode {
+		databaseList.BulkImportHandler(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Query().Get("format") == jsonLinesFormat {
+		databaseList.ExportHandler(w, r)
+		return
+	}
+
+	// Requests that apply several operations in one transaction
+	if r.Method == http.MethodPost && strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/"+transactionPath) {
+		databaseList.TransactionHandler(w, r)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodOptions:
@@ -123,6 +435,14 @@ func respondWithError(w http.ResponseWriter, statusCode int, message string) {
 	w.Write(errJson)
 }
 
+// preconditionFromRequest returns the If-Match and If-None-Match headers of a request.
+func preconditionFromRequest(r *http.Request) contents.Precondition {
+	return contents.Precondition{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+}
+
 // Helper function to create a DocumentResponse and append it to the response slice
 func addDocumentResponse(path string, document contents.Document, documentResponses *[]DocumentResponse) {
 	// Unmarshal document content from []byte
@@ -145,7 +465,16 @@ func addDocumentResponse(path string, document contents.Document, documentRespon
 // path to the document or database passed through the command line can be arbitrarily
 // long including either databases, documents, or collections. GetHandler can either query
 // everything inside a given database/document, or it can only retrieve a database's or document's
-// contents within a given range.
+// contents within a given range. When a filter is given, only the documents of a database or
+// collection whose contents match the filter are returned, using an index on the database
+// or collection when one covers the filter. A single document is returned with its version
+// as an ETag, and the If-Match and If-None-Match headers are honored. The history, revision, and
+// asOf parameters return older revisions of a single document instead. When the ownership rule
+// restricts reads, users only see the documents they created, unless they are admins.
+// Listings of a database or collection can be split into pages with the limit parameter. When
+// more documents follow a page, its response carries an X-Next-Cursor header, whose value is
+// passed as the cursor parameter to get the next page. The order parameter set to "desc"
+// reverses listings, and orderBy lists documents by a metadata field instead of by name.
 func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Setting the headers
@@ -183,22 +512,38 @@ func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get the interval if there is one
-	interval := r.URL.Query().Get("interval")
-	low := ""
-	high := ""
-
-	// Store the interval parameter if it exists
-	if interval != "" {
-		// Trim square brackets from the interval string
-		trimmedInterval := strings.Trim(interval, "[]")
+	// Get the range of names to list if there is one
+	var keys skiplist.Range[string]
+	if interval := r.URL.Query().Get("interval"); interval != "" {
+		var err error
+		keys, err = parseInterval(interval)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid interval: %v", err))
+			return
+		}
+	}
 
-		// Split the interval string to separate low and high values
-		intervalParts := strings.Split(trimmedInterval, ",")
+	// Parse the filter if there is one
+	var filter query.Expr
+	if filterParam := r.URL.Query().Get("filter"); filterParam != "" {
+		var err error
+		filter, err = query.Parse(filterParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid filter: %v", err))
+			return
+		}
+	}
 
-		// Set the low/high values to whatever is passed in
-		low = strings.TrimSpace(intervalParts[0])
-		high = strings.TrimSpace(intervalParts[1])
+	// Read the page of the listing to return, if only part of it is wanted
+	pg, err := pageFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid page: %v", err))
+		return
+	}
+	ord, err := orderFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid order: %v", err))
+		return
 	}
 
 	// Extract Authorization header
@@ -223,23 +568,32 @@ func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Reque
 			http.Error(w, "resource missing", http.StatusBadRequest)
 			return
 		}
-		databaseList.subscriberHandler.SSEHandler(w, r, resource, token)
+		// Subscriptions only receive the events the interval and filter select, about
+		// documents the user may read
+		username, _ := auth.UsernameFromContext(r.Context())
+		readable := databaseList.readableEvents(username)
+		databaseList.subscriberHandler.FilteredSSEHandler(w, r, resource, token, sse.Filter{Keys: keys, Content: filter, Readable: readable})
+		return
 	} else {
 		//if not a subscribe get we set headers as a normal get request
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
 	}
+
+	// Writes to the database wait until the response is built, so it never holds part of a transaction
+	unlock := databaseList.lockReads(pathList[0])
+	defer unlock()
+
 	var databaseFound database.Database
 	var documentFound contents.Document
 	var collectionFound contents.Collection
-	var err error
 
 	// Find the databases, documents, or collections
 	for i, name := range pathList {
 		if i == 0 {
 			// First element will always be database
 			//I want to Print what the skiplist looks like at this point
-			databaseFound, err = database.GetDatabase(databaseList.databaseList, name, r.Context(), low, high)
+			databaseFound, err = database.GetDatabase(databaseList.databaseList, name, r.Context(), "", "")
 			if err != nil {
 				respondWithError(w, http.StatusNotFound, "Database does not exist")
 				return
@@ -252,7 +606,7 @@ func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Reque
 			}
 		} else if i%2 == 0 {
 			// Even elements after first element will be collections
-			collectionFound, err = contents.GetCollection(documentFound.Collections, name, r.Context(), low, high)
+			collectionFound, err = contents.GetCollection(documentFound.Collections, name, r.Context(), "", "")
 			if err != nil {
 				respondWithError(w, http.StatusNotFound, "Collection does not exist")
 				return
@@ -269,23 +623,56 @@ func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Reque
 
 	// If we've queried a full database or collection, we'll use the documents in `databaseFound.Documents` or `collectionFound.Documents`
 	documentResponses := []DocumentResponse{}
+	username, _ := auth.UsernameFromContext(r.Context())
 
 	// db doc col
 
 	if len(pathList) == 1 {
 		// We queried a database; collect all documents within the database (which has already been filtered by `start` and `end` in GetDatabase)
-		documents, _ := databaseFound.Documents.Query(r.Context(), "", "")
+		documents, next, err := databaseList.listDocuments(r.Context(), databaseFound.Documents, keys, filter, databaseList.readableFilter(username, pathList), pg, ord)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to query documents")
+			return
+		}
+		if next != "" {
+			w.Header().Set(nextCursorHeader, next)
+		}
 		for _, document := range documents {
 			addDocumentResponse(pathToReturn, document, &documentResponses)
 		}
 	} else if len(pathList)%2 == 1 {
 		// We queried a collection; collect all documents within the collection (already filtered)
-		documents, _ := collectionFound.Documents.Query(r.Context(), "", "")
+		documents, next, err := databaseList.listDocuments(r.Context(), collectionFound.Documents, keys, filter, databaseList.readableFilter(username, pathList), pg, ord)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to query documents")
+			return
+		}
+		if next != "" {
+			w.Header().Set(nextCursorHeader, next)
+		}
 		for _, document := range documents {
 			addDocumentResponse(pathToReturn, document, &documentResponses)
 		}
 	} else {
 		// We queried a specific document; handle it directly
+		if owner := databaseList.requiredOwner(username, pathList[:len(pathList)-1], true); owner != "" && !documentFound.OwnedBy(owner) {
+			respondNotOwner(w)
+			return
+		}
+		if wantsRevisions(r) {
+			respondWithRevisions(w, r, pathToReturn, documentFound)
+			return
+		}
+		w.Header().Set("ETag", contents.ETag(documentFound.Version))
+		if (contents.Precondition{IfMatch: r.Header.Get("If-Match")}).Check(documentFound, true) != nil {
+			respondWithError(w, http.StatusPreconditionFailed, "Precondition failed")
+			return
+		}
+		if (contents.Precondition{IfNoneMatch: r.Header.Get("If-None-Match")}).Check(documentFound, true) != nil {
+			// The client already has this version of the document
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 		addDocumentResponse(pathToReturn, documentFound, &documentResponses)
 	}
 
@@ -304,6 +691,11 @@ func (databaseList DatabaseList) GetHandler(w http.ResponseWriter, r *http.Reque
 // The path to the document or database passed through the command line can be arbitrarily
 // long including either databases, documents, or collection. For putting documents, the function calls a helper
 // that validates the data inside the document against the provided schema. The response contains the URI of the newly created item.
+// Databases and collections may be given a JSON schema in the request body, which documents inside them are
+// validated against. A document is only written if the If-Match and If-None-Match headers hold for the stored document, otherwise
+// the response is 412 Precondition Failed. The new version of a written document is returned as an ETag.
+// When the ownership rule of the enclosing database or collection restricts writes, an existing document
+// may only be overwritten by its creator or an admin, otherwise the response is 403.
 func (databaseList DatabaseList) PutHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
@@ -343,11 +735,24 @@ func (databaseList DatabaseList) PutHandler(w http.ResponseWriter, r *http.Reque
 		mode = "overwrite"
 	}
 
+	// Documents are only written if the request's preconditions hold
+	precondition := preconditionFromRequest(r)
+	if len(pathList)%2 == 0 {
+		requester, _ := auth.UsernameFromContext(r.Context())
+		precondition.Owner = databaseList.requiredOwner(requester, pathList[:len(pathList)-1], false)
+	}
+
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+	restore := databaseList.saveState(path)
+
 	var databaseFound database.Database
 	var documentFound contents.Document
 	var collectionFound contents.Collection
 	var err error
 	var documentExists bool
+	var storedDocument contents.Document // the document written, for filtered subscriptions
+	event := sse.Create                  // or sse.Update if an existing document was overwritten
 
 	// Find the databases, documents, or collections
 	for i, name := range pathList {
@@ -384,10 +789,20 @@ func (databaseList DatabaseList) PutHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	// Databases and collections may be created with a schema in the request body
+	var schema *jsondata.ValidSchema
+	if len(pathList)%2 == 1 {
+		schema, err = readSchema(r, path)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid schema: %v", err))
+			return
+		}
+	}
+
 	// Put the database, documents, or collections
 	if len(pathList) == 1 {
 		// We should have a database
-		_, err := database.PutDatabase(databaseList.databaseList, pathList[len(pathList)-1], databaseList.subscriberHandler, path)
+		_, err := database.PutDatabaseWithSchema(databaseList.databaseList, pathList[len(pathList)-1], schema, databaseList.subscriberHandler, path)
 		if err != nil {
 			http.Error(w, "unable to create database "+pathList[len(pathList)-1]+": exists", http.StatusBadRequest)
 			return
@@ -417,9 +832,23 @@ func (databaseList DatabaseList) PutHandler(w http.ResponseWriter, r *http.Reque
 		documentExists = err == nil
 
 		// Inserting the document into its respective document list and verifying that its contents match the provided JSON Schema
-		_, err = contents.PutDocument(databaseFound.Documents, pathList[len(pathList)-1], contentBytes, username, mode, databaseList.schema)
+		stored, err := contents.PutDocumentIf(databaseFound.Documents, pathList[len(pathList)-1], contentBytes, username, mode, databaseList.schemaFor(pathList), precondition)
+		if errors.Is(err, contents.ErrPreconditionFailed) {
+			respondWithError(w, http.StatusPreconditionFailed, "Precondition failed")
+			return
+		}
+		if errors.Is(err, contents.ErrNotOwner) {
+			respondNotOwner(w)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Document contents did not match provided JSON schema", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("ETag", contents.ETag(stored.Version))
+		storedDocument = stored
+		if stored.Version > 1 {
+			event = sse.Update
 		}
 	} else if len(pathList)%2 == 0 {
 		// We should have a document from an arbitrarily long path
@@ -442,21 +871,39 @@ func (databaseList DatabaseList) PutHandler(w http.ResponseWriter, r *http.Reque
 		_, err = contents.GetDocument(collectionFound.Documents, pathList[len(pathList)-1])
 		documentExists = err == nil
 
-		_, err = contents.PutDocument(collectionFound.Documents, pathList[len(pathList)-1], contentBytes, username, mode, databaseList.schema)
+		stored, err := contents.PutDocumentIf(collectionFound.Documents, pathList[len(pathList)-1], contentBytes, username, mode, databaseList.schemaFor(pathList), precondition)
+		if errors.Is(err, contents.ErrPreconditionFailed) {
+			respondWithError(w, http.StatusPreconditionFailed, "Precondition failed")
+			return
+		}
+		if errors.Is(err, contents.ErrNotOwner) {
+			respondNotOwner(w)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to put document", http.StatusBadRequest)
 			return
 		}
+		w.Header().Set("ETag", contents.ETag(stored.Version))
+		storedDocument = stored
+		if stored.Version > 1 {
+			event = sse.Update
+		}
 	} else {
 		// We should have a collection
-		_, err := contents.PutCollection(documentFound.Collections, pathList[len(pathList)-1])
+		_, err := contents.PutCollectionWithSchema(documentFound.Collections, pathList[len(pathList)-1], schema)
 		if err != nil {
 			http.Error(w, "unable to create collection "+pathList[len(pathList)-1]+": exists", http.StatusBadRequest)
 			return
 		}
 	}
 
-	databaseList.subscriberHandler.Notify(path, "update", fmt.Sprintf("{\"path\":\"%s\"}", path))
+	if err := databaseList.journal(path); err != nil {
+		restore()
+		respondWithError(w, http.StatusInternalServerError, journalFailed)
+		return
+	}
+	databaseList.subscriberHandler.Publish(sse.Event{Type: event, Path: path, Content: storedDocument.Content, Owner: storedDocument.Metadata.CreatedBy})
 
 	// Return the URI (path) of the document
 	if mode == "overwrite" || mode == "" {
@@ -579,13 +1026,26 @@ func (databaseList DatabaseList) PostHandler(w http.ResponseWriter, r *http.Requ
 	// Get username
 	username, _ := auth.UsernameFromContext(r.Context())
 
-	if len(pathList) == 1 {
-		// We have a database
-		contents.PutDocument(databaseFound.Documents, docName, doc, username, mode, databaseList.schema)
-	} else {
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+	restore := databaseList.saveState(path + "/" + docName)
+
+	documentList := databaseFound.Documents
+	if len(pathList) > 1 {
 		// We have a collection
-		contents.PutDocument(collectionFound.Documents, docName, doc, username, mode, databaseList.schema)
+		documentList = collectionFound.Documents
 	}
+	stored, err := contents.PutDocumentIf(documentList, docName, doc, username, mode, databaseList.schemaFor(pathList), contents.Precondition{})
+	if err != nil {
+		http.Error(w, "Document contents did not match provided JSON schema", http.StatusBadRequest)
+		return
+	}
+	if err := databaseList.journal(path + "/" + docName); err != nil {
+		restore()
+		respondWithError(w, http.StatusInternalServerError, journalFailed)
+		return
+	}
+	databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Create, Path: path + "/" + docName, Content: stored.Content, Owner: stored.Metadata.CreatedBy})
 
 	// Create the response
 	uriResponse, _ := json.MarshalIndent(map[string]string{
@@ -609,6 +1069,8 @@ func generateDocName() string {
 
 // DeleteHandler handles DELETE requests removing the specified database, document, or collection from
 // its respective list. The function returns a StatusNoContent status code upon successful completion.
+// If the ownership rule of the enclosing database or collection restricts writes, only the document's
+// creator or an admin may delete it, and everyone else gets 403.
 func (databaseList DatabaseList) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
@@ -679,12 +1141,32 @@ func (databaseList DatabaseList) DeleteHandler(w http.ResponseWriter, r *http.Re
 		}
 	}
 
+	// Documents may only be deleted by their creator if the ownership rule says so
+	if len(pathList)%2 == 0 {
+		username, _ := auth.UsernameFromContext(r.Context())
+		if owner := databaseList.requiredOwner(username, pathList[:len(pathList)-1], false); owner != "" && !documentFound.OwnedBy(owner) {
+			respondNotOwner(w)
+			return
+		}
+	}
+
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+
 	if len(pathList) == 1 {
 		// We queried a database; collect all documents within the database (which has already been filtered by `start` and `end` in GetDatabase)
+		if err := databaseList.journalDelete(path); err != nil {
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
 		database.DeleteDatabase(databaseList.databaseList, databaseFound, databaseList.subscriberHandler, path)
 		w.WriteHeader(http.StatusNoContent)
 	} else if len(pathList) == 2 {
 		// We queried a specific document; handle it directly
+		if err := databaseList.journalDelete(path); err != nil {
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
 		contents.DeleteDocument(databaseFound.Documents, documentFound.Name, databaseList.subscriberHandler, path)
 		// Return the URI (path) of the document
 		w.WriteHeader(http.StatusNoContent)
@@ -720,6 +1202,10 @@ func (databaseList DatabaseList) DeleteHandler(w http.ResponseWriter, r *http.Re
 			}
 		}
 
+		if err := databaseList.journalDelete(path); err != nil {
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
 		contents.DeleteDocument(collectionFound.Documents, documentFound.Name, databaseList.subscriberHandler, path)
 		// Return the URI (path) of the document
 		w.WriteHeader(http.StatusNoContent)
@@ -756,17 +1242,25 @@ func (databaseList DatabaseList) DeleteHandler(w http.ResponseWriter, r *http.Re
 			}
 		}
 
+		if err := databaseList.journalDelete(path); err != nil {
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
 		contents.DeleteCollection(documentFound.Collections, collectionFound.Name, databaseList.subscriberHandler, path)
 	}
 	w.WriteHeader(http.StatusNoContent)
 
 }
 
-// PatchHandler handles PATCH requests for modifying an existing database, document, or collection.
-// It is used to apply partial updates to documents/collections, while making sure that the contents still
-// match the given schema.
-// This function first validates the request, identifies the database and document needed for the patch,
-// and then applies the specified patch operations atomically.
+// PatchHandler handles PATCH requests, which apply partial updates to a document. The
+// operations are applied together in one update of the document, so the result is checked
+// against the schema once and stored as one new version with one update event, and a
+// failing operation leaves the document untouched. The If-Match and If-None-Match headers
+// must hold for the stored document, and the ETag of the response is its new version. Like
+// PUT and DELETE, a patch to another user's document is refused with 403 when the
+// ownership rule restricts writes. Bodies sent as application/json-patch+json or
+// application/merge-patch+json hold an RFC 6902 JSON Patch or an RFC 7396 JSON Merge Patch
+// instead of OwlDB patch operations.
 func (databaseList DatabaseList) PatchHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
@@ -847,88 +1341,79 @@ func (databaseList DatabaseList) PatchHandler(w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	// Read the patch operations from the request body
-	var patchOps []PatchOperation
-	err = json.NewDecoder(r.Body).Decode(&patchOps)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid patch request body")
+	if len(pathList)%2 == 1 {
+		respondWithError(w, http.StatusBadRequest, "Only documents can be patched")
 		return
 	}
+	documentList := databaseFound.Documents
+	if len(pathList) > 2 {
+		documentList = collectionFound.Documents
+	}
 
-	// Apply each patch operation atomically
-	patchFailed := false
-	var message string
-
-	// Create a copy of the original document content
-	originalContent := documentFound.Content
+	// Read the patch from the request body
+	var update func(content []byte) ([]byte, error)
+	if mediaType := standardPatchType(r); mediaType != "" {
+		visitor, err := decodeStandardPatch(r, mediaType)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid patch request body")
+			return
+		}
+		update = func(content []byte) ([]byte, error) {
+			return patchDocument(content, visitor)
+		}
+	} else {
+		var patchOps []PatchOperation
+		err = json.NewDecoder(r.Body).Decode(&patchOps)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid patch request body")
+			return
+		}
+		update = func(content []byte) ([]byte, error) {
+			return patchContent(content, patchOps)
+		}
+	}
 
 	//get user
 	username, _ := auth.UsernameFromContext(r.Context())
 
-	// Supported operations
-	supportedOps := map[string]bool{"ArrayAdd": true, "ArrayRemove": true, "ObjectAdd": true}
+	// The stored document must match the request's preconditions
+	precondition := preconditionFromRequest(r)
+	precondition.Owner = databaseList.requiredOwner(username, pathList[:len(pathList)-1], false)
 
-	// Try applying patches
-	for _, patch := range patchOps {
-		// Check if operation type is valid
-		if !supportedOps[patch.Op] {
-			patchFailed = true
-			message = fmt.Sprintf("Invalid operation type: %v", patch.Op)
-			break
-		}
-		// If document is in a collection
-		if len(pathList) > 2 {
-			err := applyPatch(&documentFound, patch, collectionFound.Documents, username, databaseList.schema)
-			if err != nil {
-				patchFailed = true
-				message = fmt.Sprintf("Patch failed: %v", err)
-				break
-			}
-		} else {
-			err := applyPatch(&documentFound, patch, databaseFound.Documents, username, databaseList.schema)
-			if err != nil {
-				patchFailed = true
-				message = fmt.Sprintf("Patch failed: %v", err)
-				break
-			}
-		}
-	}
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+	restore := databaseList.saveState(path)
 
-	if patchFailed {
-		// If patch failed, revert to original content
-		documentFound.Content = originalContent
-	} else {
-		message = "patch applied"
+	// The whole patch is applied to the stored contents inside one update, and the result
+	// is validated against the schema once and written as a single new version
+	stored, err := contents.UpdateDocumentIf(documentList, documentFound.Name, update, username, databaseList.schemaFor(pathList), precondition)
+	switch {
+	case errors.Is(err, contents.ErrNotOwner):
+		respondNotOwner(w)
+		return
+	case errors.Is(err, contents.ErrPreconditionFailed):
+		respondWithError(w, http.StatusPreconditionFailed, "Precondition failed")
+		return
+	case err != nil:
+		// Nothing was written, so the document keeps its version
+		if current, found := documentList.Find(documentFound.Name); found {
+			documentFound = current
+		}
+		w.Header().Set("ETag", contents.ETag(documentFound.Version))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(PatchResponse{URI: pathToReturn, PatchFailed: true, Message: fmt.Sprintf("Patch failed: %v", err)})
+		return
 	}
-
-	// Create the response struct
-	response := PatchResponse{
-		URI:         pathToReturn,
-		PatchFailed: patchFailed,
-		Message:     message,
+	if err := databaseList.journalPatch(path); err != nil {
+		restore()
+		respondWithError(w, http.StatusInternalServerError, journalFailed)
+		return
 	}
+	databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Patch, Path: path, Content: stored.Content, Owner: stored.Metadata.CreatedBy})
 
+	w.Header().Set("ETag", contents.ETag(stored.Version))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
-}
-
-// This helper function checks that the provided patch operation from the request body is valid.
-// It will direct the request to the proper helpers if the given patch operation is valid or it will
-// throw an error if the provided patch operation is not valid.
-func applyPatch(document *contents.Document, patch PatchOperation, documentList skiplist.DBIndex[string, contents.Document], user string, schema Valid) error {
-	switch patch.Op {
-	case "ArrayAdd":
-		fmt.Println("were adding an array")
-		return applyArrayAdd(document, patch.Path, patch.Value, documentList, user, schema)
-	case "ArrayRemove":
-		fmt.Println("were removing an array")
-		return applyArrayRemove(document, patch.Path, patch.Value, documentList, user, schema)
-	case "ObjectAdd":
-		fmt.Println("were adding an object")
-		return applyObjectAdd(document, patch.Path, patch.Value, documentList, user, schema)
-	default:
-		return fmt.Errorf("unsupported patch operation: %s", patch.Op)
-	}
+	json.NewEncoder(w).Encode(PatchResponse{URI: pathToReturn, PatchFailed: false, Message: "patch applied"})
 }
 
 // This interface implements the visitor map that we will use in our PATCH requests
@@ -936,123 +1421,6 @@ type Visitor interface {
 	VisitMap(map[string]interface{}) error
 }
 
-// This helper function is used to add content to an Object in the document that we are patching on.
-// The content from the request is unmarshalled, the visitor map is applied, and upon success the
-// content is re-marshalled and added to the document.
-func applyObjectAdd(document *contents.Document, path string, value jsondata.JSONValue, documentList skiplist.DBIndex[string, contents.Document], user string, schema Valid) error {
-	var jsonContent map[string]interface{}
-
-	// Unmarshal the document.Content (which is []byte) into a map[string]interface{}
-	err := json.Unmarshal(document.Content, &jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal document content: %w", err)
-	}
-
-	// Create the visitor for adding an object
-	visitor := &ObjectAddVisitor{
-		Path:  path,
-		Value: value,
-	}
-
-	// Apply the visitor to the JSON structure
-	err = visitor.VisitMap(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to add object: %w", err)
-	}
-
-	// Re-marshal the modified jsonContent into document.Content
-	document.Content, err = json.Marshal(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to marshal modified document content: %w", err)
-	}
-
-	// Upsert the modified document back into the skiplist
-	_, err = contents.PutDocument(documentList, document.Name, document.Content, user, "overwrite", schema)
-	if err != nil {
-		return fmt.Errorf("failed to update document in skiplist: %w", err)
-	}
-
-	return nil
-}
-
-// This helper function is used to add content to an Array in the document that we are patching on.
-// The content from the request is unmarshalled, the visitor map is applied, and upon success the
-// content is re-marshalled and added to the document.
-func applyArrayAdd(document *contents.Document, path string, value jsondata.JSONValue, documentList skiplist.DBIndex[string, contents.Document], user string, schema Valid) error {
-	var jsonContent map[string]interface{}
-
-	// Unmarshal the document.Content (which is []byte) into a map[string]interface{}
-	err := json.Unmarshal(document.Content, &jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal document content: %w", err)
-	}
-
-	// Create the visitor for adding an element to an array
-	visitor := &ArrayAddVisitor{
-		Path:  path,
-		Value: value,
-	}
-
-	// Apply the visitor to the JSON structure
-	err = visitor.VisitMap(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to add array element: %w", err)
-	}
-
-	// Re-marshal the modified jsonContent into document.Content
-	document.Content, err = json.Marshal(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to marshal modified document content: %w", err)
-	}
-
-	// Upsert the modified document back into the skiplist
-	_, err = contents.PutDocument(documentList, document.Name, document.Content, user, "overwrite", schema)
-	if err != nil {
-		return fmt.Errorf("failed to update document in skiplist: %w", err)
-	}
-
-	return nil
-}
-
-// This helper function is used to remove content from an Array in the document that we are patching on.
-// The content from the request is unmarshalled, the visitor map is applied, and upon success the
-// content is re-marshalled and added to the document.
-func applyArrayRemove(document *contents.Document, path string, value jsondata.JSONValue, documentList skiplist.DBIndex[string, contents.Document], user string, schema Valid) error {
-	var jsonContent map[string]interface{}
-
-	// Unmarshal the document.Content (which is []byte) into a map[string]interface{}
-	err := json.Unmarshal(document.Content, &jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal document content: %w", err)
-	}
-
-	// Create the visitor for removing an element from an array
-	visitor := &ArrayRemoveVisitor{
-		Path:  path,
-		Value: value,
-	}
-
-	// Apply the visitor to the JSON structure
-	err = visitor.VisitMap(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to remove array element: %w", err)
-	}
-
-	// Re-marshal the modified jsonContent into document.Content
-	document.Content, err = json.Marshal(jsonContent)
-	if err != nil {
-		return fmt.Errorf("failed to marshal modified document content: %w", err)
-	}
-
-	// Upsert the modified document back into the skiplist
-	_, err = contents.PutDocument(documentList, document.Name, document.Content, user, "overwrite", schema)
-	if err != nil {
-		return fmt.Errorf("failed to update document in skiplist: %w", err)
-	}
-
-	return nil
-}
-
 type ObjectAddVisitor struct {
 	Path  string
 	Value interface{}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -135,7 +137,6 @@ func TestGetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testDoc2 := contents.Document{
 		Name:    "testDoc2",
@@ -148,7 +149,6 @@ func TestGetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testCollection1 := contents.Collection{
 		Name:      "testCollection1",
@@ -165,7 +165,6 @@ func TestGetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 
 	_, err := testDBList.databaseList.Upsert(testDB.Name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
@@ -363,7 +362,6 @@ func TestPutHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	existingtestCollection1 := contents.Collection{
 		Name:      "existingtestCollection1",
@@ -380,7 +378,6 @@ func TestPutHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 
 	_, err := testDBList.databaseList.Upsert(existingtestDB.Name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
@@ -665,7 +662,6 @@ func TestDeletetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testDoc2 := contents.Document{
 		Name:    "testDoc2",
@@ -678,7 +674,6 @@ func TestDeletetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testCollection1 := contents.Collection{
 		Name:      "testCollection1",
@@ -695,7 +690,6 @@ func TestDeletetHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 
 	_, err := testDBList.databaseList.Upsert(testDB.Name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
@@ -870,7 +864,6 @@ func TestPostHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testDoc2 := contents.Document{
 		Name:    "testDoc2",
@@ -883,7 +876,6 @@ func TestPostHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testCollection1 := contents.Collection{
 		Name:      "testCollection1",
@@ -1053,7 +1045,6 @@ func TestPatchHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testDoc2 := contents.Document{
 		Name:    "testDoc2",
@@ -1066,7 +1057,6 @@ func TestPatchHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testCollection1 := contents.Collection{
 		Name:      "testCollection1",
@@ -1083,7 +1073,6 @@ func TestPatchHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 	testDoc100 := contents.Document{
 		Name:    "testDoc100",
@@ -1096,7 +1085,6 @@ func TestPatchHandler(t *testing.T) {
 			LastModifiedAt: 13,
 		},
 		Collections: skiplist.NewSkipList[string, contents.Collection](),
-		Subscribers: make(map[string]contents.WriteFlusher),
 	}
 
 	_, err := testDBList.databaseList.Upsert(testDB.Name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
@@ -1393,3 +1381,140 @@ func TestPatchHandler(t *testing.T) {
 		i += 1
 	}
 }
+
+func TestGetHandlerFilter(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testDBList := New(&testSchema, nil)
+	doRequest(testDBList, http.MethodPut, "/v1/db1", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc2", `{"name":"april","age":35}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc3", `{"name":"esther","age":41}`)
+
+	testCases := []struct {
+		filter       string
+		expectedCode int
+		expectedDocs int
+	}{
+		{filter: "/age > 30", expectedCode: http.StatusOK, expectedDocs: 2},
+		{filter: `/age > 30 and /name != "esther"`, expectedCode: http.StatusOK, expectedDocs: 1},
+		{filter: `/name in ["julia", "esther"]`, expectedCode: http.StatusOK, expectedDocs: 2},
+		{filter: "exists /missing", expectedCode: http.StatusOK, expectedDocs: 0},
+		{filter: "/age >", expectedCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filter, func(t *testing.T) {
+			w := doRequest(testDBList, http.MethodGet, "/v1/db1/?filter="+url.QueryEscape(tc.filter), "")
+			if w.Code != tc.expectedCode {
+				t.Fatalf("Expected codes do not match: expected %d and received %d", tc.expectedCode, w.Code)
+			}
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var responses []DocumentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+				t.Fatalf("Response could not be decoded: %v", err)
+			}
+			if len(responses) != tc.expectedDocs {
+				t.Fatalf("Expected %d documents but received %d", tc.expectedDocs, len(responses))
+			}
+		})
+	}
+}
+
+func TestDocumentETags(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testDBList := New(&testSchema, nil)
+	doRequest(testDBList, http.MethodPut, "/v1/db1", "")
+
+	// doConditional sends a request with a single precondition header
+	doConditional := func(method string, target string, body string, header string, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer test_token")
+		if header != "" {
+			r.Header.Set(header, etag)
+		}
+		w := httptest.NewRecorder()
+		testDBList.V1Handler(w, r)
+		return w
+	}
+
+	w := doConditional(http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`, "If-None-Match", "*")
+	if w.Code != http.StatusCreated || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected status 201 with ETag \"1\" but received %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+	if w := doConditional(http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`, "If-None-Match", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status 412 for an existing document but received %d", w.Code)
+	}
+
+	// Two clients that both read version 1 race to write it
+	if w := doConditional(http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":23}`, "If-Match", `"1"`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected status 200 with ETag \"2\" but received %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+	if w := doConditional(http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":99}`, "If-Match", `"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status 412 for a stale ETag but received %d", w.Code)
+	}
+
+	w = doConditional(http.MethodGet, "/v1/db1/doc1", "", "", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` || !strings.Contains(w.Body.String(), `"age":23`) {
+		t.Fatalf("Unexpected GET response %d with ETag %q: %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+	if w := doConditional(http.MethodGet, "/v1/db1/doc1", "", "If-None-Match", `"2"`); w.Code != http.StatusNotModified {
+		t.Fatalf("Expected status 304 but received %d", w.Code)
+	}
+
+	patch := `[{"op":"ObjectAdd","path":"/age","value":24},{"op":"ObjectAdd","path":"/age","value":25}]`
+	if w := doConditional(http.MethodPatch, "/v1/db1/doc1", patch, "If-Match", `"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status 412 for a stale PATCH but received %d", w.Code)
+	}
+	// Every operation of a patch is written as one new version
+	w = doConditional(http.MethodPatch, "/v1/db1/doc1", patch, "If-Match", `"2"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("Expected status 200 with ETag \"3\" but received %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestPatchSingleWrite(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22,"tags":["a"]}`)
+
+	tests := []struct {
+		name     string
+		patch    string
+		failed   bool
+		etag     string
+		contains string
+	}{
+		{"later operation fails", `[{"op":"ObjectAdd","path":"/age","value":30},{"op":"ArrayRemove","path":"/tags","value":"b"}]`, true, `"1"`, `"age":22`},
+		{"intermediate state breaks schema", `[{"op":"ObjectAdd","path":"/name","value":1},{"op":"ObjectAdd","path":"/name","value":"june"}]`, false, `"2"`, `"name":"june"`},
+		{"final state breaks schema", `[{"op":"ArrayAdd","path":"/tags","value":"b"},{"op":"ObjectAdd","path":"/age","value":"old"}]`, true, `"2"`, `"tags":["a"]`},
+		{"several operations", `[{"op":"ArrayAdd","path":"/tags","value":"b"},{"op":"Increment","path":"/age","value":1},{"op":"ArrayAddUnique","path":"/tags","value":"b"}]`, false, `"3"`, `"tags":["a","b"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(databaseList, http.MethodPatch, "/v1/db1/doc1", tt.patch)
+			var response PatchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK || response.PatchFailed != tt.failed {
+				t.Fatalf("Expected status 200 with patchFailed %v but received %d: %s", tt.failed, w.Code, w.Body.String())
+			}
+			if w.Header().Get("ETag") != tt.etag {
+				t.Fatalf("Expected ETag %s but received %s", tt.etag, w.Header().Get("ETag"))
+			}
+			document := doRequest(databaseList, http.MethodGet, "/v1/db1/doc1", "").Body.String()
+			if !strings.Contains(document, tt.contains) {
+				t.Fatalf("Expected the document to contain %s: %s", tt.contains, document)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+)
+
+// This struct holds one revision of a document in a response. It contains the path
+// of the document, the version, the contents and metadata the document had in that
+// version, and when the version was written in Unix milliseconds.
+type RevisionResponse struct {
+	Path      string             `json:"path"`
+	Version   int64              `json:"version"`
+	Doc       jsondata.JSONValue `json:"doc"`
+	Meta      contents.Metadata  `json:"meta"`
+	WrittenAt int64              `json:"writtenAt"`
+}
+
+// revisionResponse converts a revision of the document at path into its response form.
+func revisionResponse(path string, revision contents.Revision) RevisionResponse {
+	var content jsondata.JSONValue
+	json.Unmarshal(revision.Content, &content)
+	return RevisionResponse{
+		Path:      path,
+		Version:   revision.Version,
+		Doc:       content,
+		Meta:      revision.Metadata,
+		WrittenAt: revision.WrittenAt,
+	}
+}
+
+// wantsRevisions reports whether a GET request asks for the history of a document
+// instead of its current state.
+func wantsRevisions(r *http.Request) bool {
+	params := r.URL.Query()
+	return params.Has("history") || params.Has("revision") || params.Has("asOf")
+}
+
+// respondWithRevisions answers a GET request on a document that carries one of the
+// history parameters. With `history` every kept revision is returned, oldest first.
+// With `revision=N` the revision with version N is returned, and with `asOf=<unix-ms>`
+// the revision that was current at that time is returned.
+func respondWithRevisions(w http.ResponseWriter, r *http.Request, path string, document contents.Document) {
+	params := r.URL.Query()
+
+	if params.Has("history") {
+		responses := []RevisionResponse{}
+		for _, revision := range document.Revisions() {
+			responses = append(responses, revisionResponse(path, revision))
+		}
+		httpResponse, _ := json.Marshal(responses)
+		w.Write(httpResponse)
+		return
+	}
+
+	var revision contents.Revision
+	var found bool
+	if params.Has("revision") {
+		version, err := strconv.ParseInt(params.Get("revision"), 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid revision")
+			return
+		}
+		revision, found = document.RevisionAt(version)
+	} else {
+		asOf, err := strconv.ParseInt(params.Get("asOf"), 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid asOf time")
+			return
+		}
+		revision, found = document.RevisionAsOf(asOf)
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Revision does not exist")
+		return
+	}
+	httpResponse, _ := json.Marshal(revisionResponse(path, revision))
+	w.Write(httpResponse)
+}
+
+// RestoreRevisionHandler handles POST requests to a document with the `restore=N` query
+// parameter. It writes the contents of revision N back as a new version of the document,
+// so the restore itself becomes part of the history. Like a PUT, it honors the If-Match and
+// If-None-Match headers, validates the contents against the document's schema, and returns
+// the new version as an ETag.
+func (databaseList DatabaseList) RestoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 1 {
+		respondWithError(w, http.StatusBadRequest, "Only documents can be restored")
+		return
+	}
+	version, err := strconv.ParseInt(r.URL.Query().Get("restore"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+	username, _ := auth.UsernameFromContext(r.Context())
+
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+	restore := databaseList.saveState(path)
+
+	documentList, found := databaseList.findDocumentList(pathList[:len(pathList)-1])
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Document does not exist")
+		return
+	}
+	name := pathList[len(pathList)-1]
+	document, found := documentList.Find(name)
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Document does not exist")
+		return
+	}
+	revision, found := document.RevisionAt(version)
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Revision does not exist")
+		return
+	}
+
+	precondition := preconditionFromRequest(r)
+	precondition.Owner = databaseList.requiredOwner(username, pathList[:len(pathList)-1], false)
+	stored, err := contents.PutDocumentIf(documentList, name, revision.Content, username, "overwrite", databaseList.schemaFor(pathList), precondition)
+	if errors.Is(err, contents.ErrNotOwner) {
+		respondNotOwner(w)
+		return
+	}
+	if errors.Is(err, contents.ErrPreconditionFailed) {
+		respondWithError(w, http.StatusPreconditionFailed, "Precondition failed")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Revision could not be restored: %v", err))
+		return
+	}
+	if err := databaseList.journal(path); err != nil {
+		restore()
+		respondWithError(w, http.StatusInternalServerError, journalFailed)
+		return
+	}
+	databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Update, Path: path, Content: stored.Content, Owner: stored.Metadata.CreatedBy})
+
+	w.Header().Set("ETag", contents.ETag(stored.Version))
+	response, _ := json.Marshal(map[string]any{"uri": r.URL.Path, "version": stored.Version})
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestDocumentHistory(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testDBList := New(&testSchema, nil)
+	doRequest(testDBList, http.MethodPut, "/v1/db1", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+	time.Sleep(5 * time.Millisecond)
+	betweenWrites := time.Now().UnixMilli()
+	time.Sleep(5 * time.Millisecond)
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":23}`)
+	doRequest(testDBList, http.MethodPatch, "/v1/db1/doc1", `[{"op":"ObjectAdd","path":"/age","value":24}]`)
+
+	w := doRequest(testDBList, http.MethodGet, "/v1/db1/doc1?history", "")
+	var history []RevisionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil || len(history) != 3 {
+		t.Fatalf("Expected 3 revisions: %s", w.Body.String())
+	}
+	if history[0].Version != 1 || history[2].Version != 3 {
+		t.Fatalf("Revisions are not ordered oldest first: %s", w.Body.String())
+	}
+
+	testCases := []struct {
+		target       string
+		expectedCode int
+		expectedAge  string
+	}{
+		{target: "/v1/db1/doc1?revision=1", expectedCode: http.StatusOK, expectedAge: "22"},
+		{target: "/v1/db1/doc1?revision=2", expectedCode: http.StatusOK, expectedAge: "23"},
+		{target: "/v1/db1/doc1?revision=9", expectedCode: http.StatusNotFound},
+		{target: "/v1/db1/doc1?revision=one", expectedCode: http.StatusBadRequest},
+		{target: "/v1/db1/doc1?asOf=" + strconv.FormatInt(betweenWrites, 10), expectedCode: http.StatusOK, expectedAge: "22"},
+		{target: "/v1/db1/doc1?asOf=1", expectedCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.target, func(t *testing.T) {
+			w := doRequest(testDBList, http.MethodGet, tc.target, "")
+			if w.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d", tc.expectedCode, w.Code)
+			}
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var revision struct {
+				Doc map[string]json.RawMessage `json:"doc"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &revision); err != nil || string(revision.Doc["age"]) != tc.expectedAge {
+				t.Fatalf("Expected age %s: %s", tc.expectedAge, w.Body.String())
+			}
+		})
+	}
+
+	// Restoring writes the old contents back as a new version
+	w = doRequest(testDBList, http.MethodPost, "/v1/db1/doc1?restore=1", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"4"` {
+		t.Fatalf("Expected status 200 with ETag \"4\" but received %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+	if got := documentContent(testDBList, "/v1/db1/doc1"); got != `{"age":22,"name":"julia"}` {
+		t.Fatalf("Restore did not bring back revision 1, document holds %s", got)
+	}
+	if w := doRequest(testDBList, http.MethodPost, "/v1/db1/doc1?restore=9", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing revision but received %d", w.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// IndexHandler handles requests carrying the `index` query parameter on a database or
+// collection path. A PUT declares an index on the JSON pointer given in the parameter,
+// a DELETE drops it, and a GET lists the JSON pointers of every index on the path.
+// Declaring an index that already exists is not an error and responds with 200 instead of 201.
+func (databaseList DatabaseList) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 0 {
+		respondWithError(w, http.StatusBadRequest, "Indexes can only be declared on databases and collections")
+		return
+	}
+	pointer := r.URL.Query().Get("index")
+
+	if r.Method == http.MethodGet {
+		documentList, found := databaseList.findDocumentList(pathList)
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		response, _ := json.Marshal(contents.Indexes(documentList))
+		w.Write(response)
+		return
+	}
+
+	if _, err := query.ParsePointer(pointer); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid index: %v", err))
+		return
+	}
+
+	unlock := databaseList.lockWrites(pathList[0])
+	defer unlock()
+
+	documentList, found := databaseList.findDocumentList(pathList)
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		created, err := contents.CreateIndex(r.Context(), documentList, pointer)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create index: %v", err))
+			return
+		}
+		if err := databaseList.journal(path); err != nil {
+			if created {
+				contents.DropIndex(documentList, pointer)
+			}
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+		response, _ := json.Marshal(map[string]string{"uri": r.URL.Path, "index": pointer})
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(response)
+	case http.MethodDelete:
+		if !contents.DropIndex(documentList, pointer) {
+			respondWithError(w, http.StatusNotFound, "Index does not exist")
+			return
+		}
+		if err := databaseList.journal(path); err != nil {
+			contents.CreateIndex(r.Context(), documentList, pointer)
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findDocumentList returns the documents of the database or collection at the given path.
+func (databaseList DatabaseList) findDocumentList(pathList []string) (skiplist.DBIndex[string, contents.Document], bool) {
+	db, found := databaseList.databaseList.Find(pathList[0])
+	if !found {
+		return nil, false
+	}
+	documentList := db.Documents
+	for i := 1; i+1 < len(pathList); i += 2 {
+		doc, found := documentList.Find(pathList[i])
+		if !found || doc.Collections == nil {
+			return nil, false
+		}
+		col, found := doc.Collections.Find(pathList[i+1])
+		if !found {
+			return nil, false
+		}
+		documentList = col.Documents
+	}
+	return documentList, true
+}
+
+// findCollectionList returns the collections of the document that holds the collection
+// at the given path.
+func (databaseList DatabaseList) findCollectionList(pathList []string) (skiplist.DBIndex[string, contents.Collection], bool) {
+	documentList, found := databaseList.findDocumentList(pathList[:len(pathList)-2])
+	if !found {
+		return nil, false
+	}
+	doc, found := documentList.Find(pathList[len(pathList)-2])
+	if !found || doc.Collections == nil {
+		return nil, false
+	}
+	return doc.Collections, true
+}
+
+// candidateDocuments returns an iterator over the documents in documentList that may
+// match the filter and have names between start and end, inclusive, in name order or in
+// descending name order if descending is set. If one of the list's indexes covers the
+// filter, only the documents it points to are returned. Otherwise the iterator streams
+// every document in the range. The caller still has to check each document against the
+// filter.
+func candidateDocuments(ctx context.Context, documentList skiplist.DBIndex[string, contents.Document], filter query.Expr, start string, end string, descending bool) (iter.Seq2[string, contents.Document], error) {
+	names, indexed, err := contents.Candidates(ctx, documentList, filter)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		if descending {
+			return documentList.Backward(ctx, start, end), nil
+		}
+		return documentList.Snapshot(ctx, start, end), nil
+	}
+	if descending {
+		slices.Reverse(names)
+	}
+	keys := skiplist.Range[string]{Start: start, End: end}
+	return func(yield func(string, contents.Document) bool) {
+		for _, name := range names {
+			if !keys.Contains(name) {
+				continue
+			}
+			if doc, found := documentList.Find(name); found && !yield(name, doc) {
+				return
+			}
+		}
+	}, nil
+}
+
+// listDocuments returns one page of the documents in documentList whose names are in the
+// range, or only of the ones matching the filter if there is one, in the given order.
+// Documents that keep rejects are left out as well, unless keep is nil. The second
+// result is the cursor of the next page, or "" if this is the last one.
+func (databaseList DatabaseList) listDocuments(ctx context.Context, documentList skiplist.DBIndex[string, contents.Document], keys skiplist.Range[string], filter query.Expr, keep func(contents.Document) bool, pg page, ord order) ([]contents.Document, string, error) {
+	documents, err := ord.documents(ctx, documentList, keys, filter, pg.after)
+	if err != nil {
+		return nil, "", err
+	}
+	matches, next := pg.collect(documents, ord.descending, func(doc contents.Document) bool {
+		if !keys.Contains(doc.Name) {
+			return false
+		}
+		// An index only narrows things down, the filter still decides
+		if filter != nil && !query.MatchContent(filter, doc.Content) {
+			return false
+		}
+		return keep == nil || keep(doc)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return matches, next, nil
+}
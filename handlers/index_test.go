@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestIndexHandler(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc2", `{"name":"april","age":21}`)
+
+	if w := doRequest(databaseList, http.MethodPut, "/v1/db1?index=/age", ""); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodPut, "/v1/db1?index=/age", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for an existing index but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodPut, "/v1/db1?index=age", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid pointer but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodPut, "/v1/db1/doc1?index=/age", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an index on a document but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodPut, "/v1/missing?index=/age", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing database but received %d", w.Code)
+	}
+
+	w := doRequest(databaseList, http.MethodGet, "/v1/db1?index", "")
+	var indexes []string
+	if err := json.Unmarshal(w.Body.Bytes(), &indexes); err != nil || !slices.Equal(indexes, []string{"/age"}) {
+		t.Fatalf("Unexpected index listing: %s", w.Body.String())
+	}
+
+	// The filter should go through the index and see later changes
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc2", `{"name":"april","age":22}`)
+	w = doRequest(databaseList, http.MethodGet, "/v1/db1?filter="+url.QueryEscape(`/age == 22`), "")
+	var responses []DocumentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil || len(responses) != 2 {
+		t.Fatalf("Expected both documents to match: %s", w.Body.String())
+	}
+	doRequest(databaseList, http.MethodDelete, "/v1/db1/doc1", "")
+	w = doRequest(databaseList, http.MethodGet, "/v1/db1?filter="+url.QueryEscape(`/age == 22`), "")
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil || len(responses) != 1 {
+		t.Fatalf("Expected only the remaining document to match: %s", w.Body.String())
+	}
+
+	if w := doRequest(databaseList, http.MethodDelete, "/v1/db1?index=/age", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 but received %d", w.Code)
+	}
+	if w := doRequest(databaseList, http.MethodDelete, "/v1/db1?index=/age", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing index but received %d", w.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// parseInterval parses the interval query parameter into the range of document names it
+// selects. An interval is two names separated by a comma and enclosed in brackets, where
+// a square bracket includes its name in the range and a parenthesis excludes it, as in
+// "[a,b]", "(a,b)", or "[a,b)". An empty name leaves its side of the range open, as in
+// "[a,]" or "[,b)". A backslash makes the character after it part of a name, so names
+// containing commas, brackets, or backslashes can be written as "[a\,b,c\]]". Spaces
+// around a name are ignored. It returns an error if the interval does not have this form.
+func parseInterval(interval string) (skiplist.Range[string], error) {
+	var keys skiplist.Range[string]
+	if interval == "" {
+		return keys, fmt.Errorf("interval is empty")
+	}
+	switch interval[0] {
+	case '[':
+	case '(':
+		keys.ExcludeStart = true
+	default:
+		return keys, fmt.Errorf("interval must start with [ or (")
+	}
+
+	var bounds []string
+	var bound strings.Builder
+	escaped := false
+	closed := false
+	for _, c := range interval[1:] {
+		switch {
+		case closed:
+			return keys, fmt.Errorf("unexpected %q after the end of the interval", c)
+		case escaped:
+			bound.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			bounds = append(bounds, strings.TrimSpace(bound.String()))
+			bound.Reset()
+		case c == ']' || c == ')':
+			bounds = append(bounds, strings.TrimSpace(bound.String()))
+			keys.ExcludeEnd = c == ')'
+			closed = true
+		default:
+			bound.WriteRune(c)
+		}
+	}
+	if !closed {
+		return keys, fmt.Errorf("interval must end with ] or )")
+	}
+	if len(bounds) != 2 {
+		return keys, fmt.Errorf("interval must hold two names separated by a comma")
+	}
+	keys.Start, keys.End = bounds[0], bounds[1]
+	return keys, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     skiplist.Range[string]
+		wantErr  bool
+	}{
+		{"[a,b]", skiplist.Range[string]{Start: "a", End: "b"}, false},
+		{"(a,b)", skiplist.Range[string]{Start: "a", End: "b", ExcludeStart: true, ExcludeEnd: true}, false},
+		{"[a,b)", skiplist.Range[string]{Start: "a", End: "b", ExcludeEnd: true}, false},
+		{"(a,b]", skiplist.Range[string]{Start: "a", End: "b", ExcludeStart: true}, false},
+		{"[a,]", skiplist.Range[string]{Start: "a"}, false},
+		{"(,b)", skiplist.Range[string]{End: "b", ExcludeStart: true, ExcludeEnd: true}, false},
+		{"[,]", skiplist.Range[string]{}, false},
+		{"[ a , b ]", skiplist.Range[string]{Start: "a", End: "b"}, false},
+		{`[a\,b,c\]]`, skiplist.Range[string]{Start: "a,b", End: "c]"}, false},
+		{`[a\\,b]`, skiplist.Range[string]{Start: `a\`, End: "b"}, false},
+		{"", skiplist.Range[string]{}, true},
+		{"a,b", skiplist.Range[string]{}, true},
+		{"[a,b", skiplist.Range[string]{}, true},
+		{"[ab]", skiplist.Range[string]{}, true},
+		{"[a,b,c]", skiplist.Range[string]{}, true},
+		{"[a,b]c", skiplist.Range[string]{}, true},
+		{`[a,b\]`, skiplist.Range[string]{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			got, err := parseInterval(tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInterval(%q) error = %v, wantErr %v", tt.interval, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("parseInterval(%q) = %+v, want %+v", tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInterval(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc", `{"name":"doc","age":20}`)
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc/col", "")
+	for _, name := range []string{"a", "b", "c", "d"} {
+		doRequest(databaseList, http.MethodPut, "/v1/db1/"+name, `{"name":"`+name+`","age":20}`)
+		doRequest(databaseList, http.MethodPut, "/v1/db1/doc/col/"+name, `{"name":"`+name+`","age":20}`)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		interval string
+		want     []string
+		status   int
+	}{
+		{"database inclusive", "/v1/db1/", "[b,d]", []string{"b", "c", "d"}, http.StatusOK},
+		{"database exclusive", "/v1/db1/", "(a,d)", []string{"b", "c"}, http.StatusOK},
+		{"database open start", "/v1/db1/", "[,b)", []string{"a"}, http.StatusOK},
+		{"collection half open", "/v1/db1/doc/col/", "(b,]", []string{"c", "d"}, http.StatusOK},
+		{"missing comma", "/v1/db1/", "[b]", nil, http.StatusBadRequest},
+		{"missing bracket", "/v1/db1/", "b,c", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(databaseList, http.MethodGet, tt.target+"?interval="+url.QueryEscape(tt.interval), "")
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d but received %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if names := pageNames(t, w.Body.Bytes()); !slices.Equal(names, tt.want) {
+				t.Fatalf("Expected %v but received %v", tt.want, names)
+			}
+		})
+	}
+}
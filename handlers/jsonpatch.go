@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// Content types of PATCH bodies that hold a standard patch instead of a list of OwlDB
+// patch operations.
+const (
+	jsonPatchContentType  = "application/json-patch+json"  // RFC 6902
+	mergePatchContentType = "application/merge-patch+json" // RFC 7396
+)
+
+// This struct represents one operation of an RFC 6902 JSON Patch. Op is add, remove,
+// replace, move, copy, or test. Path and From are JSON pointers, and Value is only used
+// by add, replace, and test, where it is required.
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// standardPatchType returns the content type of a PATCH request if it is one of the
+// standard patch formats, and "" otherwise.
+func standardPatchType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	if mediaType == jsonPatchContentType || mediaType == mergePatchContentType {
+		return mediaType
+	}
+	return ""
+}
+
+// decodeStandardPatch reads a JSON Patch or a JSON Merge Patch of the given content type
+// from the body of the request and returns the visitor that applies it.
+func decodeStandardPatch(r *http.Request, mediaType string) (Visitor, error) {
+	if mediaType == jsonPatchContentType {
+		var operations []JSONPatchOperation
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			return nil, err
+		}
+		return &JSONPatchVisitor{Operations: operations}, nil
+	}
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return nil, err
+	}
+	return &MergePatchVisitor{Patch: patch}, nil
+}
+
+// patchDocument applies the visitor to a copy of the document contents and returns the
+// result. The contents passed in are never changed.
+func patchDocument(content []byte, visitor Visitor) ([]byte, error) {
+	var jsonContent map[string]interface{}
+	if err := json.Unmarshal(content, &jsonContent); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document content: %w", err)
+	}
+	if err := visitor.VisitMap(jsonContent); err != nil {
+		return nil, err
+	}
+	patched, err := json.Marshal(jsonContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal modified document content: %w", err)
+	}
+	return patched, nil
+}
+
+type JSONPatchVisitor struct {
+	Operations []JSONPatchOperation
+}
+
+// This function applies the operations of an RFC 6902 JSON Patch to the document in order.
+// Every operation sees the changes of the ones before it, and the first one that fails
+// stops the patch. The document itself must stay an object, so the whole document can
+// only be replaced by another object and cannot be removed.
+func (v *JSONPatchVisitor) VisitMap(data map[string]interface{}) error {
+	for i, op := range v.Operations {
+		if err := applyJSONPatchOperation(data, op); err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return nil
+}
+
+// applyJSONPatchOperation applies one JSON Patch operation to the document.
+func applyJSONPatchOperation(data map[string]interface{}, op JSONPatchOperation) error {
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return fmt.Errorf("invalid value: %w", err)
+		}
+	case "move", "copy":
+		from, err := pointerTokens(op.From)
+		if err != nil {
+			return err
+		}
+		value, err = valueAt(data, from)
+		if err != nil {
+			return err
+		}
+		if op.Op == "move" {
+			if op.Path == op.From {
+				return nil
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return fmt.Errorf("cannot move a value into itself")
+			}
+			if err := updateDocument(data, from, removeValue); err != nil {
+				return err
+			}
+		} else {
+			// The copy must not share maps or slices with the original
+			value = cloneValue(value)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unsupported patch operation")
+	}
+
+	tokens, err := pointerTokens(op.Path)
+	if err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "move", "copy":
+		return updateDocument(data, tokens, func(container interface{}, token string) (interface{}, error) {
+			return addValue(container, token, value)
+		})
+	case "replace":
+		return updateDocument(data, tokens, func(container interface{}, token string) (interface{}, error) {
+			return replaceValue(container, token, value)
+		})
+	case "remove":
+		return updateDocument(data, tokens, removeValue)
+	default:
+		current, err := valueAt(data, tokens)
+		if err != nil {
+			return err
+		}
+		if !equalValues(current, value) {
+			return fmt.Errorf("test failed")
+		}
+		return nil
+	}
+}
+
+type MergePatchVisitor struct {
+	Patch interface{}
+}
+
+// This function merges an RFC 7396 JSON Merge Patch into the document. Members of the
+// patch that are null are removed from the document, objects are merged recursively,
+// and any other value replaces the member of the same name. Since the document must stay
+// an object, the patch itself must be an object.
+func (v *MergePatchVisitor) VisitMap(data map[string]interface{}) error {
+	patch, ok := v.Patch.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("merge patch must be an object")
+	}
+	mergeObject(data, patch)
+	return nil
+}
+
+// mergeObject merges the members of a merge patch into the target object.
+func mergeObject(target map[string]interface{}, patch map[string]interface{}) {
+	for name, value := range patch {
+		if value == nil {
+			delete(target, name)
+			continue
+		}
+		patchObject, isObject := value.(map[string]interface{})
+		if !isObject {
+			target[name] = value
+			continue
+		}
+		targetObject, isObject := target[name].(map[string]interface{})
+		if !isObject {
+			targetObject = map[string]interface{}{}
+		}
+		mergeObject(targetObject, patchObject)
+		target[name] = targetObject
+	}
+}
+
+// pointerTokens splits a JSON pointer into its decoded reference tokens. The empty
+// pointer refers to the whole document and has no tokens.
+func pointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q is not a JSON pointer", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = decodeJSONPointerToken(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex returns the array index a reference token stands for. The index may be one
+// past the end of the array if end is set, which "-" also refers to.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+	// Indexes are plain decimal numbers without leading zeros
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index > length || (index == length && !end) {
+		return 0, fmt.Errorf("array index %q is out of range", token)
+	}
+	return index, nil
+}
+
+// valueAt returns the value the reference tokens point to in the document.
+func valueAt(data map[string]interface{}, tokens []string) (interface{}, error) {
+	var current interface{} = data
+	for _, token := range tokens {
+		switch container := current.(type) {
+		case map[string]interface{}:
+			value, found := container[token]
+			if !found {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			current = container[index]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a value that is not an object or array", token)
+		}
+	}
+	return current, nil
+}
+
+// updateDocument calls update with the object or array that holds the value the tokens
+// point to, and the last token. The container update returns replaces the old one in its
+// own container, so arrays can grow and shrink. An empty list of tokens stands for the
+// whole document, which update receives as the container with an empty token.
+func updateDocument(data map[string]interface{}, tokens []string, update func(container interface{}, token string) (interface{}, error)) error {
+	if len(tokens) == 0 {
+		return replaceDocument(data, update)
+	}
+	_, err := updateValue(data, tokens, update)
+	return err
+}
+
+// updateValue walks down from node to the container of the last token and calls update
+// on it, then puts every container on the way back into its parent.
+func updateValue(node interface{}, tokens []string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(node, tokens[0])
+	}
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, found := container[tokens[0]]
+		if !found {
+			return nil, fmt.Errorf("member %q does not exist", tokens[0])
+		}
+		child, err := updateValue(child, tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = child
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(tokens[0], len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := updateValue(container[index], tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = child
+		return container, nil
+	default:
+		return nil, fmt.Errorf("cannot look up %q in a value that is not an object or array", tokens[0])
+	}
+}
+
+// replaceDocument lets update replace the whole document. The result must be an object,
+// whose members then replace the members of the document.
+func replaceDocument(data map[string]interface{}, update func(container interface{}, token string) (interface{}, error)) error {
+	// Wrap the document so update sees it as a member it may replace
+	wrapper := map[string]interface{}{"": data}
+	result, err := update(wrapper, "")
+	if err != nil {
+		return err
+	}
+	replacement, ok := result.(map[string]interface{})[""].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("the document must stay an object")
+	}
+	replacement = cloneValue(replacement).(map[string]interface{})
+	for name := range data {
+		delete(data, name)
+	}
+	for name, value := range replacement {
+		data[name] = value
+	}
+	return nil
+}
+
+// addValue adds the value to the container under the token. Objects get a member of that
+// name, replacing any member already there, and arrays get the value inserted before the
+// index, or appended for "-".
+func addValue(container interface{}, token string, value interface{}) (interface{}, error) {
+	switch container := container.(type) {
+	case map[string]interface{}:
+		container[token] = value
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), true)
+		if err != nil {
+			return nil, err
+		}
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+		return container, nil
+	default:
+		return nil, fmt.Errorf("cannot add %q to a value that is not an object or array", token)
+	}
+}
+
+// removeValue removes the member or array element the token refers to from the container.
+func removeValue(container interface{}, token string) (interface{}, error) {
+	switch container := container.(type) {
+	case map[string]interface{}:
+		if _, found := container[token]; !found {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+		delete(container, token)
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		return append(container[:index], container[index+1:]...), nil
+	default:
+		return nil, fmt.Errorf("cannot remove %q from a value that is not an object or array", token)
+	}
+}
+
+// replaceValue replaces the member or array element the token refers to in the container.
+func replaceValue(container interface{}, token string, value interface{}) (interface{}, error) {
+	switch container := container.(type) {
+	case map[string]interface{}:
+		if _, found := container[token]; !found {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+		container[token] = value
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+		return container, nil
+	default:
+		return nil, fmt.Errorf("cannot replace %q in a value that is not an object or array", token)
+	}
+}
+
+// cloneValue returns a deep copy of a value decoded from JSON.
+func cloneValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(value))
+		for name, member := range value {
+			clone[name] = cloneValue(member)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(value))
+		for i, element := range value {
+			clone[i] = cloneValue(element)
+		}
+		return clone
+	default:
+		return value
+	}
+}
+
+// equalValues reports whether two values decoded from JSON are equal, comparing them
+// the same way ArrayRemove compares array elements.
+func equalValues(a interface{}, b interface{}) bool {
+	aValue, err := jsondata.NewJSONValue(a)
+	if err != nil {
+		return false
+	}
+	bValue, err := jsondata.NewJSONValue(b)
+	if err != nil {
+		return false
+	}
+	return aValue.Equal(bValue)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// sameJSON reports whether two JSON texts hold equal values.
+func sameJSON(t *testing.T, a string, b string) bool {
+	var aValue, bValue interface{}
+	if err := json.Unmarshal([]byte(a), &aValue); err != nil {
+		t.Fatalf("Invalid JSON %s", a)
+	}
+	if err := json.Unmarshal([]byte(b), &bValue); err != nil {
+		t.Fatalf("Invalid JSON %s", b)
+	}
+	return equalValues(aValue, bValue)
+}
+
+func TestJSONPatchVisitor(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		expected string // "" if the patch should fail
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":[1]}]`, `{"a":[1]}`},
+		{"add array element", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"add array end", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"add nested", `{"a":{"b":[{"c":1}]}}`, `[{"op":"add","path":"/a/b/0/d","value":null}]`, `{"a":{"b":[{"c":1,"d":null}]}}`},
+		{"add escaped", `{}`, `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"a/b~c":1}`},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"add missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, ""},
+		{"add index too large", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, ""},
+		{"add leading zero", `{"a":[1]}`, `[{"op":"add","path":"/a/01","value":1}]`, ""},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, ""},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove array element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"remove missing", `{}`, `[{"op":"remove","path":"/a"}]`, ""},
+		{"remove whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, ""},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`},
+		{"replace array element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/1","value":3}]`, `{"a":[1,3]}`},
+		{"replace missing", `{}`, `[{"op":"replace","path":"/a","value":1}]`, ""},
+		{"replace document with array", `{}`, `[{"op":"replace","path":"","value":[1]}]`, ""},
+		{"move member", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"move array element", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ""},
+		{"copy member", `{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`, `{"a":{"b":[1]},"c":{"b":[1,2]}}`},
+		{"copy missing", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, ""},
+		{"test passes", `{"a":{"b":[1,"x"]}}`, `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, `{"a":{"b":[1,"x"]}}`},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ""},
+		{"failure undoes earlier operations", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`, ""},
+		{"unknown operation", `{}`, `[{"op":"ArrayAdd","path":"/a","value":1}]`, ""},
+		{"not a pointer", `{}`, `[{"op":"add","path":"a","value":1}]`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var operations []JSONPatchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &operations); err != nil {
+				t.Fatalf("Invalid test patch: %v", err)
+			}
+			result, err := patchDocument([]byte(tt.document), &JSONPatchVisitor{Operations: operations})
+			if tt.expected == "" {
+				if err == nil {
+					t.Fatalf("Expected the patch to fail but received %s", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Patch failed: %v", err)
+			}
+			if !sameJSON(t, string(result), tt.expected) {
+				t.Fatalf("Expected %s but received %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMergePatchVisitor(t *testing.T) {
+	// The examples of RFC 7396, appendix A, whose targets are objects
+	tests := []struct {
+		document string
+		patch    string
+		expected string // "" if the patch should fail
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"a":"b"}`, `["c"]`, ""},
+		{`{"a":"b"}`, `null`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			var patch interface{}
+			json.Unmarshal([]byte(tt.patch), &patch)
+			result, err := patchDocument([]byte(tt.document), &MergePatchVisitor{Patch: patch})
+			if tt.expected == "" {
+				if err == nil {
+					t.Fatalf("Expected the patch to fail but received %s", result)
+				}
+				return
+			}
+			if err != nil || !sameJSON(t, string(result), tt.expected) {
+				t.Fatalf("Expected %s but received %s (%v)", tt.expected, result, err)
+			}
+		})
+	}
+}
+
+func TestStandardPatchHandler(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	doRequest(databaseList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22}`)
+
+	// patch sends a patch of the given content type and returns the response and the document
+	patch := func(contentType string, body string, header string) (*httptest.ResponseRecorder, string) {
+		r := httptest.NewRequest(http.MethodPatch, "/v1/db1/doc1", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer test_token")
+		r.Header.Set("Content-Type", contentType)
+		if header != "" {
+			r.Header.Set("If-Match", header)
+		}
+		w := httptest.NewRecorder()
+		databaseList.V1Handler(w, r)
+		return w, doRequest(databaseList, http.MethodGet, "/v1/db1/doc1", "").Body.String()
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		ifMatch     string
+		status      int
+		failed      bool
+		contains    string
+	}{
+		{"json patch", jsonPatchContentType, `[{"op":"replace","path":"/age","value":23},{"op":"add","path":"/tags","value":["a"]}]`, "", http.StatusOK, false, `"age":23`},
+		{"json patch with parameters", jsonPatchContentType + "; charset=utf-8", `[{"op":"add","path":"/tags/-","value":"b"}]`, "", http.StatusOK, false, `["a","b"]`},
+		{"failed test", jsonPatchContentType, `[{"op":"replace","path":"/age","value":99},{"op":"test","path":"/name","value":"april"}]`, "", http.StatusOK, true, `"age":23`},
+		{"schema violation", jsonPatchContentType, `[{"op":"remove","path":"/age"}]`, "", http.StatusOK, true, `"age":23`},
+		{"merge patch", mergePatchContentType, `{"tags":null,"name":"june"}`, "", http.StatusOK, false, `"june"`},
+		{"stale if-match", mergePatchContentType, `{"name":"may"}`, `"1"`, http.StatusPreconditionFailed, false, `"june"`},
+		{"invalid body", jsonPatchContentType, `{"op":"add"}`, "", http.StatusBadRequest, false, `"june"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, document := patch(tt.contentType, tt.body, tt.ifMatch)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d but received %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				var response PatchResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.PatchFailed != tt.failed {
+					t.Fatalf("Expected patchFailed to be %v: %s", tt.failed, w.Body.String())
+				}
+			}
+			if !strings.Contains(document, tt.contains) {
+				t.Fatalf("Expected the document to contain %s: %s", tt.contains, document)
+			}
+		})
+	}
+}
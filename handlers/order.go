@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// An order is the order a listing returns documents in.
+type order struct {
+	by         string // metadata field to order by, or "" for document names
+	descending bool
+}
+
+// orderFromRequest reads the order and orderBy query parameters of a request. The order
+// is "asc" or "desc", and orderBy is "name" or one of contents.OrderFields. Listings are
+// in ascending name order by default. It returns an error for any other values.
+func orderFromRequest(r *http.Request) (order, error) {
+	var ord order
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+	case "desc":
+		ord.descending = true
+	default:
+		return ord, fmt.Errorf("order must be asc or desc")
+	}
+	if by := r.URL.Query().Get("orderBy"); by != "" && by != "name" {
+		if !slices.Contains(contents.OrderFields(), by) {
+			return ord, fmt.Errorf("orderBy must be name, %s", strings.Join(contents.OrderFields(), ", "))
+		}
+		ord.by = by
+	}
+	return ord, nil
+}
+
+// documents returns an iterator over the documents in documentList in the order, starting
+// at from, or at the beginning if from is "". The keys it yields sort in the order of the
+// iteration, so they can be used as cursors: they are the document names when ordering
+// by name and the order keys from contents.Ordered otherwise. When ordering by name, only
+// documents with names in the range are returned, and if one of the list's indexes covers
+// the filter, only the documents it points to. The caller still has to check each
+// document against the range and the filter.
+func (ord order) documents(ctx context.Context, documentList skiplist.DBIndex[string, contents.Document], keys skiplist.Range[string], filter query.Expr, from string) (iter.Seq2[string, contents.Document], error) {
+	if ord.by != "" {
+		return contents.Ordered(ctx, documentList, ord.by, ord.descending, from)
+	}
+
+	// Only the part of the range from the cursor on is iterated
+	start, end := keys.Start, keys.End
+	if from != "" && !ord.descending && from > start {
+		start = from
+	}
+	if from != "" && ord.descending && (end == "" || from < end) {
+		end = from
+	}
+	if filter != nil {
+		return candidateDocuments(ctx, documentList, filter, start, end, ord.descending)
+	}
+	if ord.descending {
+		return documentList.Backward(ctx, start, end), nil
+	}
+	return documentList.Snapshot(ctx, start, end), nil
+}
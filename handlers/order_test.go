@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestGetOrder(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	for _, name := range []string{"a", "b", "c", "d"} {
+		doRequest(databaseList, http.MethodPut, "/v1/db1/"+name, `{"name":"`+name+`","age":20}`)
+	}
+
+	// Give the documents distinct modification times, newest first by name
+	db, _ := databaseList.databaseList.Find("db1")
+	for i, name := range []string{"d", "b", "a", "c"} {
+		db.Documents.Upsert(name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+			currValue.Metadata.LastModifiedAt = int64(100 + i)
+			return currValue, nil
+		})
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		pages  [][]string
+		status int
+	}{
+		{"descending", "order=desc", [][]string{{"d", "c", "b", "a"}}, http.StatusOK},
+		{"descending pages", "order=desc&limit=3", [][]string{{"d", "c", "b"}, {"a"}}, http.StatusOK},
+		{"descending interval", "order=desc&limit=1&interval=" + url.QueryEscape("(a,c]"), [][]string{{"c"}, {"b"}}, http.StatusOK},
+		{"descending filter", "order=desc&limit=2&filter=" + url.QueryEscape(`/age == 20`), [][]string{{"d", "c"}, {"b", "a"}}, http.StatusOK},
+		{"by name", "orderBy=name&order=asc", [][]string{{"a", "b", "c", "d"}}, http.StatusOK},
+		{"newest first", "orderBy=lastModifiedAt&order=desc&limit=2", [][]string{{"c", "a"}, {"b", "d"}}, http.StatusOK},
+		{"oldest first", "orderBy=lastModifiedAt&limit=3", [][]string{{"d", "b", "a"}, {"c"}}, http.StatusOK},
+		{"unknown order", "order=up", nil, http.StatusBadRequest},
+		{"unknown field", "orderBy=size", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/v1/db1/?" + tt.query
+			if tt.pages == nil {
+				if w := doRequest(databaseList, http.MethodGet, target, ""); w.Code != tt.status {
+					t.Fatalf("Expected status %d but received %d", tt.status, w.Code)
+				}
+				return
+			}
+			for i, want := range tt.pages {
+				w := doRequest(databaseList, http.MethodGet, target, "")
+				if w.Code != tt.status {
+					t.Fatalf("Expected status %d but received %d: %s", tt.status, w.Code, w.Body.String())
+				}
+				if names := pageNames(t, w.Body.Bytes()); !slices.Equal(names, want) {
+					t.Fatalf("Expected page %d to hold %v but received %v", i, want, names)
+				}
+				next := w.Header().Get(nextCursorHeader)
+				if last := i == len(tt.pages)-1; last != (next == "") {
+					t.Fatalf("Unexpected next cursor %q on page %d", next, i)
+				}
+				target = "/v1/db1/?" + tt.query + "&cursor=" + url.QueryEscape(next)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
+)
+
+// OwnershipHandler handles requests carrying the `ownership` query parameter on a database
+// or collection path. A PUT sets who may use the documents directly inside it to the value
+// of the parameter: "writes" lets only a document's creator overwrite, patch, or delete it,
+// "reads" also lets only the creator read it, and "off" lets everyone use every document.
+// A GET returns the current setting. Admins may always use every document.
+func (databaseList DatabaseList) OwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 0 {
+		respondWithError(w, http.StatusBadRequest, "Ownership can only be set on databases and collections")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ownership, found := databaseList.attachedOwnership(pathList)
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		response, _ := json.Marshal(map[string]string{"uri": r.URL.Path, "ownership": ownership.String()})
+		w.Write(response)
+	case http.MethodPut:
+		ownership, err := contents.ParseOwnership(r.URL.Query().Get("ownership"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid ownership: %v", err))
+			return
+		}
+
+		unlock := databaseList.lockWrites(pathList[0])
+		defer unlock()
+		previous, _ := databaseList.attachedOwnership(pathList)
+		if databaseList.setOwnership(pathList, ownership) != nil {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		if err := databaseList.journal(path); err != nil {
+			databaseList.setOwnership(pathList, previous)
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+
+		response, _ := json.Marshal(map[string]string{"uri": r.URL.Path, "ownership": ownership.String()})
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// attachedOwnership returns the ownership of the database or collection at the given
+// path. It returns false if the path does not exist.
+func (databaseList DatabaseList) attachedOwnership(pathList []string) (contents.Ownership, bool) {
+	db, found := databaseList.databaseList.Find(pathList[0])
+	if !found {
+		return contents.OwnershipOff, false
+	}
+	if len(pathList) == 1 {
+		return db.Ownership, true
+	}
+	collectionList, found := databaseList.findCollectionList(pathList)
+	if !found {
+		return contents.OwnershipOff, false
+	}
+	col, found := collectionList.Find(pathList[len(pathList)-1])
+	if !found {
+		return contents.OwnershipOff, false
+	}
+	return col.Ownership, true
+}
+
+// setOwnership sets the ownership of the database or collection at the given path.
+func (databaseList DatabaseList) setOwnership(pathList []string, ownership contents.Ownership) error {
+	if len(pathList) == 1 {
+		return database.SetOwnership(databaseList.databaseList, pathList[0], ownership)
+	}
+	collectionList, found := databaseList.findCollectionList(pathList)
+	if !found {
+		return fmt.Errorf("collection does not exist")
+	}
+	return contents.SetCollectionOwnership(collectionList, pathList[len(pathList)-1], ownership)
+}
+
+// requiredOwner returns the user who must have created a document inside the database or
+// collection at the given path for the user to write it, or to read it if reads is set.
+// It returns "" if the user may use every document there, either because the ownership
+// of the path allows it or because the user is an admin of the path.
+func (databaseList DatabaseList) requiredOwner(username string, pathList []string, reads bool) string {
+	ownership, _ := databaseList.attachedOwnership(pathList)
+	if reads && !ownership.RestrictsReads() || !reads && !ownership.RestrictsWrites() {
+		return ""
+	}
+	if databaseList.policy != nil && databaseList.policy.RoleFor(username, pathList) >= auth.RoleAdmin {
+		return ""
+	}
+	return username
+}
+
+// readableFilter returns a function that reports whether the user may read a document
+// of the database or collection at the given path. It returns nil if the user may read
+// every document there.
+func (databaseList DatabaseList) readableFilter(username string, pathList []string) func(contents.Document) bool {
+	owner := databaseList.requiredOwner(username, pathList, true)
+	if owner == "" {
+		return nil
+	}
+	return func(doc contents.Document) bool {
+		return doc.OwnedBy(owner)
+	}
+}
+
+// readableEvents returns the function subscriptions of the user select their events with,
+// see sse.Filter. It reports whether the user may read the document at the given path,
+// created by owner, under the ownership of the database or collection the document is in
+// when the event is sent.
+func (databaseList DatabaseList) readableEvents(username string) func(path string, owner string) bool {
+	return func(path string, owner string) bool {
+		pathList := strings.Split(path, "/")
+		required := databaseList.requiredOwner(username, pathList[:len(pathList)-1], true)
+		return required == "" || required == owner
+	}
+}
+
+// respondNotOwner responds with 403 to a request for a document that belongs to another user.
+func respondNotOwner(w http.ResponseWriter) {
+	respondWithError(w, http.StatusForbidden, "Only the user who created this document may use it")
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestOwnership(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: auth.AnyUser, Path: "/", Role: "writer"},
+		{User: "admin", Path: "/", Role: "admin"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	testDBList := New(&testSchema, nil).WithPolicy(policy)
+
+	// Requests go through the auth middleware so they carry the user's name
+	am := auth.NewAuthManager(time.Hour)
+	tokens := map[string]string{}
+	for _, user := range []string{"admin", "alice", "bob"} {
+		tokens[user], _ = am.Login(user)
+	}
+	handler := am.Middleware(http.HandlerFunc(testDBList.V1Handler))
+	send := func(user string, method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+tokens[user])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	send("admin", http.MethodPut, "/v1/db1", "")
+	send("alice", http.MethodPut, "/v1/db1/doc1", `{"name":"alice","age":30}`)
+	send("bob", http.MethodPut, "/v1/db1/doc2", `{"name":"bob","age":40}`)
+	if w := send("alice", http.MethodPut, "/v1/db1?ownership=owner", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Only admins may set the ownership rule, received %d", w.Code)
+	}
+	if w := send("admin", http.MethodPut, "/v1/db1?ownership=owner", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an unknown ownership rule but received %d", w.Code)
+	}
+
+	testCases := []struct {
+		name         string
+		ownership    string
+		user         string
+		method       string
+		target       string
+		body         string
+		expectedCode int
+	}{
+		{name: "off lets anyone write", ownership: "off", user: "bob", method: http.MethodPut, target: "/v1/db1/doc1", body: `{"name":"alice","age":31}`, expectedCode: http.StatusOK},
+		{name: "writes stops overwrites", ownership: "writes", user: "bob", method: http.MethodPut, target: "/v1/db1/doc1", body: `{"name":"bob","age":1}`, expectedCode: http.StatusForbidden},
+		{name: "writes stops patches", ownership: "writes", user: "bob", method: http.MethodPatch, target: "/v1/db1/doc1", body: `[{"op":"ObjectAdd","path":"/age","value":1}]`, expectedCode: http.StatusForbidden},
+		{name: "writes stops deletes", ownership: "writes", user: "bob", method: http.MethodDelete, target: "/v1/db1/doc1", expectedCode: http.StatusForbidden},
+		{name: "writes allows reads", ownership: "writes", user: "bob", method: http.MethodGet, target: "/v1/db1/doc1", expectedCode: http.StatusOK},
+		{name: "writes allows the creator", ownership: "writes", user: "alice", method: http.MethodPut, target: "/v1/db1/doc1", body: `{"name":"alice","age":32}`, expectedCode: http.StatusOK},
+		{name: "writes allows new documents", ownership: "writes", user: "bob", method: http.MethodPut, target: "/v1/db1/doc3", body: `{"name":"bob","age":2}`, expectedCode: http.StatusCreated},
+		{name: "admin overrides writes", ownership: "writes", user: "admin", method: http.MethodPatch, target: "/v1/db1/doc1", body: `[{"op":"ObjectAdd","path":"/age","value":33}]`, expectedCode: http.StatusOK},
+		{name: "reads stops reads", ownership: "reads", user: "bob", method: http.MethodGet, target: "/v1/db1/doc1", expectedCode: http.StatusForbidden},
+		{name: "reads allows the creator", ownership: "reads", user: "alice", method: http.MethodGet, target: "/v1/db1/doc1", expectedCode: http.StatusOK},
+		{name: "admin overrides reads", ownership: "reads", user: "admin", method: http.MethodGet, target: "/v1/db1/doc1", expectedCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := send("admin", http.MethodPut, "/v1/db1?ownership="+tc.ownership, ""); w.Code != http.StatusOK {
+				t.Fatalf("Failed to set ownership %s: %d", tc.ownership, w.Code)
+			}
+			if w := send(tc.user, tc.method, tc.target, tc.body); w.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Listings only hold the documents the user may read
+	w := send("bob", http.MethodGet, "/v1/db1/", "")
+	var documents []DocumentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &documents); err != nil {
+		t.Fatalf("Failed to decode listing: %s", w.Body.String())
+	}
+	for _, doc := range documents {
+		if doc.Meta.CreatedBy != "bob" {
+			t.Fatalf("Listing holds a document created by %s", doc.Meta.CreatedBy)
+		}
+	}
+	if len(documents) != 2 {
+		t.Fatalf("Expected bob's 2 documents but received %d", len(documents))
+	}
+	if w := send("admin", http.MethodGet, "/v1/db1?ownership", ""); !strings.Contains(w.Body.String(), `"ownership":"reads"`) {
+		t.Fatalf("Expected the ownership rule to be reads: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"iter"
+	"net/http"
+	"strconv"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+)
+
+// Header that holds the cursor of the next page of a listing. It is only set if there
+// are more documents after the page.
+const nextCursorHeader = "X-Next-Cursor"
+
+// A page selects part of a listing of documents: the documents that come after the one
+// the cursor of the previous page points to, up to a limit.
+type page struct {
+	after string // key of the last document of the previous page, or "" for the first page
+	limit int    // largest number of documents on the page, or 0 for no limit
+}
+
+// pageFromRequest reads the limit and cursor query parameters of a request. It returns an
+// error if the limit is not a positive number or the cursor is not one this server made.
+func pageFromRequest(r *http.Request) (page, error) {
+	var pg page
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return pg, fmt.Errorf("limit must be a positive number")
+		}
+		pg.limit = n
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return pg, err
+		}
+		pg.after = after
+	}
+	return pg, nil
+}
+
+// encodeCursor returns the cursor of a page that ends with the document of the given key,
+// which is its name or, when ordering by metadata, its order key. Clients should treat
+// it as opaque.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor returns the key of the last document of the page the cursor was made for.
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	return string(key), nil
+}
+
+// collect returns the documents of the page out of documents, keeping only the ones keep
+// accepts. The keys of documents must be in ascending order, or in descending order if
+// descending is set. Documents up to and including the page's cursor are skipped, so the
+// cursor is an exclusive bound. The second result is the cursor of the next page, or ""
+// if this is the last one. The iteration is stopped as soon as the page is full and it
+// is known whether another page follows.
+func (pg page) collect(documents iter.Seq2[string, contents.Document], descending bool, keep func(contents.Document) bool) ([]contents.Document, string) {
+	matches := []contents.Document{}
+	last := ""
+	for key, doc := range documents {
+		if pg.after != "" && (!descending && key <= pg.after || descending && key >= pg.after) {
+			continue
+		}
+		if !keep(doc) {
+			continue
+		}
+		if pg.limit > 0 && len(matches) == pg.limit {
+			// There is at least one more document, so another page follows
+			return matches, encodeCursor(last)
+		}
+		matches = append(matches, doc)
+		last = key
+	}
+	return matches, ""
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestGetPagination(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	databaseList := New(&testSchema, nil)
+	doRequest(databaseList, http.MethodPut, "/v1/db1", "")
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		doRequest(databaseList, http.MethodPut, "/v1/db1/"+name, `{"name":"`+name+`","age":20}`)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		pages  [][]string
+		status int
+	}{
+		{"whole listing", "", [][]string{{"a", "b", "c", "d", "e"}}, http.StatusOK},
+		{"pages of two", "limit=2", [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, http.StatusOK},
+		{"limit equal to size", "limit=5", [][]string{{"a", "b", "c", "d", "e"}}, http.StatusOK},
+		{"with interval", "limit=2&interval=" + url.QueryEscape("[b,d]"), [][]string{{"b", "c"}, {"d"}}, http.StatusOK},
+		{"with filter", "limit=1&filter=" + url.QueryEscape(`/age == 20`), [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}, http.StatusOK},
+		{"zero limit", "limit=0", nil, http.StatusBadRequest},
+		{"bad limit", "limit=two", nil, http.StatusBadRequest},
+		{"bad cursor", "cursor=***", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/v1/db1/?" + tt.query
+			for i, want := range tt.pages {
+				w := doRequest(databaseList, http.MethodGet, target, "")
+				if w.Code != tt.status {
+					t.Fatalf("Expected status %d but received %d: %s", tt.status, w.Code, w.Body.String())
+				}
+				if names := pageNames(t, w.Body.Bytes()); !slices.Equal(names, want) {
+					t.Fatalf("Expected page %d to hold %v but received %v", i, want, names)
+				}
+				next := w.Header().Get(nextCursorHeader)
+				if last := i == len(tt.pages)-1; last != (next == "") {
+					t.Fatalf("Unexpected next cursor %q on page %d", next, i)
+				}
+				target = "/v1/db1/?" + tt.query + "&cursor=" + url.QueryEscape(next)
+			}
+			if tt.pages == nil {
+				if w := doRequest(databaseList, http.MethodGet, target, ""); w.Code != tt.status {
+					t.Fatalf("Expected status %d but received %d", tt.status, w.Code)
+				}
+			}
+		})
+	}
+
+	// A cursor stays valid when the document it points to is deleted
+	w := doRequest(databaseList, http.MethodGet, "/v1/db1/?limit=2", "")
+	next := w.Header().Get(nextCursorHeader)
+	doRequest(databaseList, http.MethodDelete, "/v1/db1/b", "")
+	w = doRequest(databaseList, http.MethodGet, "/v1/db1/?limit=2&cursor="+url.QueryEscape(next), "")
+	if names := pageNames(t, w.Body.Bytes()); !slices.Equal(names, []string{"c", "d"}) {
+		t.Fatalf("Expected the page after a deleted cursor to hold [c d] but received %v", names)
+	}
+}
+
+// pageNames returns the name field of each document in a listing.
+func pageNames(t *testing.T, body []byte) []string {
+	var responses []struct {
+		Doc struct {
+			Name string `json:"name"`
+		} `json:"doc"`
+	}
+	if err := json.Unmarshal(body, &responses); err != nil {
+		t.Fatalf("Could not decode listing: %s", body)
+	}
+	names := []string{}
+	for _, response := range responses {
+		names = append(names, response.Doc.Name)
+	}
+	return names
+}
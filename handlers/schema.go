@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// SchemaHandler handles requests carrying the `schema` query parameter on a database or
+// collection path. A PUT attaches the JSON schema in the request body, replacing any schema
+// that was attached before, a DELETE removes it, and a GET returns it. Documents written
+// under the path are validated against the most specific schema above them, and against
+// the server's schema when there is none.
+func (databaseList DatabaseList) SchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if strings.Contains(r.URL.Path, "//") {
+		http.Error(w, "bad path: // not allowed", http.StatusBadRequest)
+		return
+	}
+	if len(pathList)%2 == 0 {
+		respondWithError(w, http.StatusBadRequest, "Schemas can only be attached to databases and collections")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schema, found := databaseList.attachedSchema(pathList)
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		if schema == nil {
+			respondWithError(w, http.StatusNotFound, "No schema is attached")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(schema.Source())
+	case http.MethodPut:
+		schema, err := readSchema(r, path)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid schema: %v", err))
+			return
+		}
+		if schema == nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid schema: request body is empty")
+			return
+		}
+
+		unlock := databaseList.lockWrites(pathList[0])
+		defer unlock()
+		previous, found := databaseList.attachedSchema(pathList)
+		if !found || databaseList.setSchema(pathList, schema) != nil {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		if err := databaseList.journal(path); err != nil {
+			databaseList.setSchema(pathList, previous)
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+
+		response, _ := json.Marshal(map[string]string{"uri": r.URL.Path})
+		if previous == nil {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(response)
+	case http.MethodDelete:
+		unlock := databaseList.lockWrites(pathList[0])
+		defer unlock()
+		previous, found := databaseList.attachedSchema(pathList)
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Database or collection does not exist")
+			return
+		}
+		if previous == nil {
+			respondWithError(w, http.StatusNotFound, "No schema is attached")
+			return
+		}
+		databaseList.setSchema(pathList, nil)
+		if err := databaseList.journal(path); err != nil {
+			databaseList.setSchema(pathList, previous)
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// readSchema compiles the JSON schema in the request body. It returns nil if the body
+// is empty.
+func readSchema(r *http.Request, name string) (*jsondata.ValidSchema, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	schema, err := jsondata.NewFromBytes(name, body)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// attachedSchema returns the schema attached to the database or collection at the given
+// path, which is nil if it has none. It returns false if the path does not exist.
+func (databaseList DatabaseList) attachedSchema(pathList []string) (*jsondata.ValidSchema, bool) {
+	db, found := databaseList.databaseList.Find(pathList[0])
+	if !found {
+		return nil, false
+	}
+	if len(pathList) == 1 {
+		return db.Schema, true
+	}
+	collectionList, found := databaseList.findCollectionList(pathList)
+	if !found {
+		return nil, false
+	}
+	col, found := collectionList.Find(pathList[len(pathList)-1])
+	if !found {
+		return nil, false
+	}
+	return col.Schema, true
+}
+
+// setSchema attaches the schema to the database or collection at the given path.
+func (databaseList DatabaseList) setSchema(pathList []string, schema *jsondata.ValidSchema) error {
+	if len(pathList) == 1 {
+		return database.SetSchema(databaseList.databaseList, pathList[0], schema)
+	}
+	collectionList, found := databaseList.findCollectionList(pathList)
+	if !found {
+		return fmt.Errorf("collection does not exist")
+	}
+	return contents.SetCollectionSchema(collectionList, pathList[len(pathList)-1], schema)
+}
+
+// schemaFor returns the schema that documents inside the database or collection at the
+// given path, or the document at the given path, are validated against. This is the
+// schema attached to the closest collection or database on the path, or the server's
+// schema if none of them has one.
+func (databaseList DatabaseList) schemaFor(pathList []string) Valid {
+	schema := databaseList.schema
+	db, found := databaseList.databaseList.Find(pathList[0])
+	if !found {
+		return schema
+	}
+	if db.Schema != nil {
+		schema = db.Schema
+	}
+	documentList := db.Documents
+	for i := 1; i+1 < len(pathList); i += 2 {
+		doc, found := documentList.Find(pathList[i])
+		if !found || doc.Collections == nil {
+			break
+		}
+		col, found := doc.Collections.Find(pathList[i+1])
+		if !found {
+			break
+		}
+		if col.Schema != nil {
+			schema = col.Schema
+		}
+		documentList = col.Documents
+	}
+	return schema
+}
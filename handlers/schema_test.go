@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+func TestSchemaHandler(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testDBList := New(&testSchema, nil)
+	countSchema := `{"type":"object","properties":{"count":{"type":"integer"}},"required":["count"]}`
+	labelSchema := `{"type":"object","properties":{"label":{"type":"string"}},"required":["label"]}`
+
+	// db1 keeps the server's schema, db2 gets its own at creation time
+	doRequest(testDBList, http.MethodPut, "/v1/db1", "")
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db2", countSchema); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db3", `{"type":"nonsense"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid schema but received %d", w.Code)
+	}
+	doRequest(testDBList, http.MethodPut, "/v1/db2/doc1", `{"count":1}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db2/doc1/col1", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db2/doc1/col2", "")
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db2/doc1/col1?schema", labelSchema); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+
+	testCases := []struct {
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{path: "/v1/db1/doc1", body: `{"name":"julia","age":22}`, expectedCode: http.StatusCreated},
+		{path: "/v1/db1/doc2", body: `{"count":1}`, expectedCode: http.StatusBadRequest},
+		{path: "/v1/db2/doc2", body: `{"count":2}`, expectedCode: http.StatusCreated},
+		{path: "/v1/db2/doc3", body: `{"name":"julia","age":22}`, expectedCode: http.StatusBadRequest},
+		{path: "/v1/db2/doc1/col1/doc4", body: `{"label":"owl"}`, expectedCode: http.StatusCreated},
+		{path: "/v1/db2/doc1/col1/doc5", body: `{"count":5}`, expectedCode: http.StatusBadRequest},
+		{path: "/v1/db2/doc1/col2/doc6", body: `{"count":6}`, expectedCode: http.StatusCreated},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if w := doRequest(testDBList, http.MethodPut, tc.path, tc.body); w.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d", tc.expectedCode, w.Code)
+			}
+		})
+	}
+
+	if w := doRequest(testDBList, http.MethodGet, "/v1/db2/doc1/col1?schema", ""); w.Code != http.StatusOK || w.Body.String() != labelSchema {
+		t.Fatalf("Unexpected schema response %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(testDBList, http.MethodGet, "/v1/db1?schema", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 without a schema but received %d", w.Code)
+	}
+
+	// Once the collection's schema is removed, the database's schema applies again
+	if w := doRequest(testDBList, http.MethodDelete, "/v1/db2/doc1/col1?schema", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 but received %d", w.Code)
+	}
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db2/doc1/col1/doc5", `{"count":5}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db2?schema", labelSchema); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 when replacing a schema but received %d", w.Code)
+	}
+	if w := doRequest(testDBList, http.MethodPut, "/v1/db2/doc7", `{"label":"owl"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but received %d", w.Code)
+	}
+}
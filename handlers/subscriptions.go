@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+)
+
+// The path that reports the stats of the current subscriptions.
+const subscriptionsPath = "/v1/$subscriptions"
+
+// SubscriptionStatsHandler handles GET requests to /v1/$subscriptions. It responds with the
+// stats of every current subscription to a resource the user is an admin of: its backpressure
+// policy and how many events were delivered to and dropped for its client. Subscriptions are
+// identified by number, so the tokens they were made with are never revealed.
+func (databaseList DatabaseList) SubscriptionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, _ := auth.UsernameFromContext(r.Context())
+	stats := databaseList.subscriberHandler.Stats(r.Context(), func(resource string) bool {
+		return databaseList.allowed(username, strings.Split(resource, "/"), auth.RoleAdmin)
+	})
+	response, _ := json.Marshal(stats)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+)
+
+func TestSubscriptionStatsHandler(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: auth.AnyUser, Path: "/", Role: "reader"},
+		{User: "alice", Path: "/db1", Role: "admin"},
+		{User: "admin", Path: "/", Role: "admin"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	subscriberHandler := sse.NewSubscriberHandler(skiplist.NewSkipList[string, sse.DBIndex[string, *sse.Subscriber]](), func() sse.DBIndex[string, *sse.Subscriber] {
+		return skiplist.NewSkipList[string, *sse.Subscriber]()
+	})
+	testDBList := New(&testSchema, subscriberHandler).WithPolicy(policy)
+
+	am := auth.NewAuthManager(time.Hour)
+	tokens := map[string]string{}
+	for _, user := range []string{"admin", "alice", "bob"} {
+		tokens[user], _ = am.Login(user)
+	}
+	handler := am.Middleware(http.HandlerFunc(testDBList.V1Handler))
+	send := func(ctx context.Context, user string, method string, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil).WithContext(ctx)
+		r.Header.Set("Authorization", "Bearer "+tokens[user])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	send(context.Background(), "admin", http.MethodPut, "/v1/db1")
+	send(context.Background(), "admin", http.MethodPut, "/v1/db2")
+
+	// Keep a subscription to each database open during the test
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, target := range []string{"/v1/db1?mode=subscribe&backpressure=drop-newest", "/v1/db2?mode=subscribe"} {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			send(ctx, "bob", http.MethodGet, target)
+		}(target)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	stats := func(user string) []sse.SubscriptionStats {
+		w := send(context.Background(), user, http.MethodGet, subscriptionsPath)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 but received %d", w.Code)
+		}
+		var stats []sse.SubscriptionStats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("Invalid stats %s", w.Body.String())
+		}
+		return stats
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(stats("admin")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the subscriptions")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Users only see the subscriptions to resources they are an admin of
+	if alice := stats("alice"); len(alice) != 1 || alice[0].Resource != "db1" || alice[0].Backpressure != sse.DropNewest {
+		t.Fatalf("Unexpected stats for alice: %+v", alice)
+	}
+	if bob := stats("bob"); len(bob) != 0 {
+		t.Fatalf("Unexpected stats for bob: %+v", bob)
+	}
+	if w := send(context.Background(), "admin", http.MethodPost, subscriptionsPath); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405 but received %d", w.Code)
+	}
+}
+
+// syncRecorder is a ResponseRecorder that can be read while a subscription writes to it.
+type syncRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (s *syncRecorder) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseRecorder.Write(b)
+}
+
+func (s *syncRecorder) body() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseRecorder.Body.String()
+}
+
+// subscribe keeps a subscription made by the target request open until the returned
+// function is called.
+func subscribe(t *testing.T, databaseList DatabaseList, target string) (*syncRecorder, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer test_token")
+	w := &syncRecorder{ResponseRecorder: httptest.NewRecorder()}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		databaseList.V1Handler(w, r)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(databaseList.subscriberHandler.Stats(context.Background(), nil)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the subscription")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return w, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestFilteredSubscription(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	subscriberHandler := sse.NewSubscriberHandler(skiplist.NewSkipList[string, sse.DBIndex[string, *sse.Subscriber]](), func() sse.DBIndex[string, *sse.Subscriber] {
+		return skiplist.NewSkipList[string, *sse.Subscriber]()
+	})
+	testDBList := New(&testSchema, subscriberHandler)
+	doRequest(testDBList, http.MethodPut, "/v1/db", "")
+
+	if w := doRequest(testDBList, http.MethodGet, "/v1/db?mode=subscribe&filter=age", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid filter but received %d", w.Code)
+	}
+
+	// Subscribe to documents from a to m whose age is over 30
+	w, unsubscribe := subscribe(t, testDBList, "/v1/db?mode=subscribe&interval=%5Ba,m%5D&filter=%2Fage%3E30")
+	defer unsubscribe()
+	deadline := time.Now().Add(time.Second)
+
+	doRequest(testDBList, http.MethodPut, "/v1/db/carol", `{"name":"carol","age":20}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db/zoe", `{"name":"zoe","age":50}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db/bob", `{"name":"bob","age":40}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db/carol", `{"name":"carol","age":35}`)
+
+	for !strings.Contains(w.body(), `"path":"db/carol"`) {
+		if time.Now().After(deadline.Add(time.Second)) {
+			t.Fatalf("Timed out waiting for the events, received %s", w.body())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Events arrive in order, so the ones before the last have been filtered out
+	body := w.body()
+	if strings.Contains(body, "db/zoe") || !strings.Contains(body, "db/bob") || strings.Count(body, "data: {") != 2 {
+		t.Fatalf("Unexpected events %s", body)
+	}
+}
+
+func TestSubscriptionEventTypes(t *testing.T) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	subscriberHandler := sse.NewSubscriberHandler(skiplist.NewSkipList[string, sse.DBIndex[string, *sse.Subscriber]](), func() sse.DBIndex[string, *sse.Subscriber] {
+		return skiplist.NewSkipList[string, *sse.Subscriber]()
+	})
+	testDBList := New(&testSchema, subscriberHandler)
+	doRequest(testDBList, http.MethodPut, "/v1/db", "")
+
+	w, unsubscribe := subscribe(t, testDBList, "/v1/db?mode=subscribe")
+	defer unsubscribe()
+
+	doRequest(testDBList, http.MethodPut, "/v1/db/doc", `{"name":"julia","age":22}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db/doc", `{"name":"julia","age":23}`)
+	doRequest(testDBList, http.MethodPatch, "/v1/db/doc", `[{"op":"Increment","path":"/age","value":1}]`)
+	doRequest(testDBList, http.MethodPut, "/v1/db/doc/col/", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db/doc/col/inner", `{"name":"april","age":30}`)
+	doRequest(testDBList, http.MethodDelete, "/v1/db/doc/col/inner", "")
+
+	// Posted documents are created under a generated name, and invalid ones not at all
+	if posted := doRequest(testDBList, http.MethodPost, "/v1/db/doc/col/", `{"name":"zoe"}`); posted.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid document but received %d", posted.Code)
+	}
+	posted := doRequest(testDBList, http.MethodPost, "/v1/db/doc/col/", `{"name":"zoe","age":40}`)
+	var uri map[string]string
+	if err := json.Unmarshal(posted.Body.Bytes(), &uri); posted.Code != http.StatusCreated || err != nil {
+		t.Fatalf("Expected status 201 but received %d: %s", posted.Code, posted.Body.String())
+	}
+	postedPath := strings.TrimPrefix(uri["uri"], "/v1/")
+	doRequest(testDBList, http.MethodDelete, "/v1/db/doc/col/", "")
+	doRequest(testDBList, http.MethodDelete, "/v1/db/doc", "")
+
+	expected := []string{
+		`create {"path":"db/doc"}`,
+		`update {"path":"db/doc"}`,
+		`patch {"path":"db/doc"}`,
+		`create {"path":"db/doc/col"}`,
+		`create {"path":"db/doc/col/inner"}`,
+		`delete {"path":"db/doc/col/inner"}`,
+		`create {"path":"` + postedPath + `"}`,
+		`delete {"path":"db/doc/col"}`,
+		`delete {"path":"db/doc"}`,
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		var received []string
+		for _, message := range strings.Split(w.body(), "\n\n") {
+			var event, data string
+			for _, line := range strings.Split(message, "\n") {
+				name, value, _ := strings.Cut(line, ": ")
+				switch name {
+				case "event":
+					event = value
+				case "data":
+					data = value
+				}
+			}
+			if strings.HasPrefix(data, "{") {
+				received = append(received, event+" "+data)
+			}
+		}
+		if strings.Join(received, ",") == strings.Join(expected, ",") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected events %v but received %v", expected, received)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscriptionOwnership(t *testing.T) {
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: auth.AnyUser, Path: "/", Role: "writer"},
+		{User: "admin", Path: "/", Role: "admin"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	server, tokens, _ := webSocketServer(t, policy, "admin", "alice", "bob")
+	send := func(user string, method string, target string, body string) {
+		r, _ := http.NewRequest(method, server.URL+target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+tokens[user])
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		response.Body.Close()
+	}
+
+	// listen subscribes bob to db and returns the data and ids of the events he is sent
+	listen := func(lastEventID string) (chan [2]string, func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/db?mode=subscribe", nil)
+		r.Header.Set("Authorization", "Bearer "+tokens["bob"])
+		if lastEventID != "" {
+			r.Header.Set("Last-Event-ID", lastEventID)
+		}
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("Subscription failed: %v", err)
+		}
+		events := make(chan [2]string, 10)
+		go func() {
+			defer response.Body.Close()
+			var id string
+			scanner := bufio.NewScanner(response.Body)
+			for scanner.Scan() {
+				name, value, _ := strings.Cut(scanner.Text(), ": ")
+				switch name {
+				case "id":
+					id = value
+				case "data":
+					if strings.HasPrefix(value, "{") {
+						events <- [2]string{value, id}
+					}
+				}
+			}
+		}()
+		t.Cleanup(cancel)
+		return events, cancel
+	}
+	next := func(events chan [2]string) [2]string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for an event")
+			return [2]string{}
+		}
+	}
+
+	send("admin", http.MethodPut, "/v1/db", "")
+	send("admin", http.MethodPut, "/v1/db?ownership=reads", "")
+
+	// Bob is not told about documents he may not read, even if they match his filter
+	events, unsubscribe := listen("")
+	send("alice", http.MethodPut, "/v1/db/a1", `{"name":"alice","age":30}`)
+	send("bob", http.MethodPut, "/v1/db/b1", `{"name":"bob","age":40}`)
+	last := next(events)
+	if last[0] != `{"path":"db/b1"}` {
+		t.Fatalf("Expected the event of db/b1 but received %s", last[0])
+	}
+	unsubscribe()
+
+	// Nor when catching up on the events he missed
+	send("alice", http.MethodPut, "/v1/db/a2", `{"name":"alice","age":31}`)
+	send("bob", http.MethodPut, "/v1/db/b2", `{"name":"bob","age":41}`)
+	events, unsubscribe = listen(last[1])
+	defer unsubscribe()
+	if event := next(events); event[0] != `{"path":"db/b2"}` {
+		t.Fatalf("Expected the event of db/b2 but received %s", event[0])
+	}
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/persist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
+)
+
+// The last element of the path that transaction requests are sent to.
+const transactionPath = "$transaction"
+
+// errConflict is returned from the update checks of a transaction when a document
+// changed after the transaction read it.
+var errConflict = errors.New("document was changed by another request")
+
+// This struct holds the body of a transaction request. The operations are applied
+// in order, and either all of them are committed or none of them are.
+type TransactionRequest struct {
+	Operations []TransactionOperation `json:"operations"`
+}
+
+// This struct represents one operation inside a transaction. Op is PUT, PATCH, or
+// DELETE, and Path is the path of a document relative to the database of the
+// transaction. PUT operations carry the new contents in Doc and may set Mode to
+// nooverwrite, and PATCH operations carry the same patch list as a PATCH request.
+// IfMatch and IfNoneMatch work like the headers of the same name, and are checked
+// against the document as the earlier operations of the transaction left it.
+type TransactionOperation struct {
+	Op          string           `json:"op"`
+	Path        string           `json:"path"`
+	Doc         json.RawMessage  `json:"doc,omitempty"`
+	Mode        string           `json:"mode,omitempty"`
+	Patches     []PatchOperation `json:"patches,omitempty"`
+	IfMatch     string           `json:"ifMatch,omitempty"`
+	IfNoneMatch string           `json:"ifNoneMatch,omitempty"`
+}
+
+// TransactionResponse reports whether a transaction was committed. On success it
+// lists the URI of every changed document. On failure it holds the index of the
+// operation that failed and the reason.
+type TransactionResponse struct {
+	Committed bool     `json:"committed"`
+	URIs      []string `json:"uris,omitempty"`
+	Failed    *int     `json:"failed,omitempty"`
+	Message   string   `json:"message,omitempty"`
+}
+
+// A stagedDocument is the change a transaction makes to one document. It remembers
+// the document as the transaction first read it, so that the update check can tell
+// whether anyone else changed it before the commit.
+type stagedDocument struct {
+	operation     int // index of the first operation on the document
+	path          string
+	documentList  skiplist.DBIndex[string, contents.Document]
+	name          string
+	original      contents.Document
+	originalFound bool
+	result        contents.Document
+	deleted       bool
+	replaced      bool // the document was given an empty list of collections
+}
+
+// transactionError pairs a failure with the status code to report it with.
+type transactionError struct {
+	status  int
+	message string
+}
+
+// TransactionHandler handles POST requests to /v1/{db}/$transaction. The request body
+// holds a list of PUT, PATCH, and DELETE operations on documents anywhere in the
+// database, and they are either all applied or none of them are.
+//
+// Every operation is first evaluated against the current documents without changing
+// anything, so invalid operations fail the transaction before it touches the database.
+// The changes are then committed one document at a time through Upsert, whose update
+// check makes sure that the document is still the one the transaction read. The lock of
+// the database is held from the first evaluation to the last commit, so no other request
+// to the database can read or write in between, while other databases are not held up.
+// Should a document have changed anyway, the documents committed so far are put back the
+// way they were and the transaction fails with a conflict. The same happens, with a 500,
+// if the changes cannot be recorded in the write-ahead log, where they are appended
+// together. Subscribers are only notified once every change has been committed.
+func (databaseList DatabaseList) TransactionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	// Trim /v1/ and the ending /
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	pathList := strings.Split(path, "/")
+	if len(pathList) != 2 || pathList[1] != transactionPath || pathList[0] == "" {
+		respondWithError(w, http.StatusBadRequest, "Transactions must be sent to /v1/{database}/$transaction")
+		return
+	}
+	databaseName := pathList[0]
+
+	var request TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction request body")
+		return
+	}
+	if len(request.Operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Transaction has no operations")
+		return
+	}
+	if _, found := databaseList.databaseList.Find(databaseName); !found {
+		respondWithError(w, http.StatusNotFound, "Database does not exist")
+		return
+	}
+	username, _ := auth.UsernameFromContext(r.Context())
+
+	// No other request to the database may land between reading the documents and committing the changes
+	unlock := databaseList.lockWrites(databaseName)
+	defer unlock()
+
+	// Evaluate every operation without changing the database
+	staged := map[string]*stagedDocument{}
+	order := []*stagedDocument{}
+	for i, op := range request.Operations {
+		stage, failure := databaseList.stageOperation(databaseName, op, staged, username)
+		if failure != nil {
+			respondWithTransactionFailure(w, failure.status, i, failure.message)
+			return
+		}
+		if _, seen := staged[stage.path]; !seen {
+			stage.operation = i
+			staged[stage.path] = stage
+			order = append(order, stage)
+		}
+	}
+
+	// Commit the changes, undoing the committed ones if any document changed since it was read
+	for i, stage := range order {
+		if err := stage.commit(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				order[j].rollback()
+			}
+			respondWithTransactionFailure(w, http.StatusConflict, stage.operation, fmt.Sprintf("Conflict on %s: %v", stage.path, err))
+			return
+		}
+	}
+
+	response := TransactionResponse{Committed: true, URIs: []string{}}
+	changed := []*stagedDocument{}
+	records := []persist.Record{}
+	for _, stage := range order {
+		// Documents created and deleted again inside the transaction never existed outside it
+		if stage.deleted && !stage.originalFound {
+			continue
+		}
+		response.URIs = append(response.URIs, "/v1/"+stage.path)
+		changed = append(changed, stage)
+		records = append(records, stage.record(databaseList))
+	}
+
+	// The changes are recorded in the write-ahead log together, or undone if they cannot be
+	if len(records) > 0 {
+		if err := databaseList.appendRecords(records...); err != nil {
+			for j := len(order) - 1; j >= 0; j-- {
+				order[j].rollback()
+			}
+			respondWithError(w, http.StatusInternalServerError, journalFailed)
+			return
+		}
+	}
+	for _, stage := range changed {
+		if stage.deleted {
+			databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Delete, Path: stage.path, Content: stage.original.Content, Owner: stage.original.Metadata.CreatedBy})
+		} else if stage.originalFound {
+			databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Update, Path: stage.path, Content: stage.result.Content, Owner: stage.result.Metadata.CreatedBy})
+		} else {
+			databaseList.subscriberHandler.Publish(sse.Event{Type: sse.Create, Path: stage.path, Content: stage.result.Content, Owner: stage.result.Metadata.CreatedBy})
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// respondWithTransactionFailure reports that the operation at the given index failed
+// and that nothing was committed.
+func respondWithTransactionFailure(w http.ResponseWriter, statusCode int, index int, message string) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(TransactionResponse{Committed: false, Failed: &index, Message: message})
+}
+
+// stageOperation evaluates one operation of a transaction on top of the changes staged
+// by the operations before it, and returns the staged change to the operation's document.
+func (databaseList DatabaseList) stageOperation(databaseName string, op TransactionOperation, staged map[string]*stagedDocument, username string) (*stagedDocument, *transactionError) {
+	relative := strings.Trim(op.Path, "/")
+	if relative == "" || strings.Contains(relative, "//") || len(strings.Split(relative, "/"))%2 == 0 {
+		return nil, &transactionError{http.StatusBadRequest, fmt.Sprintf("Path %q does not name a document", op.Path)}
+	}
+	path := databaseName + "/" + relative
+	pathList := strings.Split(path, "/")
+	if !databaseList.allowed(username, pathList, auth.RoleWriter) {
+		return nil, &transactionError{http.StatusForbidden, fmt.Sprintf("User %q needs the writer role on /%s", username, path)}
+	}
+
+	// Nothing can be changed under a document the transaction deletes, and a document the
+	// transaction replaces has no collections left
+	for i := 2; i < len(pathList); i += 2 {
+		stage, found := staged[strings.Join(pathList[:i], "/")]
+		if found && stage.deleted {
+			return nil, &transactionError{http.StatusBadRequest, fmt.Sprintf("Document %s is deleted earlier in the transaction", stage.path)}
+		}
+		if found && stage.replaced {
+			return nil, &transactionError{http.StatusNotFound, fmt.Sprintf("Collection for %s does not exist", path)}
+		}
+	}
+
+	stage, found := staged[path]
+	if !found {
+		documentList, found := databaseList.findDocumentList(pathList[:len(pathList)-1])
+		if !found {
+			return nil, &transactionError{http.StatusNotFound, fmt.Sprintf("Collection for %s does not exist", path)}
+		}
+		name := pathList[len(pathList)-1]
+		original, originalFound := documentList.Find(name)
+		stage = &stagedDocument{
+			path:          path,
+			documentList:  documentList,
+			name:          name,
+			original:      original,
+			originalFound: originalFound,
+			result:        original,
+			deleted:       !originalFound,
+		}
+	}
+	exists := !stage.deleted
+
+	precondition := contents.Precondition{IfMatch: op.IfMatch, IfNoneMatch: op.IfNoneMatch}
+	precondition.Owner = databaseList.requiredOwner(username, pathList[:len(pathList)-1], false)
+	if err := precondition.Check(stage.result, exists); errors.Is(err, contents.ErrNotOwner) {
+		return nil, &transactionError{http.StatusForbidden, fmt.Sprintf("Only the user who created %s may change it", path)}
+	} else if err != nil {
+		return nil, &transactionError{http.StatusPreconditionFailed, fmt.Sprintf("Precondition failed for %s", path)}
+	}
+
+	switch strings.ToUpper(op.Op) {
+	case http.MethodPut:
+		var documentContent jsondata.JSONValue
+		if err := json.Unmarshal(op.Doc, &documentContent); err != nil {
+			return nil, &transactionError{http.StatusBadRequest, "Invalid document contents"}
+		}
+		contentBytes, err := json.Marshal(documentContent)
+		if err != nil {
+			return nil, &transactionError{http.StatusBadRequest, "Invalid document contents"}
+		}
+		if exists && op.Mode == "nooverwrite" {
+			return nil, &transactionError{http.StatusPreconditionFailed, "Document exists and mode is nooverwrite"}
+		}
+		if _, err := databaseList.schemaFor(pathList).ValidateDocument(contentBytes); err != nil {
+			return nil, &transactionError{http.StatusBadRequest, "Document contents did not match provided JSON schema"}
+		}
+		stage.write(contentBytes, exists, username, true)
+	case http.MethodPatch:
+		if !exists {
+			return nil, &transactionError{http.StatusNotFound, fmt.Sprintf("Document %s does not exist", path)}
+		}
+		contentBytes, err := patchContent(stage.result.Content, op.Patches)
+		if err != nil {
+			return nil, &transactionError{http.StatusBadRequest, fmt.Sprintf("Patch failed: %v", err)}
+		}
+		if _, err := databaseList.schemaFor(pathList).ValidateDocument(contentBytes); err != nil {
+			return nil, &transactionError{http.StatusBadRequest, "Patched document did not match provided JSON schema"}
+		}
+		stage.write(contentBytes, exists, username, false)
+	case http.MethodDelete:
+		if !exists {
+			return nil, &transactionError{http.StatusNotFound, fmt.Sprintf("Document %s does not exist", path)}
+		}
+		stage.deleted = true
+	default:
+		return nil, &transactionError{http.StatusBadRequest, fmt.Sprintf("Invalid operation type: %v", op.Op)}
+	}
+	return stage, nil
+}
+
+// write stages new contents for the document, updating the metadata the same way
+// contents.PutDocument does. Like a plain PUT, a replacing write drops the collections
+// nested inside the document, while a PATCH keeps them. A document that does not exist
+// at this point of the transaction, even if it was deleted earlier in it, starts out
+// without collections.
+func (stage *stagedDocument) write(content []byte, exists bool, username string, replace bool) {
+	now := time.Now()
+	if !exists {
+		stage.result = contents.Document{
+			Name:     stage.name,
+			Metadata: contents.Metadata{CreatedBy: username, CreatedAt: now.Unix()},
+		}
+	} else if stage.result.Version == stage.original.Version {
+		// Only the first write in the transaction replaces the original revision
+		stage.result.History = contents.RecordRevision(stage.original)
+	}
+	if !exists || replace {
+		stage.result.Collections = storage.New[string, contents.Collection]()
+		stage.replaced = true
+	}
+	stage.result.Content = content
+	stage.result.Version = stage.original.Version + 1
+	stage.result.WrittenAt = now.UnixMilli()
+	stage.result.Metadata.LastModifiedBy = username
+	stage.result.Metadata.LastModifiedAt = now.Unix()
+	stage.deleted = false
+}
+
+// unchanged reports whether the document found in the list is still the one the
+// transaction originally read.
+func (stage *stagedDocument) unchanged(currValue contents.Document, exists bool) bool {
+	if exists != stage.originalFound {
+		return false
+	}
+	return !exists || currValue.Version == stage.original.Version
+}
+
+// commit applies the staged change to the document list. It fails with errConflict
+// if the document is no longer the one the transaction read.
+func (stage *stagedDocument) commit() error {
+	if stage.deleted {
+		if !stage.originalFound {
+			// Created and deleted again inside the transaction
+			if _, exists := stage.documentList.Find(stage.name); exists {
+				return errConflict
+			}
+			return nil
+		}
+		// Verify the document under its lock before removing it
+		_, err := stage.documentList.Upsert(stage.name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+			if !stage.unchanged(currValue, exists) {
+				return currValue, errConflict
+			}
+			return currValue, nil
+		})
+		if err != nil {
+			return err
+		}
+		stage.documentList.Remove(stage.name)
+		return nil
+	}
+
+	_, err := stage.documentList.Upsert(stage.name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+		if !stage.unchanged(currValue, exists) {
+			return currValue, errConflict
+		}
+		return stage.result, nil
+	})
+	return err
+}
+
+// rollback puts the document back the way the transaction found it. If another
+// request changed the document after the commit, that change is kept.
+func (stage *stagedDocument) rollback() {
+	if stage.deleted {
+		if stage.originalFound {
+			stage.documentList.Upsert(stage.name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+				if exists {
+					return currValue, errConflict
+				}
+				return stage.original, nil
+			})
+		}
+		return
+	}
+
+	if !stage.originalFound {
+		if current, found := stage.documentList.Find(stage.name); found && current.Version == stage.result.Version {
+			stage.documentList.Remove(stage.name)
+		}
+		return
+	}
+	stage.documentList.Upsert(stage.name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+		if !exists || currValue.Version != stage.result.Version {
+			return currValue, errConflict
+		}
+		return stage.original, nil
+	})
+}
+
+// record returns the write-ahead log record of the committed change. A document that
+// was only patched is recorded as a patch, so that replaying it keeps its collections.
+func (stage *stagedDocument) record(databaseList DatabaseList) persist.Record {
+	if !stage.deleted && !stage.replaced {
+		return databaseList.record(persist.OpPatch, stage.path)
+	}
+	return databaseList.record(persist.OpPut, stage.path)
+}
+
+// patchContent applies the patch operations to a copy of the document contents and
+// returns the result. The contents passed in are never changed.
+func patchContent(content []byte, patches []PatchOperation) ([]byte, error) {
+	for _, patch := range patches {
+		var jsonContent map[string]interface{}
+		if err := json.Unmarshal(content, &jsonContent); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal document content: %w", err)
+		}
+
+		visitor, err := patchVisitor(patch)
+		if err != nil {
+			return nil, err
+		}
+		if err := visitor.VisitMap(jsonContent); err != nil {
+			return nil, err
+		}
+
+		// Marshal after every operation so the next one sees plain JSON values
+		content, err = json.Marshal(jsonContent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal modified document content: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// patchVisitor returns the visitor that applies a patch operation.
+func patchVisitor(patch PatchOperation) (Visitor, error) {
+	switch patch.Op {
+	case "ArrayAdd":
+		return &ArrayAddVisitor{Path: patch.Path, Value: patch.Value}, nil
+	case "ArrayRemove":
+		return &ArrayRemoveVisitor{Path: patch.Path, Value: patch.Value}, nil
+	case "ObjectAdd":
+		return &ObjectAddVisitor{Path: patch.Path, Value: patch.Value}, nil
+	case "Increment":
+		return &IncrementVisitor{Path: patch.Path, By: patch.Value, Min: patch.Min, Max: patch.Max}, nil
+	case "CompareAndSet":
+		return &CompareAndSetVisitor{Path: patch.Path, Expected: patch.Expected, Value: patch.Value}, nil
+	case "ArrayAddUnique":
+		return &ArrayAddUniqueVisitor{Path: patch.Path, Value: patch.Value, Order: patch.Order}, nil
+	default:
+		return nil, fmt.Errorf("unsupported patch operation: %s", patch.Op)
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// newTransactionTestList returns a database list holding db1 with doc1 and doc2, and
+// a collection col1 inside doc1 holding doc3.
+func newTransactionTestList(t *testing.T) DatabaseList {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	testDBList := New(&testSchema, nil)
+	doRequest(testDBList, http.MethodPut, "/v1/db1", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1", `{"name":"julia","age":22,"tags":[]}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc2", `{"name":"april","age":21}`)
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1/col1", "")
+	doRequest(testDBList, http.MethodPut, "/v1/db1/doc1/col1/doc3", `{"name":"esther","age":41}`)
+	return testDBList
+}
+
+// documentContent returns the contents of the document at the given path, or an empty
+// string if it does not exist.
+func documentContent(testDBList DatabaseList, path string) string {
+	w := doRequest(testDBList, http.MethodGet, path, "")
+	if w.Code != http.StatusOK {
+		return ""
+	}
+	var responses []DocumentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil || len(responses) != 1 {
+		return ""
+	}
+	content, _ := json.Marshal(responses[0].Doc)
+	return string(content)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	testDBList := newTransactionTestList(t)
+	body := `{"operations":[
+		{"op":"PUT","path":"doc4","doc":{"name":"owen","age":30}},
+		{"op":"PATCH","path":"doc1","patches":[{"op":"ArrayAdd","path":"/tags","value":"new"}]},
+		{"op":"PATCH","path":"doc1","patches":[{"op":"ObjectAdd","path":"/age","value":23}]},
+		{"op":"DELETE","path":"doc2"},
+		{"op":"PUT","path":"doc1/col1/doc3","doc":{"name":"esther","age":42}}
+	]}`
+	w := doRequest(testDBList, http.MethodPost, "/v1/db1/$transaction", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but received %d: %s", w.Code, w.Body.String())
+	}
+	var response TransactionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || !response.Committed || len(response.URIs) != 4 {
+		t.Fatalf("Unexpected response: %s", w.Body.String())
+	}
+
+	expected := map[string]string{
+		"/v1/db1/doc4":           `{"age":30,"name":"owen"}`,
+		"/v1/db1/doc1":           `{"age":23,"name":"julia","tags":["new"]}`,
+		"/v1/db1/doc2":           ``,
+		"/v1/db1/doc1/col1/doc3": `{"age":42,"name":"esther"}`,
+	}
+	for path, content := range expected {
+		if got := documentContent(testDBList, path); got != content {
+			t.Fatalf("Expected %s to hold %q but it holds %q", path, content, got)
+		}
+	}
+}
+
+func TestTransactionAllOrNothing(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "missing document", expectedCode: http.StatusNotFound, body: `{"operations":[
+			{"op":"PUT","path":"doc1","doc":{"name":"changed","age":1}},
+			{"op":"PATCH","path":"missing","patches":[{"op":"ObjectAdd","path":"/age","value":1}]}]}`},
+		{name: "schema violation", expectedCode: http.StatusBadRequest, body: `{"operations":[
+			{"op":"DELETE","path":"doc2"},
+			{"op":"PUT","path":"doc1","doc":{"name":"changed"}}]}`},
+		{name: "failed patch", expectedCode: http.StatusBadRequest, body: `{"operations":[
+			{"op":"DELETE","path":"doc2"},
+			{"op":"PATCH","path":"doc1","patches":[{"op":"ArrayAdd","path":"/name","value":1}]}]}`},
+		{name: "invalid operation", expectedCode: http.StatusBadRequest, body: `{"operations":[
+			{"op":"DELETE","path":"doc2"},
+			{"op":"POST","path":"doc1"}]}`},
+		{name: "collection path", expectedCode: http.StatusBadRequest, body: `{"operations":[
+			{"op":"DELETE","path":"doc1/col1"}]}`},
+		{name: "write under deleted document", expectedCode: http.StatusBadRequest, body: `{"operations":[
+			{"op":"DELETE","path":"doc1"},
+			{"op":"PUT","path":"doc1/col1/doc3","doc":{"name":"changed","age":1}}]}`},
+		{name: "nooverwrite", expectedCode: http.StatusPreconditionFailed, body: `{"operations":[
+			{"op":"DELETE","path":"doc2"},
+			{"op":"PUT","path":"doc1","mode":"nooverwrite","doc":{"name":"changed","age":1}}]}`},
+		{name: "stale etag", expectedCode: http.StatusPreconditionFailed, body: `{"operations":[
+			{"op":"DELETE","path":"doc2","ifMatch":"\"1\""},
+			{"op":"PUT","path":"doc1","ifMatch":"\"7\"","doc":{"name":"changed","age":1}}]}`},
+		{name: "empty", expectedCode: http.StatusBadRequest, body: `{"operations":[]}`},
+		{name: "not json", expectedCode: http.StatusBadRequest, body: `blah blah blah`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testDBList := newTransactionTestList(t)
+			w := doRequest(testDBList, http.MethodPost, "/v1/db1/$transaction", tc.body)
+			if w.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+			if documentContent(testDBList, "/v1/db1/doc1") != `{"age":22,"name":"julia","tags":[]}` ||
+				documentContent(testDBList, "/v1/db1/doc2") != `{"age":21,"name":"april"}` ||
+				documentContent(testDBList, "/v1/db1/doc1/col1/doc3") != `{"age":41,"name":"esther"}` {
+				t.Fatalf("A failed transaction should not change any document")
+			}
+		})
+	}
+}
+
+func TestTransactionCollections(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         string
+		expectedCode int
+		kept         bool
+	}{
+		{name: "PUT", expectedCode: http.StatusOK, kept: false, body: `{"operations":[
+			{"op":"PUT","path":"doc1","doc":{"name":"julia","age":23}}]}`},
+		{name: "PATCH", expectedCode: http.StatusOK, kept: true, body: `{"operations":[
+			{"op":"PATCH","path":"doc1","patches":[{"op":"ObjectAdd","path":"/age","value":23}]}]}`},
+		{name: "PATCH then PUT", expectedCode: http.StatusOK, kept: false, body: `{"operations":[
+			{"op":"PATCH","path":"doc1","patches":[{"op":"ObjectAdd","path":"/age","value":23}]},
+			{"op":"PUT","path":"doc1","doc":{"name":"julia","age":23}}]}`},
+		{name: "write under replaced document", expectedCode: http.StatusNotFound, kept: true, body: `{"operations":[
+			{"op":"PUT","path":"doc1","doc":{"name":"julia","age":23}},
+			{"op":"PUT","path":"doc1/col1/doc3","doc":{"name":"esther","age":42}}]}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testDBList := newTransactionTestList(t)
+			w := doRequest(testDBList, http.MethodPost, "/v1/db1/$transaction", tc.body)
+			if w.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d but received %d: %s", tc.expectedCode, w.Code, w.Body.String())
+			}
+			// Like plain requests, a PUT replaces the collections nested in the document and a PATCH keeps them
+			kept := documentContent(testDBList, "/v1/db1/doc1/col1/doc3") == `{"age":41,"name":"esther"}`
+			if kept != tc.kept {
+				t.Fatalf("Expected col1 to be kept: %v, but it was kept: %v", tc.kept, kept)
+			}
+		})
+	}
+}
+
+func TestTransactionWithConcurrentWrites(t *testing.T) {
+	testDBList := newTransactionTestList(t)
+	body := `{"operations":[
+		{"op":"PUT","path":"doc1","doc":{"name":"julia","age":1}},
+		{"op":"PUT","path":"doc2","doc":{"name":"april","age":1}}
+	]}`
+
+	// Plain writes to the same documents wait for the transactions instead of failing them
+	var wg sync.WaitGroup
+	codes := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			codes <- doRequest(testDBList, http.MethodPost, "/v1/db1/$transaction", body).Code
+		}()
+		go func() {
+			defer wg.Done()
+			doRequest(testDBList, http.MethodPut, "/v1/db1/doc2", `{"name":"april","age":99}`)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("Expected every transaction to commit but one received status %d", code)
+		}
+	}
+}
+
+func TestTransactionWithConcurrentReads(t *testing.T) {
+	testDBList := newTransactionTestList(t)
+
+	// Every transaction moves age from doc2 to doc1, so the ages always add up to 43
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			body := fmt.Sprintf(`{"operations":[
+				{"op":"PUT","path":"doc1","doc":{"name":"julia","age":%d}},
+				{"op":"PUT","path":"doc2","doc":{"name":"april","age":%d}}
+			]}`, i, 43-i)
+			doRequest(testDBList, http.MethodPost, "/v1/db1/$transaction", body)
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		w := doRequest(testDBList, http.MethodGet, "/v1/db1", "")
+		var responses []DocumentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+			t.Fatalf("Invalid listing: %s", w.Body.String())
+		}
+		total := 0.0
+		for _, response := range responses {
+			var doc struct{ Age float64 }
+			content, _ := json.Marshal(response.Doc)
+			json.Unmarshal(content, &doc)
+			total += doc.Age
+		}
+		if total != 43 {
+			t.Fatalf("Expected the ages to add up to 43 but the listing holds %s", w.Body.String())
+		}
+	}
+	wg.Wait()
+}
+
+func TestTransactionConflict(t *testing.T) {
+	testDBList := newTransactionTestList(t)
+	db1, _ := testDBList.databaseList.Find("db1")
+
+	// Stage changes to two documents, then change the second one behind the transaction's back
+	staged := map[string]*stagedDocument{}
+	var order []*stagedDocument
+	for _, op := range []TransactionOperation{
+		{Op: "PUT", Path: "doc1", Doc: json.RawMessage(`{"name":"changed","age":1}`)},
+		{Op: "DELETE", Path: "doc2"},
+	} {
+		stage, failure := testDBList.stageOperation("db1", op, staged, "julia")
+		if failure != nil {
+			t.Fatalf("Operation could not be staged: %s", failure.message)
+		}
+		staged[stage.path] = stage
+		order = append(order, stage)
+	}
+	contents.PutDocument(db1.Documents, "doc2", []byte(`{"name":"april","age":99}`), "april", "overwrite", testDBList.schema)
+
+	if err := order[0].commit(); err != nil {
+		t.Fatalf("First document should commit: %v", err)
+	}
+	if err := order[1].commit(); !errors.Is(err, errConflict) {
+		t.Fatalf("Expected a conflict but received %v", err)
+	}
+	order[0].rollback()
+
+	if got := documentContent(testDBList, "/v1/db1/doc1"); got != `{"age":22,"name":"julia","tags":[]}` {
+		t.Fatalf("Rollback did not restore doc1, it holds %q", got)
+	}
+	if got := documentContent(testDBList, "/v1/db1/doc2"); got != `{"age":99,"name":"april"}` {
+		t.Fatalf("The concurrent change to doc2 should be kept, it holds %q", got)
+	}
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/websocket"
+)
+
+// Types of the messages clients send over /ws.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsRequest     = "request"
+)
+
+// Types of the messages the server sends over /ws.
+const (
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsEvent        = "event"
+	wsResponse     = "response"
+	wsError        = "error"
+)
+
+// This struct represents a message a client sends over /ws. Type is "subscribe",
+// "unsubscribe", or "request", and the reply to the message carries its ID. Path is a
+// path of the /v1/ API, where the /v1 prefix may be left out.
+//
+// Subscriptions take the parameters of GET ...?mode=subscribe: LastEventID is the id of the
+// last event received before reconnecting, and Backpressure, Interval, and Filter are the
+// query parameters of the same name. Requests are sent like the operations of a batch, see
+// BatchOperation.
+type WebSocketMessage struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+
+	LastEventID  string `json:"lastEventId,omitempty"`
+	Backpressure string `json:"backpressure,omitempty"`
+	Interval     string `json:"interval,omitempty"`
+	Filter       string `json:"filter,omitempty"`
+
+	Method  string            `json:"method,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// This struct represents a message the server sends over /ws. Type is "subscribed" or
+// "unsubscribed" in reply to those messages, "response" in reply to a request, "error" if
+// a message failed, or "event" for an event of a subscription. Replies carry the ID of the
+// message they answer.
+//
+// Events carry the path of the subscription and the event, its id, and its data as SSE
+// subscriptions send them. Responses carry the status, headers, and body of the request's
+// response, see BatchResult, and errors carry a status and a message. A subscription that
+// ends without being unsubscribed, because its client fell behind, is sent an
+// "unsubscribed" message with an error.
+type WebSocketReply struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+
+	Event   sse.EventType   `json:"event,omitempty"`
+	EventID uint64          `json:"eventId,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// wsSession holds the state of one /ws connection.
+type wsSession struct {
+	databaseList DatabaseList
+	r            *http.Request // the handshake, which carries the user and their token
+	conn         *websocket.Conn
+	ctx          context.Context
+	token        string
+
+	mu            sync.Mutex
+	subscriptions map[string]*wsSubscription // by subscribed path
+	wg            sync.WaitGroup
+}
+
+// wsSessions tracks the open /ws connections of a database list, so they can be closed
+// when the server shuts down.
+type wsSessions struct {
+	mu     sync.Mutex
+	closed bool // set once CloseWebSockets was called, after which connections are refused
+	active map[*wsSession]struct{}
+	wg     sync.WaitGroup // counts the handlers of the active connections
+}
+
+// add starts tracking the session. It returns false if the connections were closed.
+func (sessions *wsSessions) add(session *wsSession) bool {
+	if sessions == nil {
+		return true
+	}
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	if sessions.closed {
+		return false
+	}
+	sessions.active[session] = struct{}{}
+	sessions.wg.Add(1)
+	return true
+}
+
+// remove stops tracking the session once its handler is done with it.
+func (sessions *wsSessions) remove(session *wsSession) {
+	if sessions == nil {
+		return
+	}
+	sessions.mu.Lock()
+	delete(sessions.active, session)
+	sessions.mu.Unlock()
+	sessions.wg.Done()
+}
+
+// CloseWebSockets closes every /ws connection and waits until their handlers are done, so
+// no request sent over them changes the databases afterwards. Connections opened later are
+// refused. Since http.Server.Close leaves connections that were upgraded to WebSockets
+// open, servers call it when they shut down, before taking their final snapshot.
+func (databaseList DatabaseList) CloseWebSockets() {
+	sessions := databaseList.webSockets
+	if sessions == nil {
+		return
+	}
+	sessions.mu.Lock()
+	sessions.closed = true
+	for session := range sessions.active {
+		// Closing never waits on a blocked write, and the handler stops reading messages
+		// once its connection is closed
+		session.conn.Close()
+	}
+	sessions.mu.Unlock()
+	sessions.wg.Wait()
+}
+
+// wsSubscription is a subscription of a /ws connection.
+type wsSubscription struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed once no more events of it are sent
+}
+
+// wsStream sends the events of a subscription over a /ws connection.
+type wsStream struct {
+	session  *wsSession
+	resource string
+}
+
+func (stream wsStream) Send(event sse.EventType, id uint64, data string) error {
+	payload := json.RawMessage(data)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(data)
+	}
+	return stream.session.send(WebSocketReply{Type: wsEvent, Path: stream.resource, Event: event, EventID: id, Data: payload})
+}
+
+func (stream wsStream) KeepAlive() error {
+	return stream.session.conn.Ping()
+}
+
+// WebSocketHandler handles requests to /ws, which must be WebSocket handshakes sent with a
+// bearer token. Over one connection a client can subscribe to and unsubscribe from several
+// paths, and send requests to the /v1/ API, as the user the token belongs to. Every
+// message is a JSON text message, see WebSocketMessage and WebSocketReply. Messages are
+// handled in the order they arrive, while events are sent as they happen. Closing the
+// connection ends its subscriptions.
+func (databaseList DatabaseList) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// The auth middleware has already checked the token, which is read the way V1Handler does
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+		return
+	}
+	token := parts[1]
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	session := &wsSession{
+		databaseList:  databaseList,
+		r:             r,
+		conn:          conn,
+		ctx:           ctx,
+		token:         token,
+		subscriptions: map[string]*wsSubscription{},
+	}
+	if !databaseList.webSockets.add(session) {
+		// The server is shutting down
+		cancel()
+		conn.Close()
+		return
+	}
+	defer func() {
+		// End every subscription before the connection goes away
+		cancel()
+		session.wg.Wait()
+		conn.Close()
+		databaseList.webSockets.remove(session)
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.TextMessage {
+			session.send(WebSocketReply{Type: wsError, Status: http.StatusBadRequest, Error: "Messages must be JSON text"})
+			continue
+		}
+		var message WebSocketMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			session.send(WebSocketReply{Type: wsError, Status: http.StatusBadRequest, Error: "Invalid message"})
+			continue
+		}
+		session.handle(message)
+	}
+}
+
+// send writes the reply to the connection.
+func (session *wsSession) send(reply WebSocketReply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	return session.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// fail replies to the message with an error.
+func (session *wsSession) fail(message WebSocketMessage, status int, reason string) {
+	session.send(WebSocketReply{ID: message.ID, Type: wsError, Path: message.Path, Status: status, Error: reason})
+}
+
+// handle answers one message of the client.
+func (session *wsSession) handle(message WebSocketMessage) {
+	switch message.Type {
+	case wsSubscribe:
+		session.subscribe(message)
+	case wsUnsubscribe:
+		session.unsubscribe(message)
+	case wsRequest:
+		result := session.databaseList.runBatchOperation(session.r, BatchOperation{
+			Method:  message.Method,
+			Path:    message.Path,
+			Body:    message.Body,
+			Headers: message.Headers,
+		})
+		session.send(WebSocketReply{ID: message.ID, Type: wsResponse, Path: message.Path, Status: result.Status, Headers: result.Headers, Body: result.Body})
+	default:
+		session.fail(message, http.StatusBadRequest, fmt.Sprintf("Unknown message type %q", message.Type))
+	}
+}
+
+// resource returns the subscription path of the message without the /v1 prefix, and
+// whether it is a valid path.
+func (message WebSocketMessage) resource() (string, bool) {
+	resource := strings.Trim(strings.TrimPrefix(message.Path, "/v1/"), "/")
+	return resource, resource != "" && !strings.Contains(resource, "//")
+}
+
+// subscribe starts streaming the events of the message's path to the client.
+func (session *wsSession) subscribe(message WebSocketMessage) {
+	resource, valid := message.resource()
+	if !valid {
+		session.fail(message, http.StatusBadRequest, "Invalid path")
+		return
+	}
+	if session.databaseList.subscriberHandler == nil {
+		session.fail(message, http.StatusServiceUnavailable, "Subscriptions are not available")
+		return
+	}
+	username, _ := auth.UsernameFromContext(session.r.Context())
+	if !session.databaseList.allowed(username, strings.Split(resource, "/"), auth.RoleReader) {
+		session.fail(message, http.StatusForbidden, fmt.Sprintf("User %q needs the %s role on /%s for this request", username, auth.RoleReader, resource))
+		return
+	}
+
+	// The parameters are those of subscribing over SSE, and the user is only sent events
+	// about documents they may read
+	filter := sse.Filter{Readable: session.databaseList.readableEvents(username)}
+	if message.Interval != "" {
+		keys, err := parseInterval(message.Interval)
+		if err != nil {
+			session.fail(message, http.StatusBadRequest, fmt.Sprintf("Invalid interval: %v", err))
+			return
+		}
+		filter.Keys = keys
+	}
+	if message.Filter != "" {
+		content, err := query.Parse(message.Filter)
+		if err != nil {
+			session.fail(message, http.StatusBadRequest, fmt.Sprintf("Invalid filter: %v", err))
+			return
+		}
+		filter.Content = content
+	}
+	policy, err := sse.ParseBackpressure(message.Backpressure)
+	if err != nil {
+		session.fail(message, http.StatusBadRequest, fmt.Sprintf("Invalid backpressure: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(session.ctx)
+	subscription, err := session.databaseList.subscriberHandler.Subscribe(ctx, resource, session.token, filter, policy, message.LastEventID)
+	if err != nil {
+		cancel()
+		session.fail(message, http.StatusConflict, "Already subscribed to "+resource)
+		return
+	}
+	current := &wsSubscription{cancel: cancel, done: make(chan struct{})}
+	session.mu.Lock()
+	session.subscriptions[resource] = current
+	session.mu.Unlock()
+
+	// Reply before the stream sends its first event
+	session.send(WebSocketReply{ID: message.ID, Type: wsSubscribed, Path: resource})
+	session.wg.Add(1)
+	go func() {
+		defer session.wg.Done()
+		err := session.databaseList.subscriberHandler.Stream(subscription, wsStream{session: session, resource: resource})
+		close(current.done)
+
+		// Tell the client about subscriptions that ended on their own
+		session.mu.Lock()
+		ended := session.subscriptions[resource] == current
+		if ended {
+			delete(session.subscriptions, resource)
+		}
+		session.mu.Unlock()
+		if ended && ctx.Err() == nil {
+			reason := "Subscription ended"
+			if errors.Is(err, sse.ErrDisconnected) {
+				reason = "Subscription fell behind, subscribe again with lastEventId"
+			}
+			session.send(WebSocketReply{Type: wsUnsubscribed, Path: resource, Error: reason})
+		}
+		cancel()
+	}()
+}
+
+// unsubscribe ends the subscription to the message's path.
+func (session *wsSession) unsubscribe(message WebSocketMessage) {
+	resource, _ := message.resource()
+	session.mu.Lock()
+	subscription, found := session.subscriptions[resource]
+	delete(session.subscriptions, resource)
+	session.mu.Unlock()
+	if !found {
+		session.fail(message, http.StatusNotFound, "Not subscribed to "+resource)
+		return
+	}
+
+	// No events of the subscription are sent after the reply
+	subscription.cancel()
+	<-subscription.done
+	session.send(WebSocketReply{ID: message.ID, Type: wsUnsubscribed, Path: resource})
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/websocket"
+)
+
+// wsClient reads the replies of a /ws connection in the background.
+type wsClient struct {
+	conn    *websocket.Conn
+	replies chan WebSocketReply
+}
+
+// dialWebSocket opens a /ws connection to the server as the holder of the token.
+func dialWebSocket(t *testing.T, server *httptest.Server, token string) *wsClient {
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	client := &wsClient{conn: conn, replies: make(chan WebSocketReply, 100)}
+	go func() {
+		defer close(client.replies)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var reply WebSocketReply
+			json.Unmarshal(data, &reply)
+			client.replies <- reply
+		}
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return client
+}
+
+func (client *wsClient) send(t *testing.T, message string) {
+	if err := client.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+}
+
+// summary describes the reply in one line for comparing it.
+func (reply WebSocketReply) summary() string {
+	switch reply.Type {
+	case wsEvent:
+		return fmt.Sprintf("event %s %s %s", reply.Path, reply.Event, reply.Data)
+	case wsResponse, wsError:
+		return fmt.Sprintf("%s %s %d", reply.Type, reply.ID, reply.Status)
+	default:
+		return fmt.Sprintf("%s %s %s", reply.Type, reply.ID, reply.Path)
+	}
+}
+
+// expect waits for the expected replies, which may arrive in any order.
+func (client *wsClient) expect(t *testing.T, expected ...string) {
+	missing := map[string]int{}
+	for _, summary := range expected {
+		missing[summary]++
+	}
+	timeout := time.After(time.Second)
+	for received := 0; received < len(expected); received++ {
+		select {
+		case reply, open := <-client.replies:
+			if !open {
+				t.Fatalf("Connection closed while waiting for %v", missing)
+			}
+			summary := reply.summary()
+			if missing[summary] == 0 {
+				t.Fatalf("Unexpected reply %q while waiting for %v", summary, missing)
+			}
+			missing[summary]--
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %v", missing)
+		}
+	}
+}
+
+// webSocketServer starts a server with /ws and /v1/ routes for the users, and returns their
+// tokens and the database list it serves.
+func webSocketServer(t *testing.T, policy *auth.Policy, users ...string) (*httptest.Server, map[string]string, DatabaseList) {
+	testSchema, err := jsondata.New("../schema1.json")
+	if err != nil {
+		t.Fatalf("Test schema could not be successfully created")
+	}
+	subscriberHandler := sse.NewSubscriberHandler(skiplist.NewSkipList[string, sse.DBIndex[string, *sse.Subscriber]](), func() sse.DBIndex[string, *sse.Subscriber] {
+		return skiplist.NewSkipList[string, *sse.Subscriber]()
+	})
+	databaseList := New(&testSchema, subscriberHandler).WithPolicy(policy)
+
+	am := auth.NewAuthManager(time.Hour)
+	tokens := map[string]string{}
+	for _, user := range users {
+		tokens[user], _ = am.Login(user)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", am.Middleware(http.HandlerFunc(databaseList.V1Handler)))
+	mux.Handle("/ws", am.Middleware(http.HandlerFunc(databaseList.WebSocketHandler)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, tokens, databaseList
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	server, tokens, _ := webSocketServer(t, nil, "alice")
+
+	// Connections need a valid token
+	_, response, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/ws", http.Header{"Authorization": {"Bearer wrong"}})
+	if err == nil || response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for an invalid token")
+	}
+
+	client := dialWebSocket(t, server, tokens["alice"])
+	client.send(t, `{"id":"1","type":"request","method":"PUT","path":"/v1/db"}`)
+	client.send(t, `{"id":"2","type":"request","method":"PUT","path":"/v1/other"}`)
+	client.expect(t, "response 1 201", "response 2 201")
+
+	// One connection subscribes to several paths
+	client.send(t, `{"id":"3","type":"subscribe","path":"/v1/db"}`)
+	client.send(t, `{"id":"4","type":"subscribe","path":"other"}`)
+	client.expect(t,
+		"subscribed 3 db", `event db update "Successfully connected!"`,
+		"subscribed 4 other", `event other update "Successfully connected!"`)
+
+	// Requests are answered, and their events are sent to the subscriptions
+	client.send(t, `{"id":"5","type":"request","method":"PUT","path":"/v1/db/doc","body":{"name":"julia","age":22}}`)
+	client.expect(t, "response 5 201", `event db create {"path":"db/doc"}`)
+	client.send(t, `{"id":"6","type":"request","method":"PATCH","path":"db/doc","body":[{"op":"Increment","path":"/age","value":1}]}`)
+	client.expect(t, "response 6 200", `event db patch {"path":"db/doc"}`)
+	client.send(t, `{"id":"7","type":"request","method":"GET","path":"/v1/db/doc"}`)
+	client.expect(t, "response 7 200")
+	client.send(t, `{"id":"8","type":"request","method":"PUT","path":"/v1/other/doc","body":{"name":"april","age":30}}`)
+	client.expect(t, "response 8 201", `event other create {"path":"other/doc"}`)
+
+	// Unsubscribed paths send no more events
+	client.send(t, `{"id":"9","type":"unsubscribe","path":"/v1/db"}`)
+	client.expect(t, "unsubscribed 9 db")
+	client.send(t, `{"id":"10","type":"request","method":"DELETE","path":"/v1/db/doc"}`)
+	client.send(t, `{"id":"11","type":"request","method":"DELETE","path":"/v1/other/doc"}`)
+	client.expect(t, "response 10 204", "response 11 204", `event other delete {"path":"other/doc"}`)
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: "alice", Path: "/", Role: "admin"},
+		{User: "bob", Path: "/public", Role: "reader"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	server, tokens, _ := webSocketServer(t, policy, "alice", "bob")
+	alice := dialWebSocket(t, server, tokens["alice"])
+	bob := dialWebSocket(t, server, tokens["bob"])
+
+	tests := []struct {
+		name     string
+		client   *wsClient
+		message  string
+		expected []string
+	}{
+		{"invalid JSON", alice, `{"id":`, []string{"error  400"}},
+		{"unknown type", alice, `{"id":"1","type":"publish","path":"db"}`, []string{"error 1 400"}},
+		{"invalid path", alice, `{"id":"2","type":"subscribe","path":"/v1/"}`, []string{"error 2 400"}},
+		{"invalid interval", alice, `{"id":"3","type":"subscribe","path":"db","interval":"[a"}`, []string{"error 3 400"}},
+		{"invalid filter", alice, `{"id":"4","type":"subscribe","path":"db","filter":"age"}`, []string{"error 4 400"}},
+		{"invalid backpressure", alice, `{"id":"5","type":"subscribe","path":"db","backpressure":"never"}`, []string{"error 5 400"}},
+		{"not subscribed", alice, `{"id":"6","type":"unsubscribe","path":"db"}`, []string{"error 6 404"}},
+		{"forbidden subscription", bob, `{"id":"7","type":"subscribe","path":"/v1/private"}`, []string{"error 7 403"}},
+		{"forbidden request", bob, `{"id":"8","type":"request","method":"PUT","path":"/v1/public"}`, []string{"response 8 403"}},
+		{"subscribe", bob, `{"id":"9","type":"subscribe","path":"/v1/public"}`, []string{"subscribed 9 public", `event public update "Successfully connected!"`}},
+		{"subscribe twice", bob, `{"id":"10","type":"subscribe","path":"/v1/public"}`, []string{"error 10 409"}},
+		{"subscription request", alice, `{"id":"11","type":"request","method":"GET","path":"/v1/db?mode=subscribe"}`, []string{"response 11 400"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.send(t, tt.message)
+			tt.client.expect(t, tt.expected...)
+		})
+	}
+}
+
+func TestWebSocketOwnership(t *testing.T) {
+	policy, err := auth.NewPolicy([]auth.Grant{
+		{User: auth.AnyUser, Path: "/", Role: "writer"},
+		{User: "admin", Path: "/", Role: "admin"},
+	})
+	if err != nil {
+		t.Fatalf("Test policy could not be created: %v", err)
+	}
+	server, tokens, _ := webSocketServer(t, policy, "admin", "alice", "bob")
+	admin := dialWebSocket(t, server, tokens["admin"])
+	alice := dialWebSocket(t, server, tokens["alice"])
+	bob := dialWebSocket(t, server, tokens["bob"])
+	admin.send(t, `{"id":"1","type":"request","method":"PUT","path":"/v1/db"}`)
+	admin.expect(t, "response 1 201")
+	admin.send(t, `{"id":"2","type":"request","method":"PUT","path":"/v1/db?ownership=reads"}`)
+	admin.expect(t, "response 2 200")
+
+	bob.send(t, `{"id":"3","type":"subscribe","path":"/v1/db","filter":"/age > 20"}`)
+	bob.expect(t, "subscribed 3 db", `event db update "Successfully connected!"`)
+
+	// Bob is not told about documents he may not read, even if they match his filter
+	alice.send(t, `{"id":"4","type":"request","method":"PUT","path":"/v1/db/a1","body":{"name":"alice","age":30}}`)
+	alice.expect(t, "response 4 201")
+	bob.send(t, `{"id":"5","type":"request","method":"PUT","path":"/v1/db/b1","body":{"name":"bob","age":40}}`)
+	bob.expect(t, "response 5 201", `event db create {"path":"db/b1"}`)
+}
+
+func TestCloseWebSockets(t *testing.T) {
+	server, tokens, databaseList := webSocketServer(t, nil, "alice")
+	client := dialWebSocket(t, server, tokens["alice"])
+	client.send(t, `{"id":"1","type":"request","method":"PUT","path":"/v1/db"}`)
+	client.send(t, `{"id":"2","type":"subscribe","path":"/v1/db"}`)
+	client.expect(t, "response 1 201", "subscribed 2 db", `event db update "Successfully connected!"`)
+
+	// Closing waits for the open connections, and later connections are refused
+	closed := make(chan struct{})
+	go func() {
+		databaseList.CloseWebSockets()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out closing the connections")
+	}
+	late := dialWebSocket(t, server, tokens["alice"])
+	for _, client := range []*wsClient{client, late} {
+		select {
+		case reply, open := <-client.replies:
+			if open {
+				t.Fatalf("Expected the connection to be closed but received %q", reply.summary())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for the connection to close")
+		}
+	}
+}
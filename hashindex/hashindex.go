@@ -0,0 +1,184 @@
+// Package hashindex contains a DBIndex implementation that keeps its values in a
+// lock-striped hash table, and keeps its keys in a separate skiplist so that range
+// queries still return the values in key order.
+
+package hashindex
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"sync"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// Number of locks that the keys of a HashIndex are spread over.
+const stripes = 64
+
+// This struct is a drop-in replacement for a skiplist. Each key belongs to one of a
+// fixed set of stripes, and each stripe holds a map from its keys to their values
+// guarded by its own lock, so writes to different stripes never wait for each other.
+// The keys of every stripe are also kept in one skiplist for range queries, which
+// writers to different keys update at the same time too.
+type HashIndex[K cmp.Ordered, V any] struct {
+	buckets [stripes]bucket[K, V]
+	keys    *skiplist.SkipList[K, struct{}] // every key in the index, only changed while holding its bucket lock
+}
+
+// This struct is a single stripe of a HashIndex.
+type bucket[K cmp.Ordered, V any] struct {
+	mu     sync.RWMutex
+	values map[K]V
+}
+
+// New initializes a new empty hash index.
+func New[K cmp.Ordered, V any]() *HashIndex[K, V] {
+	index := &HashIndex[K, V]{keys: skiplist.NewSkipList[K, struct{}]()}
+	for i := range index.buckets {
+		index.buckets[i].values = make(map[K]V)
+	}
+	return index
+}
+
+// bucketOf returns the stripe that holds the given key.
+func (index *HashIndex[K, V]) bucketOf(key K) *bucket[K, V] {
+	h := fnv.New32a()
+	if s, ok := any(key).(string); ok {
+		h.Write([]byte(s))
+	} else {
+		fmt.Fprint(h, key)
+	}
+	return &index.buckets[h.Sum32()%stripes]
+}
+
+// Find returns the value stored under the given key, and false if there is none.
+func (index *HashIndex[K, V]) Find(key K) (foundValue V, found bool) {
+	b := index.bucketOf(key)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	foundValue, found = b.values[key]
+	return foundValue, found
+}
+
+// Upsert either updates the value stored under the given key or inserts a new one, using
+// the value returned by the check function. The check function runs while the key's
+// stripe is locked, so no other write to the key can happen between the check and the
+// write. If the check function returns an error, nothing is changed and the function
+// returns false and the error.
+func (index *HashIndex[K, V]) Upsert(key K, check skiplist.UpdateCheck[K, V]) (updated bool, err error) {
+	b := index.bucketOf(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	currValue, exists := b.values[key]
+	newValue, err := check(key, currValue, exists)
+	if err != nil {
+		return false, err
+	}
+	b.values[key] = newValue
+
+	// New keys also go into the sorted index
+	if !exists {
+		index.keys.Upsert(key, func(key K, currValue struct{}, exists bool) (struct{}, error) {
+			return struct{}{}, nil
+		})
+	}
+	return true, nil
+}
+
+// Remove removes the given key and returns the value that was stored under it. If the
+// key is not found, the function returns an empty value and false.
+func (index *HashIndex[K, V]) Remove(key K) (removedValue V, removed bool) {
+	b := index.bucketOf(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removedValue, removed = b.values[key]
+	if !removed {
+		return removedValue, false
+	}
+	delete(b.values, key)
+	index.keys.Remove(key)
+	return removedValue, true
+}
+
+// Query returns the values of the keys between start and end, inclusive, in key order.
+// Like in SkipList.Query, an empty string for start or end leaves that side of the range
+// open. The values are collected from a snapshot, so they are consistent.
+func (index *HashIndex[K, V]) Query(ctx context.Context, start K, end K) (results []V, err error) {
+	results = []V{}
+	for _, value := range index.Snapshot(ctx, start, end) {
+		results = append(results, value)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryRange returns the values of the keys in the range, in key order, like Query does
+// for a range with both bounds included.
+func (index *HashIndex[K, V]) QueryRange(ctx context.Context, keys skiplist.Range[K]) (results []V, err error) {
+	return skiplist.QueryRange[K, V](ctx, index, keys)
+}
+
+// All returns an iterator over the keys and values between start and end, inclusive, in
+// key order. It walks the sorted keys and looks up each value when the iteration reaches
+// its key, so writes that happen during the iteration may or may not be seen.
+func (index *HashIndex[K, V]) All(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return index.values(index.keys.All(ctx, start, end))
+}
+
+// Backward returns an iterator over the keys and values between start and end, inclusive,
+// in descending key order. Like in All, each value is looked up when the iteration
+// reaches its key.
+func (index *HashIndex[K, V]) Backward(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return index.values(index.keys.Backward(ctx, start, end))
+}
+
+// values returns an iterator over the given keys and the values stored under them. Keys
+// that were removed by the time the iteration reaches them are skipped.
+func (index *HashIndex[K, V]) values(keys iter.Seq2[K, struct{}]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key := range keys {
+			value, found := index.Find(key)
+			if found && !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot returns an iterator over the keys and values between start and end like All
+// does, but every iteration returns the range as it was when that iteration began. The
+// range is copied while every stripe is locked for reading, which only blocks writers
+// for as long as the copy takes.
+func (index *HashIndex[K, V]) Snapshot(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		// Keys only change while their stripe is locked, so none change during the copy
+		for i := range index.buckets {
+			index.buckets[i].mu.RLock()
+		}
+		var keys []K
+		var values []V
+		for key := range index.keys.All(context.Background(), start, end) {
+			keys = append(keys, key)
+			values = append(values, index.bucketOf(key).values[key])
+		}
+		for i := range index.buckets {
+			index.buckets[i].mu.RUnlock()
+		}
+
+		for i, key := range keys {
+			if ctx.Err() != nil {
+				return
+			}
+			if !yield(key, values[i]) {
+				return
+			}
+		}
+	}
+}
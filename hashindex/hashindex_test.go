@@ -0,0 +1,175 @@
+package hashindex
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/stretchr/testify/assert"
+)
+
+// countCheck inserts 1 for new keys and adds 1 to existing ones.
+func countCheck(key string, currValue int, exists bool) (int, error) {
+	if exists {
+		return currValue + 1, nil
+	}
+	return 1, nil
+}
+
+func TestHashIndexUpsertAndFind(t *testing.T) {
+	index := New[string, int]()
+	updated, err := index.Upsert("key1", countCheck)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	index.Upsert("key1", countCheck)
+
+	val, found := index.Find("key1")
+	assert.True(t, found)
+	assert.Equal(t, 2, val)
+
+	// A failing check leaves the index unchanged
+	updated, err = index.Upsert("key2", func(key string, currValue int, exists bool) (int, error) {
+		return 0, errors.New("rejected")
+	})
+	assert.Error(t, err)
+	assert.False(t, updated)
+	_, found = index.Find("key2")
+	assert.False(t, found)
+	results, _ := index.Query(context.TODO(), "", "")
+	assert.Equal(t, []int{2}, results)
+}
+
+func TestHashIndexRemove(t *testing.T) {
+	index := New[string, int]()
+	index.Upsert("key1", countCheck)
+	index.Upsert("key2", countCheck)
+
+	removedValue, removed := index.Remove("key1")
+	assert.True(t, removed)
+	assert.Equal(t, 1, removedValue)
+	_, removed = index.Remove("key1")
+	assert.False(t, removed)
+
+	_, found := index.Find("key1")
+	assert.False(t, found)
+	// The key is gone from the sorted keys as well
+	var keys []string
+	for key := range index.keys.All(context.TODO(), "", "") {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"key2"}, keys)
+}
+
+func TestHashIndexQuery(t *testing.T) {
+	index := New[string, string]()
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		index.Upsert(key, func(key string, currValue string, exists bool) (string, error) {
+			return key, nil
+		})
+	}
+
+	testCases := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{start: "", end: "", expected: []string{"a", "b", "c", "d", "e"}},
+		{start: "b", end: "d", expected: []string{"b", "c", "d"}},
+		{start: "bb", end: "dd", expected: []string{"c", "d"}},
+		{start: "", end: "b", expected: []string{"a", "b"}},
+		{start: "d", end: "", expected: []string{"d", "e"}},
+		{start: "x", end: "", expected: []string{}},
+		{start: "d", end: "b", expected: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.start+"-"+tc.end, func(t *testing.T) {
+			results, err := index.Query(context.TODO(), tc.start, tc.end)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, results)
+		})
+	}
+}
+
+func TestHashIndexQueryRange(t *testing.T) {
+	index := New[string, string]()
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		index.Upsert(key, func(key string, currValue string, exists bool) (string, error) {
+			return key, nil
+		})
+	}
+
+	results, err := index.QueryRange(context.TODO(), skiplist.Range[string]{Start: "b", End: "d", ExcludeStart: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d"}, results)
+	results, err = index.QueryRange(context.TODO(), skiplist.Range[string]{End: "c", ExcludeEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, results)
+}
+
+func TestHashIndexBackward(t *testing.T) {
+	index := New[string, string]()
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		index.Upsert(key, func(key string, currValue string, exists bool) (string, error) {
+			return key, nil
+		})
+	}
+
+	keys := []string{}
+	for key := range index.Backward(context.TODO(), "b", "d") {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"d", "c", "b"}, keys)
+}
+
+func TestHashIndexConcurrency(t *testing.T) {
+	index := New[string, int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			index.Upsert("key"+strconv.Itoa(i%10), countCheck)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := index.Query(context.TODO(), "", "")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	results, _ := index.Query(context.TODO(), "", "")
+	total := 0
+	for _, count := range results {
+		total += count
+	}
+	assert.Equal(t, 10, len(results))
+	assert.Equal(t, 100, total)
+}
+
+func TestHashIndexSnapshot(t *testing.T) {
+	index := New[string, int]()
+	for _, key := range []string{"a", "b", "c"} {
+		index.Upsert(key, countCheck)
+	}
+
+	keys := []string{}
+	for key := range index.Snapshot(context.TODO(), "", "") {
+		if key == "a" {
+			index.Remove("b")
+			index.Upsert("bb", countCheck)
+			index.Upsert("c", countCheck)
+		}
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	keys = []string{}
+	for key := range index.All(context.TODO(), "", "") {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "bb", "c"}, keys)
+}
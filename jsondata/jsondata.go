@@ -6,16 +6,19 @@
 package jsondata
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
-// This struct is used to store the JSON Schema that is provided when starting the server.
-// It is used to validate the contents of a new document upon its creation.
+// This struct is used to store the JSON Schema that is provided when starting the server,
+// or one that is attached to a database or collection. It is used to validate the contents
+// of a new document upon its creation. Schemas compiled from memory also keep their source.
 type ValidSchema struct {
 	schema *jsonschema.Schema
+	source []byte
 }
 
 // New initializes a new ValidSchema struct, takes a JSON Schema file as input,
@@ -38,6 +41,30 @@ func New(jsonflag string) (ValidSchema, error) {
 	return newSchema, nil
 }
 
+// NewFromBytes initializes a new ValidSchema struct from a JSON Schema held in memory.
+// The name is only used to identify the schema while compiling it. The source is kept
+// so that it can be returned to clients and stored along with the databases.
+func NewFromBytes(name string, source []byte) (ValidSchema, error) {
+	compiler := jsonschema.NewCompiler()
+	url := "memory://schemas/" + name + ".json"
+
+	// Adding the source and compiling it
+	if err := compiler.AddResource(url, bytes.NewReader(source)); err != nil {
+		return ValidSchema{schema: nil}, err
+	}
+	sch, err := compiler.Compile(url)
+	if err != nil {
+		return ValidSchema{schema: nil}, err
+	}
+	return ValidSchema{schema: sch, source: bytes.Clone(source)}, nil
+}
+
+// Source returns the JSON the schema was compiled from by NewFromBytes, or nil for
+// schemas compiled from a file.
+func (sch *ValidSchema) Source() []byte {
+	return sch.source
+}
+
 // ValidateDocument is used in the contents package when creating new documents. This function
 // takes a valid schema and the content of a document as input. This function will call the Validate()
 // method to ensure that the document content matches the provided schema.
@@ -144,3 +144,26 @@ func TestValidateSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestNewFromBytes(t *testing.T) {
+	source := []byte(`{"type":"object","properties":{"count":{"type":"integer"}},"required":["count"]}`)
+	schema, err := NewFromBytes("counts", source)
+	if err != nil {
+		t.Fatalf("Schema failed to compile: %v", err)
+	}
+	if string(schema.Source()) != string(source) {
+		t.Fatalf("Schema did not keep its source")
+	}
+	if _, err := schema.ValidateDocument([]byte(`{"count":3}`)); err != nil {
+		t.Fatalf("Valid document was rejected: %v", err)
+	}
+	if _, err := schema.ValidateDocument([]byte(`{"count":"three"}`)); err == nil {
+		t.Fatalf("Invalid document was accepted")
+	}
+
+	for _, invalid := range []string{`not json`, `{"type":"nonsense"}`} {
+		if _, err := NewFromBytes("invalid", []byte(invalid)); err == nil {
+			t.Fatalf("Schema %s should not compile", invalid)
+		}
+	}
+}
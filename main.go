@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -8,22 +9,33 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/auth"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/handlers"
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
-	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/persist"
 	sse "github.com/RICE-COMP318-FALL24/owldb-p1group32/sse"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
 )
 
+// How often the database tree is snapshotted when running with durable storage
+const snapshotInterval = 5 * time.Minute
+
 func main() {
-	// command-line flags (-p, -s, -t)
+	// command-line flags (-p, -s, -t, -a, -d, -k, -b, -e)
 	portnum := flag.String("p", "3318", "Port to listen on")
 	jsonFlag := flag.String("s", "", "Name of file with JSON schema")
 	tokenFlag := flag.String("t", "", "JSON file with mapping of usernames to tokens")
+	policyFlag := flag.String("a", "", "JSON file with access grants (default policy.json next to the tokens file)")
+	dirFlag := flag.String("d", "", "Directory for durable storage (write-ahead log and snapshots)")
+	historyFlag := flag.Int("k", contents.DefaultHistoryLimit, "Number of previous revisions kept for each document")
+	batchFlag := flag.Int("b", handlers.DefaultBatchLimit, "Number of operations of a batch request that run at the same time")
+	engineFlag := flag.String("e", string(storage.SkipList), "Storage engine for databases, documents, and collections (skiplist or hash)")
 	flag.Parse()
 
 	// ensure a file with json schema is named
@@ -35,6 +47,15 @@ func main() {
 		log.Fatal("Error: Must specify the JSON file with mapping of user names to tokens using the -t flag\n")
 	}
 
+	contents.SetHistoryLimit(*historyFlag)
+
+	// The engine must be chosen before any database, document, or collection is created
+	engine, err := storage.ParseEngine(*engineFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage.SetEngine(engine)
+
 	schem, err := jsondata.New(*jsonFlag)
 	if err != nil {
 		log.Fatal("Error: Provided schema could not be compiled\n")
@@ -56,32 +77,72 @@ func main() {
 
 	authHandler := auth.NewAuthHandler(authManager)
 
+	// Load the access policy. Without one, every user may do anything.
+	policyFile := *policyFlag
+	if policyFile == "" {
+		policyFile = filepath.Join(filepath.Dir(*tokenFlag), "policy.json")
+	}
+	var policy *auth.Policy
+	if _, err := os.Stat(policyFile); err == nil || *policyFlag != "" {
+		policy, err = auth.LoadPolicy(policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		slog.Warn("No access policy found, every user has full access", "file", policyFile)
+	}
+
 	// Initialize the SubscriberHandler and SupscriptionFactory
 	subscriptionFactory := func() sse.DBIndex[string, *sse.Subscriber] {
-		// Assuming a SkipList implementation exists
-		return skiplist.NewSkipList[string, *sse.Subscriber]()
+		return storage.New[string, *sse.Subscriber]()
 	}
 	subscriberHandler := sse.NewSubscriberHandler(
 		// Resource to token mapping
-		skiplist.NewSkipList[string, sse.DBIndex[string, *sse.Subscriber]](),
+		storage.New[string, sse.DBIndex[string, *sse.Subscriber]](),
 		subscriptionFactory,
 	)
 	// Create the auth handlers
 	mux := http.NewServeMux()
 	mux.Handle("/auth", http.HandlerFunc(authHandler.HandleRequest))
 
-	// Set up the /subscribe route using the SSE handler
-	mux.HandleFunc("/subscribe", func(w http.ResponseWriter, r *http.Request) {
-		resource := r.URL.Query().Get("resource")
-		token := r.URL.Query().Get("token")
-		subscriberHandler.SSEHandler(w, r, resource, token)
-	})
-	databaseList := handlers.New(&schem, subscriberHandler)
+	// Subscriptions are made through /v1/...?mode=subscribe and /ws, which check the
+	// user's token and roles like every other request
+	databaseList := handlers.New(&schem, subscriberHandler).WithPolicy(policy).WithBatchLimit(*batchFlag)
+
+	// Recover the databases from durable storage if a directory was given
+	var store *persist.Store
+	if *dirFlag != "" {
+		store, err = persist.Open(*dirFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		databaseList, err = handlers.NewDurable(&schem, subscriberHandler, store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		databaseList = databaseList.WithPolicy(policy).WithBatchLimit(*batchFlag)
+		go func() {
+			ticker := time.NewTicker(snapshotInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := databaseList.Snapshot(context.Background()); err != nil {
+					slog.Error("Snapshot failed", "error", err)
+				}
+			}
+		}()
+	}
 
 	// Protected routes (requires token-based authentication)
 	// Wrap the /v1/ endpoint with the auth middleware for database access
 	mux.Handle("/v1/", authManager.Middleware(http.HandlerFunc(databaseList.V1Handler)))
 
+	// WebSocket connections for subscriptions and requests, authenticated like /v1/
+	mux.Handle("/ws", authManager.Middleware(http.HandlerFunc(databaseList.WebSocketHandler)))
+
+	// Admin routes for taking and loading backups of a running server
+	mux.Handle("/admin/backup", authManager.Middleware(http.HandlerFunc(databaseList.BackupHandler)))
+	mux.Handle("/admin/restore", authManager.Middleware(http.HandlerFunc(databaseList.RestoreHandler)))
+
 	// initialize server
 	server := http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -111,4 +172,16 @@ func main() {
 	} else {
 		slog.Info("Server closed", "error", err)
 	}
+
+	// Connections upgraded to WebSockets outlive server.Close, so close them and wait for
+	// their requests to finish before the final snapshot
+	databaseList.CloseWebSockets()
+
+	// Take a final snapshot so the next start does not need to replay the log
+	if store != nil {
+		if err := databaseList.Snapshot(context.Background()); err != nil {
+			slog.Error("Snapshot failed", "error", err)
+		}
+		store.Close()
+	}
 }
@@ -0,0 +1,563 @@
+// Package persist implements durable storage for the database tree. It keeps an
+// append-only write-ahead log of every change that is applied to the tree, takes
+// periodic snapshots of the whole tree, and replays both on startup so that the
+// databases, documents, and collections are rebuilt exactly as they were.
+
+package persist
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/storage"
+)
+
+// Names of the files that are kept inside the storage directory.
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// Operations that can be recorded in the write-ahead log. A put of a document replaces
+// it along with the collections nested inside it, while a patch only replaces its
+// contents and metadata.
+const (
+	OpPut    = "put"
+	OpPatch  = "patch"
+	OpDelete = "delete"
+)
+
+// A Node is the stored form of a database, document, or collection. What a node
+// represents is decided by its depth in the tree: the top level holds databases,
+// the children of databases and collections are documents, and the children of
+// documents are collections. Only documents use the Path, Content, Version, WrittenAt,
+// History, and Metadata fields, and only databases and collections use the Indexes,
+// Schema, and Ownership fields.
+type Node struct {
+	Name      string              `json:"name"`
+	Path      string              `json:"path,omitempty"`
+	Content   []byte              `json:"content,omitempty"`
+	Version   int64               `json:"version,omitempty"`
+	WrittenAt int64               `json:"writtenAt,omitempty"`
+	History   []contents.Revision `json:"history,omitempty"`
+	Metadata  *contents.Metadata  `json:"metadata,omitempty"`
+	Indexes   []string            `json:"indexes,omitempty"`
+	Schema    json.RawMessage     `json:"schema,omitempty"`
+	Ownership string              `json:"ownership,omitempty"`
+	Children  []Node              `json:"children,omitempty"`
+}
+
+// A Record is a single entry in the write-ahead log. It holds the sequence number of
+// the entry, the operation, the slash separated path that the operation applies to,
+// and for put and patch operations the new state of the node at that path. The node inside
+// a record never holds children, since those are recorded by their own entries.
+type Record struct {
+	Seq  int64  `json:"seq"`
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Node *Node  `json:"node,omitempty"`
+}
+
+// A Snapshot holds the full database tree along with the sequence number of the last
+// log record that is already reflected in it.
+type Snapshot struct {
+	Seq       int64  `json:"seq"`
+	Databases []Node `json:"databases"`
+}
+
+// Identifies the archives produced by backups, so that restores can reject anything else.
+const (
+	ArchiveFormat  = "owldb-backup"
+	ArchiveVersion = 1
+)
+
+// An Archive is a self-describing backup of the whole database tree. It names its
+// own format and version, records when it was created (in Unix milliseconds), and
+// holds every database along with everything nested under it.
+type Archive struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt int64  `json:"createdAt"`
+	Databases []Node `json:"databases"`
+}
+
+// A Store manages the write-ahead log and snapshot files inside one directory.
+// Its mutex serializes appends, snapshots, and recovery. Callers are responsible for
+// appending the records of changes to one path in the order the changes were applied,
+// and for not taking a snapshot in the middle of a change.
+type Store struct {
+	mu  sync.Mutex
+	dir string   // directory holding the log and snapshot files
+	wal *os.File // log file opened for appending
+	seq int64    // sequence number of the last appended record
+}
+
+// Open creates the given directory if needed and opens the write-ahead log inside it
+// for appending. Recover should be called before any new records are appended.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	return &Store{dir: dir, wal: wal}, nil
+}
+
+// Recover rebuilds the database tree inside databaseList. It first restores the latest
+// snapshot, if there is one, and then replays every log record that came after it.
+// A torn record at the very end of the log (from a crash in the middle of a write)
+// is ignored and cut off the log, so records appended later start on a line of their own.
+func (s *Store) Recover(databaseList skiplist.DBIndex[string, database.Database]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if err == nil {
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("failed to parse snapshot: %w", err)
+		}
+		if err := Restore(databaseList, snapshot.Databases); err != nil {
+			return err
+		}
+		s.seq = snapshot.Seq
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, walFile))
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64 // where the last complete record ends
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				return nil
+			}
+			// A line without a newline was never fully written
+			if err := s.wal.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to remove torn write-ahead log record: %w", err)
+			}
+			if err := s.wal.Sync(); err != nil {
+				return fmt.Errorf("failed to sync write-ahead log: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read write-ahead log: %w", err)
+		}
+		offset += int64(len(line))
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("corrupt write-ahead log record: %w", err)
+		}
+		// Skip anything that is already part of the snapshot
+		if record.Seq <= s.seq {
+			continue
+		}
+		if err := Apply(databaseList, record); err != nil {
+			return fmt.Errorf("failed to replay record %d: %w", record.Seq, err)
+		}
+		s.seq = record.Seq
+	}
+}
+
+// Append writes the records to the end of the write-ahead log and syncs it to disk.
+// The records are given the next sequence numbers. They are written together, and if
+// any of them cannot be written the log is cut back to where it was, so either all of
+// the records are appended or none of them are.
+func (s *Store) Append(records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines []byte
+	for i, record := range records {
+		record.Seq = s.seq + int64(i) + 1
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	info, err := s.wal.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Write(lines); err != nil {
+		s.wal.Truncate(info.Size())
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.wal.Truncate(info.Size())
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	s.seq += int64(len(records))
+	return nil
+}
+
+// Snapshot writes the full database tree to the snapshot file and then truncates the
+// write-ahead log, since every record in it is now part of the snapshot. The snapshot
+// is written to a temporary file first and renamed into place, so a crash never
+// leaves a partial snapshot behind.
+func (s *Store) Snapshot(ctx context.Context, databaseList skiplist.DBIndex[string, database.Database]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	databases, err := Capture(ctx, databaseList)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(Snapshot{Seq: s.seq, Databases: databases})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmpPath := filepath.Join(s.dir, snapshotFile+".tmp")
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to install snapshot: %w", err)
+	}
+
+	// Everything in the log is covered by the snapshot now
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the write-ahead log.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wal.Close()
+}
+
+// Capture walks the whole database tree and returns it as a list of database nodes.
+func Capture(ctx context.Context, databaseList skiplist.DBIndex[string, database.Database]) ([]Node, error) {
+	databases, err := databaseList.Query(ctx, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query databases: %w", err)
+	}
+	nodes := []Node{}
+	for _, db := range databases {
+		children, err := captureDocuments(ctx, db.Documents)
+		if err != nil {
+			return nil, err
+		}
+		node := databaseNode(db)
+		node.Children = children
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// captureDocuments returns the nodes for every document in documentList along with
+// all of the collections nested under them.
+func captureDocuments(ctx context.Context, documentList skiplist.DBIndex[string, contents.Document]) ([]Node, error) {
+	documents, err := documentList.Query(ctx, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	nodes := []Node{}
+	for _, doc := range documents {
+		node := documentNode(doc)
+		if doc.Collections != nil {
+			collections, err := doc.Collections.Query(ctx, "", "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to query collections: %w", err)
+			}
+			for _, col := range collections {
+				children, err := captureDocuments(ctx, col.Documents)
+				if err != nil {
+					return nil, err
+				}
+				colNode := collectionNode(col)
+				colNode.Children = children
+				node.Children = append(node.Children, colNode)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// databaseNode returns the node for a single database without its documents.
+func databaseNode(db database.Database) Node {
+	node := Node{Name: db.Name, Indexes: contents.Indexes(db.Documents), Ownership: string(db.Ownership)}
+	if db.Schema != nil {
+		node.Schema = db.Schema.Source()
+	}
+	return node
+}
+
+// collectionNode returns the node for a single collection without its documents.
+func collectionNode(col contents.Collection) Node {
+	node := Node{Name: col.Name, Indexes: contents.Indexes(col.Documents), Ownership: string(col.Ownership)}
+	if col.Schema != nil {
+		node.Schema = col.Schema.Source()
+	}
+	return node
+}
+
+// documentNode returns the node for a single document without its collections.
+func documentNode(doc contents.Document) Node {
+	metadata := doc.Metadata
+	return Node{
+		Name:      doc.Name,
+		Path:      doc.Path,
+		Content:   doc.Content,
+		Version:   doc.Version,
+		WrittenAt: doc.WrittenAt,
+		History:   doc.History,
+		Metadata:  &metadata,
+	}
+}
+
+// Restore inserts every database node, and everything nested under it, into databaseList.
+func Restore(databaseList skiplist.DBIndex[string, database.Database], databases []Node) error {
+	for _, node := range databases {
+		if err := Apply(databaseList, Record{Op: OpPut, Path: node.Name, Node: &node}); err != nil {
+			return err
+		}
+		if err := restoreDocuments(databaseList, node.Name, node.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreDocuments inserts the given document nodes, and everything nested under them,
+// into the database or collection at parentPath.
+func restoreDocuments(databaseList skiplist.DBIndex[string, database.Database], parentPath string, documents []Node) error {
+	for _, node := range documents {
+		docPath := parentPath + "/" + node.Name
+		if err := Apply(databaseList, Record{Op: OpPut, Path: docPath, Node: &node}); err != nil {
+			return err
+		}
+		for _, col := range node.Children {
+			colPath := docPath + "/" + col.Name
+			if err := Apply(databaseList, Record{Op: OpPut, Path: colPath, Node: &col}); err != nil {
+				return err
+			}
+			if err := restoreDocuments(databaseList, colPath, col.Children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the node currently stored at the given path without any of its
+// children. If nothing exists at the path, it returns false.
+func Lookup(databaseList skiplist.DBIndex[string, database.Database], path string) (Node, bool) {
+	pathList := strings.Split(path, "/")
+	db, found := databaseList.Find(pathList[0])
+	if !found {
+		return Node{}, false
+	}
+	if len(pathList) == 1 {
+		return databaseNode(db), true
+	}
+
+	documentList := db.Documents
+	var doc contents.Document
+	for i := 1; i < len(pathList); i++ {
+		if i%2 == 1 {
+			doc, found = documentList.Find(pathList[i])
+			if !found {
+				return Node{}, false
+			}
+		} else {
+			if doc.Collections == nil {
+				return Node{}, false
+			}
+			col, found := doc.Collections.Find(pathList[i])
+			if !found {
+				return Node{}, false
+			}
+			if i == len(pathList)-1 {
+				return collectionNode(col), true
+			}
+			documentList = col.Documents
+		}
+	}
+	return documentNode(doc), true
+}
+
+// Apply applies a single log record to the database tree. Put records create the node
+// at the record's path, or replace it if it already exists. Like a PUT request, a put of
+// a document leaves it without collections, while a patch keeps the collections nested
+// inside it. Databases and collections keep their documents. Delete records remove the
+// node at the path along with everything under it. The parent of the path must already
+// exist.
+func Apply(databaseList skiplist.DBIndex[string, database.Database], record Record) error {
+	pathList := strings.Split(record.Path, "/")
+	name := pathList[len(pathList)-1]
+
+	if len(pathList) == 1 {
+		if record.Op == OpDelete {
+			databaseList.Remove(name)
+			return nil
+		}
+		schema, err := nodeSchema(record.Node)
+		if err != nil {
+			return err
+		}
+		_, err = databaseList.Upsert(name, func(key string, currValue database.Database, exists bool) (database.Database, error) {
+			if !exists {
+				currValue = database.Database{
+					Name:      key,
+					Documents: contents.NewDocumentList(),
+				}
+			}
+			if record.Node != nil {
+				currValue.Schema = schema
+				currValue.Ownership = contents.Ownership(record.Node.Ownership)
+			}
+			return currValue, nil
+		})
+		if err != nil {
+			return err
+		}
+		db, _ := databaseList.Find(name)
+		return applyIndexes(db.Documents, record.Node)
+	}
+
+	// Find the document list or collection list that holds the node
+	db, found := databaseList.Find(pathList[0])
+	if !found {
+		return fmt.Errorf("database %s does not exist", pathList[0])
+	}
+	documentList := db.Documents
+	var collectionList skiplist.DBIndex[string, contents.Collection]
+	for i := 1; i < len(pathList)-1; i++ {
+		if i%2 == 1 {
+			doc, found := documentList.Find(pathList[i])
+			if !found || doc.Collections == nil {
+				return fmt.Errorf("document %s does not exist", pathList[i])
+			}
+			collectionList = doc.Collections
+		} else {
+			col, found := collectionList.Find(pathList[i])
+			if !found {
+				return fmt.Errorf("collection %s does not exist", pathList[i])
+			}
+			documentList = col.Documents
+		}
+	}
+
+	if len(pathList)%2 == 1 {
+		// We have a collection
+		if record.Op == OpDelete {
+			collectionList.Remove(name)
+			return nil
+		}
+		schema, err := nodeSchema(record.Node)
+		if err != nil {
+			return err
+		}
+		_, err = collectionList.Upsert(name, func(key string, currValue contents.Collection, exists bool) (contents.Collection, error) {
+			if !exists {
+				currValue = contents.Collection{
+					Name:      key,
+					Documents: contents.NewDocumentList(),
+				}
+			}
+			if record.Node != nil {
+				currValue.Schema = schema
+				currValue.Ownership = contents.Ownership(record.Node.Ownership)
+			}
+			return currValue, nil
+		})
+		if err != nil {
+			return err
+		}
+		col, _ := collectionList.Find(name)
+		return applyIndexes(col.Documents, record.Node)
+	}
+
+	// We have a document
+	if record.Op == OpDelete {
+		documentList.Remove(name)
+		return nil
+	}
+	if record.Node == nil {
+		return fmt.Errorf("%s record for %s has no node", record.Op, record.Path)
+	}
+	node := record.Node
+	_, err := documentList.Upsert(name, func(key string, currValue contents.Document, exists bool) (contents.Document, error) {
+		newValue := contents.Document{
+			Name:        key,
+			Path:        node.Path,
+			Content:     node.Content,
+			Version:     node.Version,
+			WrittenAt:   node.WrittenAt,
+			History:     node.History,
+			Collections: currValue.Collections,
+		}
+		if node.Metadata != nil {
+			newValue.Metadata = *node.Metadata
+		}
+		if !exists || record.Op != OpPatch || newValue.Collections == nil {
+			newValue.Collections = storage.New[string, contents.Collection]()
+		}
+		return newValue, nil
+	})
+	return err
+}
+
+// applyIndexes makes the indexes on documentList match the ones recorded in node.
+// Records without a node leave the indexes alone.
+func applyIndexes(documentList skiplist.DBIndex[string, contents.Document], node *Node) error {
+	if node == nil {
+		return nil
+	}
+	return contents.SetIndexes(context.Background(), documentList, node.Indexes)
+}
+
+// nodeSchema compiles the schema recorded in a database or collection node. It returns
+// nil if the node has no schema.
+func nodeSchema(node *Node) (*jsondata.ValidSchema, error) {
+	if node == nil || len(node.Schema) == 0 {
+		return nil, nil
+	}
+	schema, err := jsondata.NewFromBytes(node.Name, node.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema of %s: %w", node.Name, err)
+	}
+	return &schema, nil
+}
@@ -0,0 +1,305 @@
+package persist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/contents"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/database"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// testRecords builds a small tree: a database with a document, a collection
+// inside that document, and a document inside that collection.
+func testRecords() []Record {
+	return []Record{
+		{Op: OpPut, Path: "db1", Node: &Node{Name: "db1"}},
+		{Op: OpPut, Path: "db1/doc1", Node: &Node{
+			Name:    "doc1",
+			Content: []byte(`{"name":"julia"}`),
+			Metadata: &contents.Metadata{
+				CreatedBy:      "julia",
+				CreatedAt:      12,
+				LastModifiedBy: "april",
+				LastModifiedAt: 13,
+			},
+		}},
+		{Op: OpPut, Path: "db1/doc1/col1", Node: &Node{Name: "col1"}},
+		{Op: OpPut, Path: "db1/doc1/col1/doc2", Node: &Node{
+			Name:     "doc2",
+			Content:  []byte(`{"age":22}`),
+			Metadata: &contents.Metadata{CreatedBy: "esther", LastModifiedBy: "esther"},
+		}},
+		{Op: OpPut, Path: "db2", Node: &Node{Name: "db2"}},
+	}
+}
+
+// appendAll appends the given records to the store.
+func appendAll(t *testing.T, store *Store, records []Record) {
+	for _, record := range records {
+		if err := store.Append(record); err != nil {
+			t.Fatalf("Failed to append record: %v", err)
+		}
+	}
+}
+
+// checkTree verifies that the tree built by testRecords was rebuilt exactly.
+func checkTree(t *testing.T, databaseList skiplist.DBIndex[string, database.Database]) {
+	doc1, found := Lookup(databaseList, "db1/doc1")
+	if !found {
+		t.Fatalf("doc1 was not recovered")
+	}
+	if string(doc1.Content) != `{"name":"julia"}` {
+		t.Fatalf("doc1 has the wrong content: %s", doc1.Content)
+	}
+	if doc1.Metadata.CreatedBy != "julia" || doc1.Metadata.CreatedAt != 12 ||
+		doc1.Metadata.LastModifiedBy != "april" || doc1.Metadata.LastModifiedAt != 13 {
+		t.Fatalf("doc1 has the wrong metadata: %+v", doc1.Metadata)
+	}
+	if _, found := Lookup(databaseList, "db1/doc1/col1"); !found {
+		t.Fatalf("col1 was not recovered")
+	}
+	doc2, found := Lookup(databaseList, "db1/doc1/col1/doc2")
+	if !found {
+		t.Fatalf("doc2 was not recovered")
+	}
+	if string(doc2.Content) != `{"age":22}` || doc2.Metadata.CreatedBy != "esther" {
+		t.Fatalf("doc2 was not recovered exactly")
+	}
+	if _, found := Lookup(databaseList, "db2"); !found {
+		t.Fatalf("db2 was not recovered")
+	}
+}
+
+func TestRecoverFromLog(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	appendAll(t, store, testRecords())
+	store.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	if err := store.Recover(databaseList); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	checkTree(t, databaseList)
+}
+
+func TestRecoverFromSnapshotAndLog(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	// Build the tree, snapshot it, and then change it some more
+	live := skiplist.NewSkipList[string, database.Database]()
+	records := testRecords()
+	for _, record := range records {
+		if err := Apply(live, record); err != nil {
+			t.Fatalf("Failed to apply record: %v", err)
+		}
+	}
+	appendAll(t, store, records)
+	if err := store.Snapshot(ctx, live); err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, walFile))
+	if err != nil || info.Size() != 0 {
+		t.Fatalf("Write-ahead log was not truncated after the snapshot")
+	}
+	appendAll(t, store, []Record{
+		{Op: OpPut, Path: "db3", Node: &Node{Name: "db3"}},
+		{Op: OpDelete, Path: "db3"},
+		{Op: OpPut, Path: "db4", Node: &Node{Name: "db4"}},
+	})
+	store.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	if err := store.Recover(databaseList); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	checkTree(t, databaseList)
+	if _, found := Lookup(databaseList, "db3"); found {
+		t.Fatalf("db3 should have been deleted during replay")
+	}
+	if _, found := Lookup(databaseList, "db4"); !found {
+		t.Fatalf("db4 was not replayed from the log")
+	}
+}
+
+func TestRecoverIgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	appendAll(t, store, testRecords())
+	store.Close()
+
+	// Simulate a crash in the middle of writing a record
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	wal.WriteString(`{"seq":6,"op":"put","pa`)
+	wal.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	if err := store.Recover(databaseList); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	checkTree(t, databaseList)
+}
+
+func TestRecoverAfterTornRecordAndAppend(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	appendAll(t, store, testRecords())
+	store.Close()
+
+	// Simulate a crash in the middle of writing a record
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	wal.WriteString(`{"seq":6,"op":"put","pa`)
+	wal.Close()
+
+	// Records appended after recovering must not be joined to the torn one
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if err := store.Recover(skiplist.NewSkipList[string, database.Database]()); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	appendAll(t, store, []Record{{Op: OpPut, Path: "db3", Node: &Node{Name: "db3"}}})
+	store.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	if err := store.Recover(databaseList); err != nil {
+		t.Fatalf("Failed to recover again: %v", err)
+	}
+	checkTree(t, databaseList)
+	if _, found := Lookup(databaseList, "db3"); !found {
+		t.Fatalf("db3 was not replayed from the log")
+	}
+}
+
+func TestApplyDeleteKeepsSiblings(t *testing.T) {
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	for _, record := range testRecords() {
+		if err := Apply(databaseList, record); err != nil {
+			t.Fatalf("Failed to apply record: %v", err)
+		}
+	}
+	if err := Apply(databaseList, Record{Op: OpDelete, Path: "db1/doc1/col1"}); err != nil {
+		t.Fatalf("Failed to apply delete: %v", err)
+	}
+	if _, found := Lookup(databaseList, "db1/doc1/col1/doc2"); found {
+		t.Fatalf("doc2 should have been removed with its collection")
+	}
+	if _, found := Lookup(databaseList, "db1/doc1"); !found {
+		t.Fatalf("doc1 should still exist")
+	}
+	if err := Apply(databaseList, Record{Op: OpPut, Path: "missing/doc1", Node: &Node{Name: "doc1"}}); err == nil {
+		t.Fatalf("Applying a record under a missing database should fail")
+	}
+}
+
+func TestApplyRestoresIndexes(t *testing.T) {
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	for _, record := range testRecords() {
+		if err := Apply(databaseList, record); err != nil {
+			t.Fatalf("Failed to apply record: %v", err)
+		}
+	}
+
+	// Declaring an index is recorded as a put of the collection
+	indexed := Record{Op: OpPut, Path: "db1/doc1/col1", Node: &Node{Name: "col1", Indexes: []string{"/age"}}}
+	if err := Apply(databaseList, indexed); err != nil {
+		t.Fatalf("Failed to apply record: %v", err)
+	}
+	col1, _ := Lookup(databaseList, "db1/doc1/col1")
+	if len(col1.Indexes) != 1 || col1.Indexes[0] != "/age" {
+		t.Fatalf("Index was not restored: %v", col1.Indexes)
+	}
+	if _, found := Lookup(databaseList, "db1/doc1/col1/doc2"); !found {
+		t.Fatalf("Documents should be kept when the indexes change")
+	}
+
+	// The captured tree carries the index along
+	databases, err := Capture(context.TODO(), databaseList)
+	if err != nil {
+		t.Fatalf("Failed to capture tree: %v", err)
+	}
+	if indexes := databases[0].Children[0].Children[0].Indexes; len(indexes) != 1 {
+		t.Fatalf("Captured collection lost its index: %v", indexes)
+	}
+}
+
+func TestApplyRestoresSchema(t *testing.T) {
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	schema := []byte(`{"type":"object","required":["count"]}`)
+	if err := Apply(databaseList, Record{Op: OpPut, Path: "db1", Node: &Node{Name: "db1", Schema: schema}}); err != nil {
+		t.Fatalf("Failed to apply record: %v", err)
+	}
+	db1, _ := databaseList.Find("db1")
+	if db1.Schema == nil {
+		t.Fatalf("Schema was not restored")
+	}
+	if _, err := db1.Schema.ValidateDocument([]byte(`{"name":"julia"}`)); err == nil {
+		t.Fatalf("Restored schema does not validate documents")
+	}
+	if node, _ := Lookup(databaseList, "db1"); string(node.Schema) != string(schema) {
+		t.Fatalf("Schema was not recorded: %s", node.Schema)
+	}
+
+	invalid := Record{Op: OpPut, Path: "db2", Node: &Node{Name: "db2", Schema: []byte(`{"type":"nonsense"}`)}}
+	if err := Apply(databaseList, invalid); err == nil {
+		t.Fatalf("An invalid schema should fail to apply")
+	}
+}
+
+func TestApplyRestoresOwnership(t *testing.T) {
+	databaseList := skiplist.NewSkipList[string, database.Database]()
+	if err := Apply(databaseList, Record{Op: OpPut, Path: "db1", Node: &Node{Name: "db1", Ownership: "reads"}}); err != nil {
+		t.Fatalf("Failed to apply record: %v", err)
+	}
+	db1, _ := databaseList.Find("db1")
+	if db1.Ownership != contents.OwnershipReads {
+		t.Fatalf("Ownership was not restored: %q", db1.Ownership)
+	}
+	if node, _ := Lookup(databaseList, "db1"); node.Ownership != "reads" {
+		t.Fatalf("Ownership was not recorded: %q", node.Ownership)
+	}
+}
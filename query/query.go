@@ -0,0 +1,558 @@
+// Package query implements the filter language used to select documents by their
+// JSON content. A filter is parsed once with Parse and can then be matched against
+// any number of documents. Document contents are only accessed through the visitors
+// in the jsondata package.
+//
+// A filter compares the values found at JSON pointers with JSON literals:
+//
+//	/age > 30 and /name in ["julia", "april"]
+//	not exists /deleted or (/score >= 9.5 && /tags/0 == "new")
+//
+// The comparison operators are ==, !=, <, <=, >, and >=. Equality works on any JSON
+// value, while the ordering operators only match two numbers or two strings. The
+// in operator matches if the value equals any literal in the list, and exists
+// matches if the pointer resolves to a value at all. Predicates can be combined
+// with and (&&), or (||), not (!), and parentheses. A pointer that does not resolve
+// to a value never matches a comparison.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/jsondata"
+)
+
+// An Expr is a parsed filter that can be matched against document contents.
+type Expr interface {
+	Match(doc jsondata.JSONValue) bool
+}
+
+// Parse parses the given filter string. It returns an error describing the first
+// problem it finds if the filter is malformed.
+func Parse(filter string) (Expr, error) {
+	p := &parser{input: filter}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tok.text, p.tok.pos)
+	}
+	return expr, nil
+}
+
+// MatchContent reports whether the encoded JSON document content matches the filter.
+// Content that is not valid JSON never matches.
+func MatchContent(expr Expr, content []byte) bool {
+	var doc jsondata.JSONValue
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return false
+	}
+	return expr.Match(doc)
+}
+
+// The expression types produced by the parser.
+type (
+	andExpr    struct{ left, right Expr }
+	orExpr     struct{ left, right Expr }
+	notExpr    struct{ expr Expr }
+	existsExpr struct{ pointer []string }
+	inExpr     struct {
+		pointer []string
+		values  []jsondata.JSONValue
+	}
+	compareExpr struct {
+		pointer []string
+		op      string
+		value   jsondata.JSONValue
+	}
+)
+
+func (e andExpr) Match(doc jsondata.JSONValue) bool {
+	return e.left.Match(doc) && e.right.Match(doc)
+}
+
+func (e orExpr) Match(doc jsondata.JSONValue) bool {
+	return e.left.Match(doc) || e.right.Match(doc)
+}
+
+func (e notExpr) Match(doc jsondata.JSONValue) bool {
+	return !e.expr.Match(doc)
+}
+
+func (e existsExpr) Match(doc jsondata.JSONValue) bool {
+	_, found := Resolve(doc, e.pointer)
+	return found
+}
+
+func (e inExpr) Match(doc jsondata.JSONValue) bool {
+	value, found := Resolve(doc, e.pointer)
+	if !found {
+		return false
+	}
+	for _, candidate := range e.values {
+		if value.Equal(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e compareExpr) Match(doc jsondata.JSONValue) bool {
+	value, found := Resolve(doc, e.pointer)
+	if !found {
+		return false
+	}
+	switch e.op {
+	case "==":
+		return value.Equal(e.value)
+	case "!=":
+		return !value.Equal(e.value)
+	}
+	order, ok := Compare(value, e.value)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// ParsePointer splits a JSON pointer such as "/a/b~1c" into its decoded reference
+// tokens. The empty pointer refers to the whole document.
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		// Replace ~1 with / and ~0 with ~ according to the JSON Pointer specification
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// FormatPointer joins decoded reference tokens back into a JSON pointer string. Pointers
+// that refer to the same location always format to the same string.
+func FormatPointer(tokens []string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		token = strings.ReplaceAll(token, "~", "~0")
+		pointer.WriteString("/" + strings.ReplaceAll(token, "/", "~1"))
+	}
+	return pointer.String()
+}
+
+// A Constraint is a predicate that every document matching a filter must satisfy.
+// Op is one of ==, <, <=, >, >=, or in. For in, Values holds every listed value;
+// for the other operators it holds exactly one value.
+type Constraint struct {
+	Pointer string
+	Op      string
+	Values  []jsondata.JSONValue
+}
+
+// Constraints returns the comparison and in predicates that are joined to the rest of
+// the filter only by and. Any document matching the filter satisfies all of them, so
+// they can be used to narrow down the documents that need to be checked.
+func Constraints(expr Expr) []Constraint {
+	switch e := expr.(type) {
+	case andExpr:
+		return append(Constraints(e.left), Constraints(e.right)...)
+	case inExpr:
+		return []Constraint{{Pointer: FormatPointer(e.pointer), Op: "in", Values: e.values}}
+	case compareExpr:
+		if e.op == "!=" {
+			return nil
+		}
+		return []Constraint{{Pointer: FormatPointer(e.pointer), Op: e.op, Values: []jsondata.JSONValue{e.value}}}
+	}
+	return nil
+}
+
+// Resolve returns the value found by following the given pointer tokens from doc.
+// It returns false if the pointer does not resolve to a value.
+func Resolve(doc jsondata.JSONValue, pointer []string) (jsondata.JSONValue, bool) {
+	value := doc
+	for _, token := range pointer {
+		result, err := jsondata.Accept[step](value, stepVisitor{token: token})
+		if err != nil || !result.found {
+			return jsondata.JSONValue{}, false
+		}
+		value = result.value
+	}
+	return value, true
+}
+
+// step is the result of following one pointer token.
+type step struct {
+	value jsondata.JSONValue
+	found bool
+}
+
+// stepVisitor follows a single pointer token into an object member or array element.
+type stepVisitor struct {
+	token string
+}
+
+func (v stepVisitor) Map(m map[string]jsondata.JSONValue) (step, error) {
+	value, found := m[v.token]
+	return step{value: value, found: found}, nil
+}
+
+func (v stepVisitor) Slice(s []jsondata.JSONValue) (step, error) {
+	index, err := strconv.Atoi(v.token)
+	if err != nil || index < 0 || index >= len(s) || (len(v.token) > 1 && v.token[0] == '0') {
+		return step{}, nil
+	}
+	return step{value: s[index], found: true}, nil
+}
+
+func (v stepVisitor) Bool(bool) (step, error)       { return step{}, nil }
+func (v stepVisitor) Float64(float64) (step, error) { return step{}, nil }
+func (v stepVisitor) String(string) (step, error)   { return step{}, nil }
+func (v stepVisitor) Null() (step, error)           { return step{}, nil }
+
+// Scalar is the comparable form of a JSON number or string. Kind is "number",
+// "string", or "" for any other JSON value.
+type Scalar struct {
+	Kind   string
+	Number float64
+	String string
+}
+
+// scalarVisitor extracts numbers and strings from JSON values.
+type scalarVisitor struct{}
+
+func (scalarVisitor) Map(map[string]jsondata.JSONValue) (Scalar, error) { return Scalar{}, nil }
+func (scalarVisitor) Slice([]jsondata.JSONValue) (Scalar, error)        { return Scalar{}, nil }
+func (scalarVisitor) Bool(bool) (Scalar, error)                         { return Scalar{}, nil }
+func (scalarVisitor) Null() (Scalar, error)                             { return Scalar{}, nil }
+
+func (scalarVisitor) Float64(f float64) (Scalar, error) {
+	return Scalar{Kind: "number", Number: f}, nil
+}
+
+func (scalarVisitor) String(s string) (Scalar, error) {
+	return Scalar{Kind: "string", String: s}, nil
+}
+
+// ScalarOf returns the comparable form of a JSON value.
+func ScalarOf(value jsondata.JSONValue) Scalar {
+	scalar, err := jsondata.Accept[Scalar](value, scalarVisitor{})
+	if err != nil {
+		return Scalar{}
+	}
+	return scalar
+}
+
+// Compare orders two JSON values. It returns a negative number if a comes before b,
+// zero if they are equal, and a positive number otherwise. Only two numbers or two
+// strings can be ordered; for anything else the second result is false.
+func Compare(a jsondata.JSONValue, b jsondata.JSONValue) (int, bool) {
+	left, right := ScalarOf(a), ScalarOf(b)
+	if left.Kind == "" || left.Kind != right.Kind {
+		return 0, false
+	}
+	if left.Kind == "number" {
+		switch {
+		case left.Number < right.Number:
+			return -1, true
+		case left.Number > right.Number:
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(left.String, right.String), true
+}
+
+// Kinds of tokens produced by the lexer.
+const (
+	tokEOF = iota
+	tokPointer
+	tokLiteral
+	tokWord
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// parser is a recursive descent parser over the filter string.
+type parser struct {
+	input string
+	pos   int
+	tok   token
+}
+
+// next reads the next token from the input into p.tok.
+func (p *parser) next() error {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, text: "end of filter", pos: start}
+		return nil
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case c == '[':
+		p.pos++
+		p.tok = token{kind: tokLBracket, text: "[", pos: start}
+	case c == ']':
+		p.pos++
+		p.tok = token{kind: tokRBracket, text: "]", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = token{kind: tokComma, text: ",", pos: start}
+	case strings.ContainsRune("=!<>&|", rune(c)):
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "=", "!"} {
+			if strings.HasPrefix(p.input[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected %q at position %d", c, start)
+	case c == '/':
+		for p.pos < len(p.input) && !unicode.IsSpace(rune(p.input[p.pos])) && !strings.ContainsRune("=!<>()[],&|", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokPointer, text: p.input[start:p.pos], pos: start}
+	case c == '"':
+		// Let the JSON decoder find the end of the string and handle escapes
+		decoder := json.NewDecoder(strings.NewReader(p.input[p.pos:]))
+		var s string
+		if err := decoder.Decode(&s); err != nil {
+			return fmt.Errorf("invalid string at position %d", start)
+		}
+		p.pos += int(decoder.InputOffset())
+		p.tok = token{kind: tokLiteral, text: p.input[start:p.pos], pos: start}
+	case c == '-' || (c >= '0' && c <= '9'):
+		for p.pos < len(p.input) && strings.ContainsRune("+-.eE0123456789", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokLiteral, text: p.input[start:p.pos], pos: start}
+	case unicode.IsLetter(rune(c)):
+		for p.pos < len(p.input) && unicode.IsLetter(rune(p.input[p.pos])) {
+			p.pos++
+		}
+		word := p.input[start:p.pos]
+		if word == "true" || word == "false" || word == "null" {
+			p.tok = token{kind: tokLiteral, text: word, pos: start}
+		} else {
+			p.tok = token{kind: tokWord, text: word, pos: start}
+		}
+	default:
+		return fmt.Errorf("unexpected %q at position %d", c, start)
+	}
+	return nil
+}
+
+// isWord reports whether the current token is one of the given keywords or operators.
+func (p *parser) isWord(words ...string) bool {
+	if p.tok.kind != tokWord && p.tok.kind != tokOp {
+		return false
+	}
+	for _, word := range words {
+		if p.tok.text == word {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOr parses: and { ("or" | "||") and }
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("or", "||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: not { ("and" | "&&") not }
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("and", "&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses: ("not" | "!") not | primary
+func (p *parser) parseNot() (Expr, error) {
+	if p.isWord("not", "!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a parenthesized filter, an exists check, or a predicate on a pointer.
+func (p *parser) parsePrimary() (Expr, error) {
+	switch {
+	case p.tok.kind == tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", p.tok.pos)
+		}
+		return expr, p.next()
+	case p.isWord("exists"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		pointer, err := p.parsePointer()
+		if err != nil {
+			return nil, err
+		}
+		return existsExpr{pointer: pointer}, nil
+	}
+
+	pointer, err := p.parsePointer()
+	if err != nil {
+		return nil, err
+	}
+	if p.isWord("in") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inExpr{pointer: pointer, values: values}, nil
+	}
+	if !p.isWord("==", "=", "!=", "<", "<=", ">", ">=") {
+		return nil, fmt.Errorf("expected comparison operator at position %d", p.tok.pos)
+	}
+	op := p.tok.text
+	if op == "=" {
+		op = "=="
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	value, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return compareExpr{pointer: pointer, op: op, value: value}, nil
+}
+
+// parsePointer parses a JSON pointer token.
+func (p *parser) parsePointer() ([]string, error) {
+	if p.tok.kind != tokPointer {
+		return nil, fmt.Errorf("expected JSON pointer at position %d", p.tok.pos)
+	}
+	pointer, err := ParsePointer(p.tok.text)
+	if err != nil {
+		return nil, err
+	}
+	return pointer, p.next()
+}
+
+// parseLiteral parses a JSON string, number, true, false, or null.
+func (p *parser) parseLiteral() (jsondata.JSONValue, error) {
+	var value jsondata.JSONValue
+	if p.tok.kind != tokLiteral {
+		return value, fmt.Errorf("expected JSON value at position %d", p.tok.pos)
+	}
+	if err := json.Unmarshal([]byte(p.tok.text), &value); err != nil {
+		return value, fmt.Errorf("invalid JSON value %q at position %d", p.tok.text, p.tok.pos)
+	}
+	return value, p.next()
+}
+
+// parseList parses: "[" literal { "," literal } "]"
+func (p *parser) parseList() ([]jsondata.JSONValue, error) {
+	if p.tok.kind != tokLBracket {
+		return nil, fmt.Errorf("expected [ at position %d", p.tok.pos)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	values := []jsondata.JSONValue{}
+	for p.tok.kind != tokRBracket {
+		if len(values) > 0 {
+			if p.tok.kind != tokComma {
+				return nil, fmt.Errorf("expected , or ] at position %d", p.tok.pos)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		value, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, p.next()
+}
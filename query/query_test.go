@@ -0,0 +1,111 @@
+package query
+
+import (
+	"testing"
+)
+
+type matchTest struct {
+	filter  string
+	content string
+	match   bool
+}
+
+func TestMatch(t *testing.T) {
+	doc := `{"name":"julia","age":22,"tags":["new","owl"],"address":{"city":"Houston","zip/code":"77005"},"deleted":null}`
+
+	testCases := []matchTest{
+		{filter: `/name == "julia"`, content: doc, match: true},
+		{filter: `/name = "julia"`, content: doc, match: true},
+		{filter: `/name != "julia"`, content: doc, match: false},
+		{filter: `/age > 21`, content: doc, match: true},
+		{filter: `/age >= 22`, content: doc, match: true},
+		{filter: `/age < 22`, content: doc, match: false},
+		{filter: `/age <= 22.0`, content: doc, match: true},
+		{filter: `/name > "april"`, content: doc, match: true},
+		{filter: `/name > 3`, content: doc, match: false},
+		{filter: `/tags/1 == "owl"`, content: doc, match: true},
+		{filter: `/tags/2 == "owl"`, content: doc, match: false},
+		{filter: `/address/city == "Houston"`, content: doc, match: true},
+		{filter: `/address/zip~1code == "77005"`, content: doc, match: true},
+		{filter: `/name in ["april", "julia"]`, content: doc, match: true},
+		{filter: `/age in [1, 2, 3]`, content: doc, match: false},
+		{filter: `exists /deleted`, content: doc, match: true},
+		{filter: `exists /missing`, content: doc, match: false},
+		{filter: `not exists /missing`, content: doc, match: true},
+		{filter: `/missing != 3`, content: doc, match: false},
+		{filter: `/age > 30 or /name == "julia"`, content: doc, match: true},
+		{filter: `/age > 30 and /name == "julia"`, content: doc, match: false},
+		{filter: `!(/age > 30) && /name == "julia"`, content: doc, match: true},
+		{filter: `/age > 30 || (/tags/0 == "new" && /age < 30)`, content: doc, match: true},
+		{filter: `/deleted == null`, content: doc, match: true},
+		{filter: `/name == "julia"`, content: `not json`, match: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filter, func(t *testing.T) {
+			expr, err := Parse(tc.filter)
+			if err != nil {
+				t.Fatalf("Filter failed to parse: %v", err)
+			}
+			if MatchContent(expr, []byte(tc.content)) != tc.match {
+				t.Fatalf("Expected match to be %v", tc.match)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []string{
+		``,
+		`/age`,
+		`/age >`,
+		`/age > > 3`,
+		`age > 3`,
+		`/age > 3 and`,
+		`(/age > 3`,
+		`/age in [1, 2`,
+		`/age in 3`,
+		`/name == "unterminated`,
+		`/age > 3 extra`,
+		`/age ~ 3`,
+		`/tags == ["new", "owl"]`,
+	}
+	for _, filter := range testCases {
+		t.Run(filter, func(t *testing.T) {
+			if _, err := Parse(filter); err == nil {
+				t.Fatalf("Expected filter %q to be rejected", filter)
+			}
+		})
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	testCases := []struct {
+		filter   string
+		expected []string
+	}{
+		{filter: `/age > 21`, expected: []string{"/age >"}},
+		{filter: `/age = 21 and /name in ["a", "b"]`, expected: []string{"/age ==", "/name in"}},
+		{filter: `/a~1b == 1 && exists /c`, expected: []string{"/a~1b =="}},
+		{filter: `/age != 21`, expected: []string{}},
+		{filter: `/age > 21 or /name == "a"`, expected: []string{}},
+		{filter: `not /age > 21`, expected: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filter, func(t *testing.T) {
+			expr, err := Parse(tc.filter)
+			if err != nil {
+				t.Fatalf("Filter failed to parse: %v", err)
+			}
+			constraints := Constraints(expr)
+			if len(constraints) != len(tc.expected) {
+				t.Fatalf("Expected %d constraints but received %d", len(tc.expected), len(constraints))
+			}
+			for i, constraint := range constraints {
+				if constraint.Pointer+" "+constraint.Op != tc.expected[i] {
+					t.Fatalf("Expected constraint %q but received %q", tc.expected[i], constraint.Pointer+" "+constraint.Op)
+				}
+			}
+		})
+	}
+}
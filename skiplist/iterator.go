@@ -0,0 +1,268 @@
+package skiplist
+
+import (
+	"cmp"
+	"context"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// This struct records what a snapshot iteration needs to see the skiplist as it was
+// when the iteration began. The version is the clock value at that time. Writers that
+// come later record the values they overwrite in overrides and the nodes they remove
+// in removed, so the iteration can still return what was there before.
+type snapshot[K cmp.Ordered, V any] struct {
+	version   int64
+	mu        sync.Mutex
+	overrides map[*Node[K, V]]V // value each overwritten node had at the snapshot's version
+	removed   []removedEntry[K, V]
+}
+
+// This struct holds the key and the value at the snapshot's version of a node that
+// was removed after the snapshot began.
+type removedEntry[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+}
+
+// isOpen reports whether a start or end key leaves its side of a range open, which is
+// the case for the empty string.
+func isOpen[K any](key K) bool {
+	s, ok := any(key).(string)
+	return ok && s == ""
+}
+
+// first returns the first node at level 0 whose key is at least start.
+func (skipList *SkipList[K, V]) first(start K) *Node[K, V] {
+	if isOpen(start) {
+		return skipList.head.next[0].Load()
+	}
+	_, _, succs := skipList.find(start)
+	return succs[0]
+}
+
+// All returns an iterator over the keys and values between start and end, inclusive,
+// in key order. Empty strings leave either side of the range open, like in Query. The
+// iterator walks the skiplist without taking any locks, and returns each node that is
+// in the skiplist when the walk reaches it, so writes that happen during the walk may
+// or may not be seen. It stops when the context is cancelled.
+func (skipList *SkipList[K, V]) All(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for current := skipList.first(start); current != skipList.tail; current = current.next[0].Load() {
+			if ctx.Err() != nil {
+				return
+			}
+			if !isOpen(end) && current.key > end {
+				return
+			}
+			if !current.fullyLinked.Load() || current.marked.Load() {
+				continue
+			}
+			if !yield(current.key, *current.value.Load()) {
+				return
+			}
+		}
+	}
+}
+
+// last returns the last node at level 0 whose key is at most key, or less than it if
+// strict is set. An empty string for key stands for the end of the skiplist. It returns
+// the head if there is no such node. Like find, it searches from the top level down, so
+// every step backwards costs as much as a lookup.
+func (skipList *SkipList[K, V]) last(key K, strict bool) *Node[K, V] {
+	pred := skipList.head
+	for level := MAX_LEVEL - 1; level >= 0; level-- {
+		for next := pred.next[level].Load(); next != skipList.tail; next = pred.next[level].Load() {
+			if !isOpen(key) && (next.key > key || (strict && next.key == key)) {
+				break
+			}
+			pred = next
+		}
+	}
+	return pred
+}
+
+// Backward returns an iterator over the keys and values between start and end, inclusive,
+// in descending key order. Empty strings leave either side of the range open, like in
+// Query. Nodes only point forward, so each step searches for the node before the last
+// one returned. Like All, it takes no locks and may or may not see writes that happen
+// during the iteration. It stops when the context is cancelled.
+func (skipList *SkipList[K, V]) Backward(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for current := skipList.last(end, false); current != skipList.head; current = skipList.last(current.key, true) {
+			if ctx.Err() != nil {
+				return
+			}
+			if !isOpen(start) && current.key < start {
+				return
+			}
+			if !current.fullyLinked.Load() || current.marked.Load() {
+				continue
+			}
+			if !yield(current.key, *current.value.Load()) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot returns an iterator over the keys and values between start and end like All
+// does, but every iteration returns the range as it was when that iteration began.
+// Writes that finished before then are seen, and writes that start later are not, even
+// if they change parts of the range the iteration has not reached yet. Unlike Query
+// used to, it never starts over because of concurrent writes: instead, while the
+// iteration runs, writers record the values they overwrite and remove for it.
+func (skipList *SkipList[K, V]) Snapshot(ctx context.Context, start K, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		snap := skipList.beginSnapshot()
+		defer skipList.endSnapshot(snap)
+
+		var last K
+		hasLast := false
+		// emitRemoved yields the removed entries after the last yielded key and before
+		// the given key, or up to and including it if inclusive is set.
+		emitRemoved := func(key K, bounded bool, inclusive bool) bool {
+			entries := snap.removedBetween(start, last, hasLast, key, bounded, inclusive)
+			for _, entry := range entries {
+				if !yield(entry.key, entry.value) {
+					return false
+				}
+				last, hasLast = entry.key, true
+			}
+			return true
+		}
+
+		for current := skipList.first(start); ; current = current.next[0].Load() {
+			if ctx.Err() != nil {
+				return
+			}
+			if current == skipList.tail || (!isOpen(end) && current.key > end) {
+				emitRemoved(end, !isOpen(end), true)
+				return
+			}
+			value, present := snap.valueOf(current)
+			if !emitRemoved(current.key, true, !present) {
+				return
+			}
+			if !present || (hasLast && current.key <= last) {
+				continue
+			}
+			if !yield(current.key, value) {
+				return
+			}
+			last, hasLast = current.key, true
+		}
+	}
+}
+
+// beginSnapshot registers a new snapshot at the current clock value. The snapshot is
+// registered before the clock is read, so every write numbered after the snapshot's
+// version is sure to see it.
+func (skipList *SkipList[K, V]) beginSnapshot() *snapshot[K, V] {
+	snap := &snapshot[K, V]{overrides: make(map[*Node[K, V]]V)}
+	skipList.snapshotsMu.Lock()
+	defer skipList.snapshotsMu.Unlock()
+	skipList.snapshots[snap] = struct{}{}
+	skipList.activeSnapshots.Add(1)
+	snap.version = skipList.clock.Load()
+	return snap
+}
+
+// endSnapshot unregisters a snapshot once its iteration is done.
+func (skipList *SkipList[K, V]) endSnapshot(snap *snapshot[K, V]) {
+	skipList.snapshotsMu.Lock()
+	delete(skipList.snapshots, snap)
+	skipList.activeSnapshots.Add(-1)
+	skipList.snapshotsMu.Unlock()
+}
+
+// recordOverwrite tells every snapshot older than the write with the given clock value
+// the value the node had before the write. It must be called before the new value is
+// stored. Only the first overwrite after a snapshot began is recorded for it, since
+// that one replaced the value the node had at the snapshot's version.
+func (skipList *SkipList[K, V]) recordOverwrite(node *Node[K, V], version int64) {
+	if skipList.activeSnapshots.Load() == 0 {
+		return
+	}
+	skipList.snapshotsMu.Lock()
+	defer skipList.snapshotsMu.Unlock()
+	for snap := range skipList.snapshots {
+		if snap.version >= version || node.insertedAt > snap.version {
+			continue
+		}
+		snap.mu.Lock()
+		if _, recorded := snap.overrides[node]; !recorded {
+			snap.overrides[node] = *node.value.Load()
+		}
+		snap.mu.Unlock()
+	}
+}
+
+// recordRemoval tells every snapshot older than the removal with the given clock value
+// about the removed node, so the snapshot can still return it after it is unlinked.
+// It must be called before the node is unlinked.
+func (skipList *SkipList[K, V]) recordRemoval(node *Node[K, V], version int64) {
+	if skipList.activeSnapshots.Load() == 0 {
+		return
+	}
+	skipList.snapshotsMu.Lock()
+	defer skipList.snapshotsMu.Unlock()
+	for snap := range skipList.snapshots {
+		if snap.version >= version || node.insertedAt > snap.version {
+			continue
+		}
+		snap.mu.Lock()
+		value, overwritten := snap.overrides[node]
+		if !overwritten {
+			value = *node.value.Load()
+		}
+		snap.removed = append(snap.removed, removedEntry[K, V]{key: node.key, value: value})
+		snap.mu.Unlock()
+	}
+}
+
+// valueOf returns the value the node had at the snapshot's version, and false if the
+// node was not in the skiplist then.
+func (snap *snapshot[K, V]) valueOf(node *Node[K, V]) (V, bool) {
+	if node.insertedAt > snap.version {
+		return *new(V), false
+	}
+	if node.marked.Load() && node.removedAt.Load() <= snap.version {
+		return *new(V), false
+	}
+	// The current value is read before the override, since writers record the
+	// override before storing a new value
+	value := *node.value.Load()
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	if override, overwritten := snap.overrides[node]; overwritten {
+		return override, true
+	}
+	return value, true
+}
+
+// removedBetween returns, in key order, the removed entries whose keys are at least start,
+// after last if hasLast is set, and before key if bounded is set, or up to and including
+// it if inclusive is also set.
+func (snap *snapshot[K, V]) removedBetween(start K, last K, hasLast bool, key K, bounded bool, inclusive bool) []removedEntry[K, V] {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	var entries []removedEntry[K, V]
+	for _, entry := range snap.removed {
+		if !isOpen(start) && entry.key < start {
+			continue
+		}
+		if hasLast && entry.key <= last {
+			continue
+		}
+		if bounded && (entry.key > key || (entry.key == key && !inclusive)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	// Each key is in the list at most once, since only nodes that were in the skiplist
+	// at the snapshot's version are recorded
+	slices.SortFunc(entries, func(a, b removedEntry[K, V]) int { return cmp.Compare(a.key, b.key) })
+	return entries
+}
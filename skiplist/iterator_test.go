@@ -0,0 +1,151 @@
+package skiplist
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setCheck returns an update check that stores the given value.
+func setCheck(value int) UpdateCheck[string, int] {
+	return func(key string, currValue int, exists bool) (int, error) {
+		return value, nil
+	}
+}
+
+func TestSkipListAll(t *testing.T) {
+	skiplist := NewSkipList[string, int]()
+	for i, key := range []string{"a", "b", "c", "d"} {
+		skiplist.Upsert(key, setCheck(i))
+	}
+
+	keys := []string{}
+	for key := range skiplist.All(context.TODO(), "b", "c") {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"b", "c"}, keys)
+
+	// Stopping early and cancelling both end the iteration
+	keys = []string{}
+	for key := range skiplist.All(context.TODO(), "", "") {
+		keys = append(keys, key)
+		if key == "b" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, keys)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range skiplist.All(ctx, "", "") {
+		t.Fatalf("A cancelled iteration should not yield anything")
+	}
+}
+
+func TestSkipListBackward(t *testing.T) {
+	skiplist := NewSkipList[string, int]()
+	for i, key := range []string{"c", "a", "e", "b", "d"} {
+		skiplist.Upsert(key, setCheck(i))
+	}
+	skiplist.Remove("d")
+
+	testCases := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{start: "", end: "", expected: []string{"e", "c", "b", "a"}},
+		{start: "b", end: "d", expected: []string{"c", "b"}},
+		{start: "bb", end: "dd", expected: []string{"c"}},
+		{start: "", end: "b", expected: []string{"b", "a"}},
+		{start: "c", end: "", expected: []string{"e", "c"}},
+		{start: "x", end: "", expected: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.start+"-"+tc.end, func(t *testing.T) {
+			keys := []string{}
+			for key := range skiplist.Backward(context.TODO(), tc.start, tc.end) {
+				keys = append(keys, key)
+			}
+			assert.Equal(t, tc.expected, keys)
+		})
+	}
+
+	// Stopping early ends the iteration
+	keys := []string{}
+	for key := range skiplist.Backward(context.TODO(), "", "") {
+		keys = append(keys, key)
+		if key == "c" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"e", "c"}, keys)
+}
+
+func TestSkipListSnapshot(t *testing.T) {
+	skiplist := NewSkipList[string, int]()
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		skiplist.Upsert(key, setCheck(i))
+	}
+
+	// Change the parts of the range the iteration has not reached yet
+	keys := []string{}
+	values := []int{}
+	for key, value := range skiplist.Snapshot(context.TODO(), "", "") {
+		if key == "a" {
+			skiplist.Upsert("b", setCheck(100))
+			skiplist.Remove("c")
+			skiplist.Upsert("cc", setCheck(200))
+			skiplist.Remove("d")
+			skiplist.Upsert("d", setCheck(300))
+			skiplist.Remove("e")
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, values)
+
+	// A new iteration sees the writes
+	results, err := skiplist.Query(context.TODO(), "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 100, 200, 300}, results)
+	assert.Equal(t, int64(0), skiplist.activeSnapshots.Load())
+}
+
+func TestSkipListSnapshotConcurrency(t *testing.T) {
+	skiplist := NewSkipList[string, int]()
+	for i := 0; i < 100; i++ {
+		skiplist.Upsert("key"+strconv.Itoa(i), setCheck(i))
+	}
+
+	// Writers keep every key's value at its index, so any snapshot holds each key
+	// exactly once with either its index or the index plus 1000
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ; i = (i + 7) % 100 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := "key" + strconv.Itoa(i)
+				skiplist.Upsert(key, setCheck(i+1000))
+				skiplist.Upsert(key, setCheck(i))
+			}
+		}(w)
+	}
+	for n := 0; n < 50; n++ {
+		results, err := skiplist.Query(context.TODO(), "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, 100, len(results))
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,51 @@
+package skiplist
+
+import (
+	"cmp"
+	"context"
+)
+
+// A Range selects the keys between Start and End. Each bound is inclusive unless its
+// Exclude flag is set, and like in Query, an empty string leaves its side open, in which
+// case its Exclude flag does not matter.
+type Range[K cmp.Ordered] struct {
+	Start        K
+	End          K
+	ExcludeStart bool
+	ExcludeEnd   bool
+}
+
+// Contains reports whether the key is in the range.
+func (keys Range[K]) Contains(key K) bool {
+	if !isOpen(keys.Start) && (key < keys.Start || (keys.ExcludeStart && key == keys.Start)) {
+		return false
+	}
+	if !isOpen(keys.End) && (key > keys.End || (keys.ExcludeEnd && key == keys.End)) {
+		return false
+	}
+	return true
+}
+
+// QueryRange returns the values of the keys in the range, in key order, like Query does
+// for a range with both bounds included. It returns an error if the context is cancelled
+// before the query finishes.
+func (skipList *SkipList[K, V]) QueryRange(ctx context.Context, keys Range[K]) (results []V, err error) {
+	return QueryRange[K, V](ctx, skipList, keys)
+}
+
+// QueryRange collects the values of the keys in the range from a snapshot of index, in
+// key order. The snapshot covers the range with both bounds included, and the keys on an
+// excluded bound are left out while collecting, so every DBIndex can answer QueryRange
+// on top of its Snapshot method.
+func QueryRange[K cmp.Ordered, V any](ctx context.Context, index DBIndex[K, V], keys Range[K]) ([]V, error) {
+	results := []V{}
+	for key, value := range index.Snapshot(ctx, keys.Start, keys.End) {
+		if keys.Contains(key) {
+			results = append(results, value)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,44 @@
+package skiplist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipListQueryRange(t *testing.T) {
+	skiplist := NewSkipList[string, string]()
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		skiplist.Upsert(key, func(key string, currValue string, exists bool) (string, error) {
+			return key, nil
+		})
+	}
+
+	testCases := []struct {
+		name     string
+		keys     Range[string]
+		expected []string
+	}{
+		{"inclusive", Range[string]{Start: "b", End: "d"}, []string{"b", "c", "d"}},
+		{"exclusive", Range[string]{Start: "b", End: "d", ExcludeStart: true, ExcludeEnd: true}, []string{"c"}},
+		{"half open", Range[string]{Start: "b", End: "d", ExcludeEnd: true}, []string{"b", "c"}},
+		{"open start", Range[string]{End: "b", ExcludeEnd: true}, []string{"a"}},
+		{"open end", Range[string]{Start: "d", ExcludeStart: true}, []string{"e"}},
+		{"open both", Range[string]{ExcludeStart: true, ExcludeEnd: true}, []string{"a", "b", "c", "d", "e"}},
+		{"missing bounds", Range[string]{Start: "bb", End: "dd", ExcludeStart: true, ExcludeEnd: true}, []string{"c", "d"}},
+		{"single key excluded", Range[string]{Start: "c", End: "c", ExcludeEnd: true}, []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := skiplist.QueryRange(context.TODO(), tc.keys)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, results)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := skiplist.QueryRange(ctx, Range[string]{})
+	assert.Error(t, err, "QueryRange should fail once the context is cancelled")
+}
@@ -6,6 +6,7 @@ package skiplist
 import (
 	"cmp"
 	"context"
+	"iter"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -16,22 +17,39 @@ const MAX_LEVEL = 11
 
 type UpdateCheck[K cmp.Ordered, V any] func(key K, currValue V, exists bool) (newValue V, err error)
 
-// This is the interface that holds all of the skiplist methods.
+// This is the interface that holds all of the skiplist methods. QueryRange works like
+// Query, but either bound of its range may be excluded. All and Snapshot stream the keys
+// and values between start and end in key order instead of collecting them like Query
+// does, and Backward streams them in descending key order. All and Backward reflect
+// whatever state each entry is in when the iteration reaches it, while Snapshot reflects
+// the whole range as it was when the iteration began. They all stop early if the context
+// is cancelled.
 type DBIndex[K cmp.Ordered, V any] interface {
 	Find(key K) (foundValue V, found bool)
 	Upsert(key K, check UpdateCheck[K, V]) (updated bool, err error)
 	Remove(key K) (removedValue V, removed bool)
 	Query(ctx context.Context, start K, end K) (results []V, err error)
+	QueryRange(ctx context.Context, keys Range[K]) (results []V, err error)
+	All(ctx context.Context, start K, end K) iter.Seq2[K, V]
+	Backward(ctx context.Context, start K, end K) iter.Seq2[K, V]
+	Snapshot(ctx context.Context, start K, end K) iter.Seq2[K, V]
 }
 
 // This struct is used to represent a list of databases, a list of documents,
 // or a list of collections. It has a field representing the head of the list, a field for the tail,
 // and a field that tracks the number of operations that have been performed on the skiplist.
-// The count field is used in the Query method.
+// The count field is used in the Query method. The clock field numbers every write, and
+// the snapshots field holds the snapshot iterations in progress, which writers tell
+// about the values they overwrite and remove.
 type SkipList[K cmp.Ordered, V any] struct {
 	head  *Node[K, V] // beginning of the linked list
 	tail  *Node[K, V] // tail of the linked list
 	count atomic.Int64
+	clock atomic.Int64
+
+	snapshotsMu     sync.Mutex
+	snapshots       map[*snapshot[K, V]]struct{}
+	activeSnapshots atomic.Int64 // number of snapshots, so writers can skip snapshotsMu
 }
 
 // This struct is used as a node in a skiplist struct. It contains a mutex lock to control acess,
@@ -47,6 +65,8 @@ type Node[K cmp.Ordered, V any] struct {
 	marked      atomic.Bool
 	fullyLinked atomic.Bool
 	next        []atomic.Pointer[Node[K, V]]
+	insertedAt  int64        // clock value of the write that inserted the node
+	removedAt   atomic.Int64 // clock value of the write that removed the node, set before marked
 }
 
 // NewSkipList initializes a new empty skiplist. It initializes the head and tail nodes
@@ -79,14 +99,16 @@ func NewSkipList[K cmp.Ordered, V any]() *SkipList[K, V] {
 	skipList.count.Store(0)
 	skipList.head = headNode
 	skipList.tail = tailNode
+	skipList.snapshots = make(map[*snapshot[K, V]]struct{})
 	return skipList
 }
 
-// randomLevel generates a random level for node insertion
+// randomLevel generates a random level for node insertion. The top level of a node is
+// used as an index into slices of length MAX_LEVEL, so it stays below MAX_LEVEL.
 func randomLevel() int {
 	rand.Seed(time.Now().UnixNano())
 	level := 1
-	for rand.Float64() < 0.5 && level < MAX_LEVEL {
+	for rand.Float64() < 0.5 && level < MAX_LEVEL-1 {
 		level++
 	}
 	return level
@@ -133,6 +155,7 @@ func (skiplist *SkipList[K, V]) Upsert(key K, check UpdateCheck[K, V]) (updated
 
 			// Update the value and unlock the node
 
+			skiplist.recordOverwrite(foundNode, skiplist.clock.Add(1))
 			foundNode.value.Store(&newValue)
 			foundNode.mutex.Unlock()
 			delete(lockedNodes, foundNode)
@@ -182,6 +205,7 @@ func (skiplist *SkipList[K, V]) Upsert(key K, check UpdateCheck[K, V]) (updated
 		// Create a new node with the zero value of type V
 		newNode := &Node[K, V]{
 			key:         key,
+			insertedAt:  skiplist.clock.Add(1),
 			next:        make([]atomic.Pointer[Node[K, V]], topLevel+1),
 			topLevel:    topLevel,
 			fullyLinked: atomic.Bool{}, // Not fully linked yet
@@ -205,12 +229,14 @@ func (skiplist *SkipList[K, V]) Upsert(key K, check UpdateCheck[K, V]) (updated
 		// Set the value returned by the check function
 		newNode.value.Store(&newValue)
 
-		// Insert the new node into the skip list at each level
+		// Insert the new node into the skip list at each level. Its successors are set
+		// before any predecessor points to it, so a concurrent find never reaches a nil next
 		for level = 0; level <= topLevel; level++ {
-			predNode := preds[level]
-			predNode.next[level].Store(newNode)
 			newNode.next[level].Store(succs[level])
 		}
+		for level = 0; level <= topLevel; level++ {
+			preds[level].next[level].Store(newNode)
+		}
 		// Mark the node as fully linked and unlock everything
 		newNode.fullyLinked.Store(true)
 		for level = highestLocked; level >= 0; level-- {
@@ -271,7 +297,10 @@ func (skiplist *SkipList[K, V]) Remove(key K) (removedValue V, removed bool) {
 			victim.mutex.Lock()
 			lockedNodes[victim] = true
 
+			removedAt := skiplist.clock.Add(1)
+			victim.removedAt.Store(removedAt)
 			victim.marked.Store(true)
+			skiplist.recordRemoval(victim, removedAt)
 			isMarked = true
 		}
 
@@ -388,80 +417,21 @@ func (s *SkipList[K, V]) Find(key K) (foundValue V, found bool) {
 // Query takes in a context, a start, and an end value as input, and attempts to return
 // the contents of a given skiplist.
 // Query can either return everything inside a given skiplist, or it can return only the contents
-// of a skiplist that lie withing a certain range. It will also return a boolean, true indicating success
-// and false indicating failure.
+// of a skiplist that lie withing a certain range. It will also return an error if the context
+// is cancelled before the query finishes.
 // The inputs 'start' and 'end' indicate the range that the function will query over. If 'start' is an empty
 // string, then the Query function will begin at the beginning of the skiplist. If 'end' is an empty string,
 // then the function will query until the end of the skiplist. If both inputs are empty string,
 // The function will query and return everything in the skiplist.
+// The results are collected from a snapshot, so they are consistent even if writes happen
+// while the query runs, and the query never has to start over because of them.
 func (skipList *SkipList[K, V]) Query(ctx context.Context, start K, end K) (results []V, err error) {
-	// Get the current count of the skip list before starting the query
-	preCount := skipList.count.Load()
-
-	// Find the node to start the traversal from
-	var current *Node[K, V]
-	// Type assertion to check if K is a string
-	if startStr, ok := any(start).(string); ok && startStr == "" {
-		// If start is an empty string, start from the head of the skip list
-		current = skipList.head.next[0].Load()
-	} else {
-		// Otherwise, find the node to start from
-		_, _, succs := skipList.find(start)
-		//     for i, succNode := range succs {
-		// 			if succNode != nil {
-		// 				fmt.Printf("Level %d: succNode.key = %v\n", i, succNode.key)
-		// 			} else {
-		// 				fmt.Printf("Level %d: succNode is nil\n", i)
-		// 			}
-		// 		}
-		//current = pred[len(pred)-1].next[0].Load()
-		current = succs[0]
-	}
-	// Find the node to end the traversal from (successor of the start key)
-	var goToEnd bool
-	// Type assertion to check if K is a string
-	if endStr, ok := any(end).(string); ok && endStr == "" {
-		// If start is an empty string, start from the head of the skip list
-		goToEnd = true
-	} else {
-		goToEnd = false
-	}
-
-	// Initialize results array
 	results = []V{}
-
-	// Traverse from the found node at level 0
-	for current != skipList.tail {
-		// Check if the context is done (to handle llations)
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-			// Continue the query as the context is valid
-		}
-		if !goToEnd {
-			// If current key is greater than the end, stop the traversal
-			if current.key > end {
-				break
-			}
-		}
-
-		// Collect values if the node is fully linked and not marked for removal
-		if current.fullyLinked.Load() && !current.marked.Load() {
-			results = append(results, *current.value.Load())
-		}
-
-		// Move to the next node in the skip list at level 0
-		current = current.next[0].Load()
+	for _, value := range skipList.Snapshot(ctx, start, end) {
+		results = append(results, value)
 	}
-
-	// Get the current count of the skip list after the query
-	postCount := skipList.count.Load()
-
-	// If the count has changed during the query, retry the query
-	if postCount != preCount {
-		return skipList.Query(ctx, start, end) // Retry the query
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-
 	return results, nil
 }
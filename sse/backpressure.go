@@ -0,0 +1,140 @@
+package sse
+
+import (
+	"context"
+	"fmt"
+)
+
+// Number of events a subscription holds for its client before its backpressure policy applies.
+const eventBufferSize = 100
+
+// A Backpressure policy says what happens to the events of a subscriber whose client reads
+// them slower than they are sent, once the subscriber's channel is full.
+type Backpressure string
+
+const (
+	Replay     Backpressure = "replay"      // catch up from the event log later, the default
+	DropOldest Backpressure = "drop-oldest" // drop the oldest waiting event to make room
+	DropNewest Backpressure = "drop-newest" // drop the new event and send a "gap" event in its place
+	Disconnect Backpressure = "disconnect"  // close the connection, so the client reconnects and replays
+)
+
+// Backpressures returns every backpressure policy.
+func Backpressures() []Backpressure {
+	return []Backpressure{Replay, DropOldest, DropNewest, Disconnect}
+}
+
+// ParseBackpressure returns the backpressure policy with the given name. The empty name
+// stands for Replay.
+func ParseBackpressure(name string) (Backpressure, error) {
+	if name == "" {
+		return Replay, nil
+	}
+	for _, policy := range Backpressures() {
+		if string(policy) == name {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown backpressure policy %q, expected one of %v", name, Backpressures())
+}
+
+// A gap is a run of events a DropNewest subscriber dropped, from the event with id from
+// to the one with id to.
+type gap struct {
+	from    uint64
+	to      uint64
+	dropped uint64
+}
+
+// offer hands the event to the subscriber, applying its backpressure policy if its
+// channel is full.
+func (s *Subscriber) offer(sent sentEvent) {
+	select {
+	case s.event <- sent:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		for {
+			select {
+			case s.event <- sent:
+				return
+			default:
+			}
+			// Make room, unless the client just did
+			select {
+			case <-s.event:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case DropNewest:
+		s.dropped.Add(1)
+		s.mu.Lock()
+		if s.gap.dropped == 0 {
+			s.gap.from = sent.id
+		}
+		s.gap.to = sent.id
+		s.gap.dropped++
+		s.mu.Unlock()
+	case Disconnect:
+		s.dropped.Add(1)
+		s.closeOnce.Do(func() { close(s.closed) })
+	default:
+		s.behind.Store(true)
+	}
+}
+
+// takeGap returns the events the subscriber dropped since the last call, if it dropped
+// any before the event with the given id.
+func (s *Subscriber) takeGap(before uint64) (gap, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gap.dropped == 0 || s.gap.from >= before {
+		return gap{}, false
+	}
+	dropped := s.gap
+	s.gap = gap{}
+	return dropped, true
+}
+
+// SubscriptionStats describes one subscription and how well its client keeps up. ID
+// identifies the subscription without revealing the token it was made with.
+type SubscriptionStats struct {
+	ID           uint64       `json:"id"`
+	Resource     string       `json:"resource"`
+	Backpressure Backpressure `json:"backpressure"`
+	ConnectedAt  int64        `json:"connectedAt"` // Unix milliseconds
+	Queued       int          `json:"queued"`      // events waiting in the channel
+	Delivered    uint64       `json:"delivered"`   // events sent to the client
+	Dropped      uint64       `json:"dropped"`     // events the client will never receive
+}
+
+// Stats returns the stats of every current subscription whose resource keep returns true
+// for, ordered by resource. A nil keep returns every subscription.
+func (sh *SubscriberHandler) Stats(ctx context.Context, keep func(resource string) bool) []SubscriptionStats {
+	stats := []SubscriptionStats{}
+	// A missing handler has no subscriptions
+	if sh == nil {
+		return stats
+	}
+	for resource, subscriptions := range sh.resourceToken.All(ctx, "", "") {
+		if keep != nil && !keep(resource) {
+			continue
+		}
+		for _, subscription := range subscriptions.All(ctx, "", "") {
+			stats = append(stats, SubscriptionStats{
+				ID:           subscription.id,
+				Resource:     resource,
+				Backpressure: subscription.policy,
+				ConnectedAt:  subscription.connectedAt,
+				Queued:       len(subscription.event),
+				Delivered:    subscription.delivered.Load(),
+				Dropped:      subscription.dropped.Load(),
+			})
+		}
+	}
+	return stats
+}
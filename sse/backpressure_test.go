@@ -0,0 +1,153 @@
+package sse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+func TestParseBackpressure(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Backpressure
+		valid    bool
+	}{
+		{"", Replay, true},
+		{"replay", Replay, true},
+		{"drop-oldest", DropOldest, true},
+		{"drop-newest", DropNewest, true},
+		{"disconnect", Disconnect, true},
+		{"drop", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseBackpressure(tt.name)
+			if (err == nil) != tt.valid || policy != tt.expected {
+				t.Fatalf("Expected %q (valid %v) but received %q (%v)", tt.expected, tt.valid, policy, err)
+			}
+		})
+	}
+}
+
+// overflow sends events to the resource while the stream cannot be written to, so the
+// subscription's channel overflows.
+func overflow(sh *SubscriberHandler, w *streamRecorder, resource string, events int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := 1; i <= events; i++ {
+		sh.Notify(resource, "update", strconv.Itoa(i))
+	}
+}
+
+// eventIDs returns the ids of the update events received so far, and the events that
+// are not updates.
+func eventIDs(t *testing.T, w *streamRecorder) ([]int, []string) {
+	var ids []int
+	var others []string
+	for _, event := range w.events() {
+		id, name, _ := strings.Cut(event, " ")
+		if !strings.HasPrefix(name, "update:") {
+			others = append(others, event)
+			continue
+		}
+		number, err := strconv.Atoi(id)
+		if err != nil {
+			t.Fatalf("Invalid event id in %s", event)
+		}
+		ids = append(ids, number)
+	}
+	return ids, others
+}
+
+func TestBackpressure(t *testing.T) {
+	const events = 150
+	tests := []struct {
+		policy  Backpressure
+		dropped bool   // whether the client misses events
+		marker  string // prefix of the event sent in place of the dropped ones
+	}{
+		{Replay, false, ""},
+		{DropOldest, true, ""},
+		{DropNewest, true, "gap:"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+			sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+			w, disconnect := connect(t, sh, "db", "", tt.policy)
+			defer disconnect()
+			overflow(sh, w, "db", events)
+
+			// Every event is either delivered or counted as dropped
+			var stats SubscriptionStats
+			waitFor(t, func() bool {
+				stats = sh.Stats(context.Background(), nil)[0]
+				return stats.Delivered+stats.Dropped == events && stats.Queued == 0
+			})
+			if stats.Backpressure != tt.policy || (stats.Dropped > 0) != tt.dropped {
+				t.Fatalf("Unexpected stats %+v", stats)
+			}
+
+			// The events that were delivered arrive in order and end with the newest one
+			if tt.marker != "" {
+				waitFor(t, func() bool {
+					_, others := eventIDs(t, w)
+					return len(others) > 0
+				})
+			}
+			ids, others := eventIDs(t, w)
+			if len(ids) != int(stats.Delivered) {
+				t.Fatalf("Expected %d events but received %d", stats.Delivered, len(ids))
+			}
+			for i := 1; i < len(ids); i++ {
+				if ids[i] <= ids[i-1] {
+					t.Fatalf("Events out of order: %v", ids)
+				}
+			}
+			if tt.policy != DropNewest && ids[len(ids)-1] != events {
+				t.Fatalf("Expected the newest event to arrive: %v", ids)
+			}
+			if tt.marker == "" && len(others) > 0 || tt.marker != "" && (len(others) != 1 || !strings.Contains(others[0], tt.marker) || !strings.Contains(others[0], fmt.Sprintf(`"dropped":%d`, stats.Dropped))) {
+				t.Fatalf("Unexpected marker events %v for %d dropped events", others, stats.Dropped)
+			}
+		})
+	}
+}
+
+func TestBackpressureDisconnect(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	w, disconnect := connect(t, sh, "db", "", Disconnect)
+	defer disconnect()
+	overflow(sh, w, "db", 150)
+
+	// The slow client is disconnected, and can reconnect to replay what it missed
+	waitFor(t, func() bool { return len(sh.Stats(context.Background(), nil)) == 0 })
+	ids, _ := eventIDs(t, w)
+	last := "0"
+	if len(ids) > 0 {
+		last = strconv.Itoa(ids[len(ids)-1])
+	}
+	w, reconnect := connect(t, sh, "db", last, Disconnect)
+	defer reconnect()
+	waitFor(t, func() bool {
+		ids, _ := eventIDs(t, w)
+		return len(ids) > 0 && ids[len(ids)-1] == 150
+	})
+}
+
+func TestUnknownBackpressure(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	w := httptest.NewRecorder()
+	sh.SSEHandler(w, httptest.NewRequest(http.MethodGet, "/db?backpressure=drop", nil), "db", "token")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but received %d", w.Code)
+	}
+}
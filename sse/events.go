@@ -0,0 +1,40 @@
+package sse
+
+import "encoding/json"
+
+// An EventType names what happened to the resource an event is about. Subscribers of a
+// database, collection, or document receive the events of everything inside it as well.
+type EventType string
+
+const (
+	Create EventType = "create" // a database, collection, or document was created
+	Update EventType = "update" // a document was overwritten or restored to an earlier revision
+	Delete EventType = "delete" // a database, collection, or document was deleted
+	Patch  EventType = "patch"  // a document was patched
+
+	// Events about the subscription itself rather than a resource
+	Reset EventType = "reset" // missed events are gone, so the client should read the resource again
+	Gap   EventType = "gap"   // the subscription dropped events, see DropNewest
+)
+
+// An Event describes a change to the database, collection, or document at Path. Content
+// holds the contents of a document after it was created, updated, or patched, or before
+// it was deleted, and Owner holds the user who created the document. Both are empty for
+// databases and collections.
+type Event struct {
+	Type    EventType
+	Path    string
+	Content []byte
+	Owner   string
+}
+
+// data returns the data subscribers are sent for the event.
+func (event Event) data() string {
+	data, _ := json.Marshal(map[string]string{"path": event.Path})
+	return string(data)
+}
+
+// Publish sends the event to every subscriber of its path and of the paths containing it.
+func (sh *SubscriberHandler) Publish(event Event) {
+	sh.notify(event.Path, event.Type, event.data(), event.Content, event.Owner)
+}
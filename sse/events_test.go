@@ -0,0 +1,111 @@
+package sse
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+func TestPublish(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+
+	streams := map[string]*streamRecorder{}
+	for _, resource := range []string{"db", "db/doc", "db/doc/col", "db/doc/col/d"} {
+		w, disconnect := connect(t, sh, resource, "", "")
+		defer disconnect()
+		streams[resource] = w
+	}
+
+	sh.Publish(Event{Type: Create, Path: "db/doc"})
+	sh.Publish(Event{Type: Create, Path: "db/doc/col"})
+	sh.Publish(Event{Type: Create, Path: "db/doc/col/d", Content: []byte(`{}`)})
+	sh.Publish(Event{Type: Patch, Path: "db/doc/col/d", Content: []byte(`{"a":1}`)})
+	sh.Publish(Event{Type: Update, Path: "db/doc/col/d", Content: []byte(`{"a":2}`)})
+	sh.Publish(Event{Type: Delete, Path: "db/doc/col"})
+
+	// Every level is told about everything inside it
+	expectEvents(t, streams["db"],
+		`1 create:{"path":"db/doc"}`,
+		`2 create:{"path":"db/doc/col"}`,
+		`3 create:{"path":"db/doc/col/d"}`,
+		`4 patch:{"path":"db/doc/col/d"}`,
+		`5 update:{"path":"db/doc/col/d"}`,
+		`6 delete:{"path":"db/doc/col"}`)
+	expectEvents(t, streams["db/doc"],
+		`1 create:{"path":"db/doc"}`,
+		`2 create:{"path":"db/doc/col"}`,
+		`3 create:{"path":"db/doc/col/d"}`,
+		`4 patch:{"path":"db/doc/col/d"}`,
+		`5 update:{"path":"db/doc/col/d"}`,
+		`6 delete:{"path":"db/doc/col"}`)
+	expectEvents(t, streams["db/doc/col"],
+		`1 create:{"path":"db/doc/col"}`,
+		`2 create:{"path":"db/doc/col/d"}`,
+		`3 patch:{"path":"db/doc/col/d"}`,
+		`4 update:{"path":"db/doc/col/d"}`,
+		`5 delete:{"path":"db/doc/col"}`)
+	expectEvents(t, streams["db/doc/col/d"],
+		`1 create:{"path":"db/doc/col/d"}`,
+		`2 patch:{"path":"db/doc/col/d"}`,
+		`3 update:{"path":"db/doc/col/d"}`)
+}
+
+func TestDuplicateSubscription(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+
+	_, disconnect := connect(t, sh, "db", "", "")
+	defer disconnect()
+
+	// A second stream with the same token must not share the first one's subscription
+	w := httptest.NewRecorder()
+	sh.SSEHandler(w, httptest.NewRequest(http.MethodGet, "/db", nil), "db", "token")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 but received %d", w.Code)
+	}
+}
+
+func TestConcurrentPublish(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	sh.SubscribePath("db")
+
+	const writers = 8
+	const events = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				sh.Publish(Event{Type: Update, Path: fmt.Sprintf("db/doc%d", i), Content: []byte(`{}`)})
+			}
+		}(i)
+		// Subscriptions come and go while events are published
+		go func(i int) {
+			defer wg.Done()
+			token := fmt.Sprintf("token%d", i)
+			for j := 0; j < events; j++ {
+				if err := sh.addSubscription("db", token, httptest.NewRequest(http.MethodGet, "/db", nil)); err != nil {
+					t.Errorf("Subscription failed: %v", err)
+					return
+				}
+				if err := sh.deleteSubscription("db", token); err != nil {
+					t.Errorf("Unsubscribing failed: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every event got its own id
+	if newest := sh.eventLogFor("db").newest(); newest != writers*events {
+		t.Fatalf("Expected %d events but %d were logged", writers*events, newest)
+	}
+}
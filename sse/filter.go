@@ -0,0 +1,40 @@
+package sse
+
+import (
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// A Filter selects the events a subscription receives, so clients are not sent events
+// they have no use for. The zero Filter selects every event.
+type Filter struct {
+	// Keys holds the names of the databases, documents, or collections directly inside
+	// the subscribed resource whose events are selected. Events about the resource
+	// itself are always selected.
+	Keys skiplist.Range[string]
+
+	// Content selects events about documents whose contents match it, evaluated against
+	// the contents the document has after the event. Events that are not about a
+	// document are always selected. A nil Content selects every event.
+	Content query.Expr
+
+	// Readable reports whether the subscriber may read the document at the given path,
+	// which was created by owner. Events about documents it returns false for are not
+	// selected, while events that are not about a document are. A nil Readable selects
+	// every event.
+	Readable func(path string, owner string) bool
+}
+
+// matches reports whether the filter selects the event.
+func (filter Filter) matches(sent sentEvent) bool {
+	if sent.key != "" && !filter.Keys.Contains(sent.key) {
+		return false
+	}
+	if filter.Readable != nil && sent.owner != "" && !filter.Readable(sent.path, sent.owner) {
+		return false
+	}
+	if filter.Content != nil && sent.content != nil && !query.MatchContent(filter.Content, sent.content) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/query"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+func TestFilterMatches(t *testing.T) {
+	adults, err := query.Parse("/age > 30")
+	if err != nil {
+		t.Fatalf("Invalid test filter: %v", err)
+	}
+	tests := []struct {
+		name     string
+		filter   Filter
+		sent     sentEvent
+		expected bool
+	}{
+		{"no filter", Filter{}, sentEvent{key: "doc", content: []byte(`{"age":1}`)}, true},
+		{"key in interval", Filter{Keys: skiplist.Range[string]{Start: "a", End: "m"}}, sentEvent{key: "julia"}, true},
+		{"key outside interval", Filter{Keys: skiplist.Range[string]{Start: "a", End: "m"}}, sentEvent{key: "zoe"}, false},
+		{"key at excluded end", Filter{Keys: skiplist.Range[string]{Start: "a", End: "m", ExcludeEnd: true}}, sentEvent{key: "m"}, false},
+		{"resource itself", Filter{Keys: skiplist.Range[string]{Start: "a", End: "m"}}, sentEvent{}, true},
+		{"content matches", Filter{Content: adults}, sentEvent{key: "doc", content: []byte(`{"age":31}`)}, true},
+		{"content does not match", Filter{Content: adults}, sentEvent{key: "doc", content: []byte(`{"age":30}`)}, false},
+		{"content missing field", Filter{Content: adults}, sentEvent{key: "doc", content: []byte(`{}`)}, false},
+		{"not a document", Filter{Content: adults}, sentEvent{key: "col"}, true},
+		{"both match", Filter{Keys: skiplist.Range[string]{Start: "a"}, Content: adults}, sentEvent{key: "b", content: []byte(`{"age":40}`)}, true},
+		{"only content matches", Filter{Keys: skiplist.Range[string]{Start: "c"}, Content: adults}, sentEvent{key: "b", content: []byte(`{"age":40}`)}, false},
+		{"readable document", Filter{Readable: ownedBy("julia")}, sentEvent{path: "db/doc", key: "doc", owner: "julia"}, true},
+		{"unreadable document", Filter{Readable: ownedBy("julia")}, sentEvent{path: "db/doc", key: "doc", owner: "zoe"}, false},
+		{"unreadable matching document", Filter{Content: adults, Readable: ownedBy("julia")}, sentEvent{path: "db/doc", key: "doc", content: []byte(`{"age":40}`), owner: "zoe"}, false},
+		{"readable not a document", Filter{Readable: ownedBy("julia")}, sentEvent{path: "db/col", key: "col"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.matches(tt.sent) != tt.expected {
+				t.Fatalf("Expected matches to return %v", tt.expected)
+			}
+		})
+	}
+}
+
+// ownedBy returns a Readable that lets the subscriber read only the documents the user created.
+func ownedBy(user string) func(path string, owner string) bool {
+	return func(path string, owner string) bool {
+		return owner == user
+	}
+}
+
+func TestNotifyFiltered(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	adults, _ := query.Parse("/age > 30")
+	sh.SubscribePath("db/doc/users")
+	err := sh.addFilteredSubscription("db/doc/users", "token", httptest.NewRequest(http.MethodGet, "/", nil), Filter{Keys: skiplist.Range[string]{Start: "a", End: "m"}, Content: adults})
+	if err != nil {
+		t.Fatalf("Subscription failed: %v", err)
+	}
+
+	sh.Publish(Event{Type: Create, Path: "db/doc/users/bob", Content: []byte(`{"age":40}`)})
+	sh.Publish(Event{Type: Create, Path: "db/doc/users/carol", Content: []byte(`{"age":20}`)})
+	sh.Publish(Event{Type: Update, Path: "db/doc/users/zoe", Content: []byte(`{"age":50}`)})
+	sh.Publish(Event{Type: Create, Path: "db/doc/users/bob/posts/p1", Content: []byte(`{"title":"hi"}`)})
+	sh.Publish(Event{Type: Delete, Path: "db/doc/users/dave", Content: []byte(`{"age":35}`)})
+	sh.Publish(Event{Type: Delete, Path: "db/doc/users"})
+
+	subscriptions, _ := resourceToken.Find("db/doc/users")
+	subscription, _ := subscriptions.Find("token")
+	expected := []string{
+		`{"path":"db/doc/users/bob"}`,
+		`{"path":"db/doc/users/dave"}`,
+		`{"path":"db/doc/users"}`,
+	}
+	if len(subscription.event) != len(expected) {
+		t.Fatalf("Expected %d events but %d were sent", len(expected), len(subscription.event))
+	}
+	for _, data := range expected {
+		if sent := <-subscription.event; sent.data != data {
+			t.Fatalf("Expected event %q but received %q", data, sent.data)
+		}
+	}
+}
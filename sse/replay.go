@@ -0,0 +1,159 @@
+package sse
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Number of recent events kept for each subscribed resource, so that clients that
+// reconnect with a Last-Event-ID header can be sent the events they missed.
+const ReplayLimit = 256
+
+// How long a resource keeps its event log and its index of subscribers after its last
+// subscriber leaves, so that the client can still reconnect and catch up. Afterwards both
+// are dropped, and a client that reconnects is sent a reset event.
+const ReplayRetention = 5 * time.Minute
+
+// A sentEvent is an event as it was sent to the subscribers of a resource. Ids count
+// up from 1 for every resource. Path is the path the event is about, and key is the name
+// of the database, document, or collection directly inside the resource on that path, or
+// "" if the event is about the resource itself. Content and owner hold the contents and
+// the creator of the document the event is about, if any. Filtered subscriptions use them
+// to pick their events.
+type sentEvent struct {
+	id      uint64
+	event   EventType
+	data    string
+	path    string
+	key     string
+	content []byte
+	owner   string
+}
+
+// An eventLog is a ring buffer that holds the most recent events of a resource.
+type eventLog struct {
+	mu     sync.Mutex
+	events []sentEvent // ring buffer of at most ReplayLimit events
+	next   int         // position in events the next event is written to
+	lastID uint64      // id of the newest event, 0 if there was none yet
+}
+
+// newEventLog returns an empty event log.
+func newEventLog() *eventLog {
+	return &eventLog{events: make([]sentEvent, 0, ReplayLimit)}
+}
+
+// append gives the event the next id, adds it to the log, and returns it. Once the log
+// is full, the oldest event is dropped.
+func (log *eventLog) append(sent sentEvent) sentEvent {
+	return log.publish(sent, func(sentEvent) {})
+}
+
+// publish works like append, but also calls offer with the event before another event
+// can be added. Handing events to subscribers in offer keeps them in the order of their
+// ids, even when several writers publish to the resource at once. Offer must not block.
+func (log *eventLog) publish(sent sentEvent, offer func(sent sentEvent)) sentEvent {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.lastID++
+	sent.id = log.lastID
+	if len(log.events) < cap(log.events) {
+		log.events = append(log.events, sent)
+	} else {
+		log.events[log.next] = sent
+	}
+	log.next = (log.next + 1) % cap(log.events)
+	offer(sent)
+	return sent
+}
+
+// newest returns the id of the newest event in the log, or 0 if there was none yet.
+func (log *eventLog) newest() uint64 {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.lastID
+}
+
+// since returns every event after the one with the given id, oldest first. It returns
+// false if some of those events were already dropped from the log, or if the log never
+// held an event with that id, so the caller cannot know what it missed.
+func (log *eventLog) since(id uint64) ([]sentEvent, bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if id > log.lastID {
+		return nil, false
+	}
+	missed := int(log.lastID - id)
+	if missed > len(log.events) {
+		return nil, false
+	}
+	events := make([]sentEvent, 0, missed)
+	for i := len(log.events) - missed; i < len(log.events); i++ {
+		// The oldest event sits where the next one will be written once the log is full
+		events = append(events, log.events[(log.next+i)%len(log.events)])
+	}
+	return events, true
+}
+
+// eventLogFor returns the event log of the resource, creating it if needed.
+func (sh *SubscriberHandler) eventLogFor(resource string) *eventLog {
+	var log *eventLog
+	sh.eventLogs.Upsert(resource, func(key string, currValue *eventLog, exists bool) (*eventLog, error) {
+		if !exists {
+			currValue = newEventLog()
+		}
+		log = currValue
+		return currValue, nil
+	})
+	return log
+}
+
+// An idleResource is a resource without subscribers, which is evicted once its timer fires.
+type idleResource struct {
+	timer *time.Timer
+}
+
+// evictIfIdle starts the countdown to evicting the resource if none of its subscriptions
+// are left. The caller must hold sh.mu.
+func (sh *SubscriberHandler) evictIfIdle(resource string, subscriptions DBIndex[string, *Subscriber]) {
+	for range subscriptions.All(context.Background(), "", "") {
+		return
+	}
+	sh.keep(resource)
+	idle := &idleResource{}
+	idle.timer = time.AfterFunc(sh.retention, func() { sh.evict(resource, idle) })
+	sh.idle[resource] = idle
+}
+
+// keep stops the countdown to evicting the resource, if there is one. The caller must hold
+// sh.mu.
+func (sh *SubscriberHandler) keep(resource string) {
+	if idle, found := sh.idle[resource]; found {
+		idle.timer.Stop()
+		delete(sh.idle, resource)
+	}
+}
+
+// evict drops the event log and the subscriber index of the resource, unless it was
+// subscribed to again since the countdown started.
+func (sh *SubscriberHandler) evict(resource string, idle *idleResource) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.idle[resource] != idle {
+		return
+	}
+	delete(sh.idle, resource)
+	sh.resourceToken.Remove(resource)
+	sh.eventLogs.Remove(resource)
+}
+
+// parseEventID parses the value of a Last-Event-ID header. It returns false if the
+// value is not an id this package sent.
+func parseEventID(value string) (uint64, bool) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,269 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+func TestEventLog(t *testing.T) {
+	log := newEventLog()
+	if events, complete := log.since(0); !complete || len(events) != 0 {
+		t.Fatalf("Expected no events in an empty log but received %v", events)
+	}
+	for i := 1; i <= ReplayLimit+10; i++ {
+		if sent := log.append(sentEvent{event: "update", data: fmt.Sprint(i)}); sent.id != uint64(i) {
+			t.Fatalf("Expected id %d but received %d", i, sent.id)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		since    uint64
+		complete bool
+		first    uint64
+	}{
+		{"newest", ReplayLimit + 10, true, 0},
+		{"recent", ReplayLimit + 5, true, ReplayLimit + 6},
+		{"oldest kept", 10, true, 11},
+		{"dropped", 9, false, 0},
+		{"from the start", 0, false, 0},
+		{"never sent", ReplayLimit + 11, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, complete := log.since(tt.since)
+			if complete != tt.complete {
+				t.Fatalf("Expected complete to be %v", tt.complete)
+			}
+			if !complete {
+				return
+			}
+			if len(events) != int(log.newest()-tt.since) {
+				t.Fatalf("Expected %d events but received %d", log.newest()-tt.since, len(events))
+			}
+			for i, event := range events {
+				if event.id != tt.first+uint64(i) || event.data != fmt.Sprint(event.id) {
+					t.Fatalf("Unexpected event %v at position %d", event, i)
+				}
+			}
+		})
+	}
+}
+
+// streamRecorder is a ResponseWriter for SSE streams that can be read while the handler
+// writes to it. Holding mu blocks the handler's writes.
+type streamRecorder struct {
+	mu     sync.Mutex
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (s *streamRecorder) Header() http.Header { return s.header }
+
+func (s *streamRecorder) WriteHeader(int) {}
+
+func (s *streamRecorder) Flush() {}
+
+func (s *streamRecorder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.body.Write(p)
+}
+
+// events returns the ids and names of the events received so far, as "id event:data".
+func (s *streamRecorder) events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []string
+	for _, message := range strings.Split(s.body.String(), "\n\n") {
+		var event, id, data string
+		for _, line := range strings.Split(message, "\n") {
+			name, value, _ := strings.Cut(line, ": ")
+			switch name {
+			case "event":
+				event = value
+			case "id":
+				id = value
+			case "data":
+				data = value
+			}
+		}
+		if event != "" && data != `"Successfully connected!"` {
+			events = append(events, fmt.Sprintf("%s %s:%s", id, event, data))
+		}
+	}
+	return events
+}
+
+// connect runs the SSE handler for the resource until the returned function is called.
+func connect(t *testing.T, sh *SubscriberHandler, resource string, lastEventID string, backpressure Backpressure) (*streamRecorder, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/"+resource+"?backpressure="+string(backpressure), nil).WithContext(ctx)
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := &streamRecorder{header: http.Header{}}
+	done := make(chan struct{})
+	go func() {
+		sh.SSEHandler(w, r, resource, "token")
+		close(done)
+	}()
+
+	// Wait until the subscription is registered
+	waitFor(t, func() bool {
+		subscriptions, found := sh.resourceToken.Find(resource)
+		if !found {
+			return false
+		}
+		_, found = subscriptions.Find("token")
+		return found
+	})
+	return w, func() {
+		cancel()
+		<-done
+	}
+}
+
+// waitFor waits until condition holds, failing the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the SSE stream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expectEvents waits until the stream has received the expected events and checks them.
+func expectEvents(t *testing.T, w *streamRecorder, expected ...string) {
+	waitFor(t, func() bool { return len(w.events()) >= len(expected) })
+	received := w.events()
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected events %v but received %v", expected, received)
+	}
+}
+
+func TestSSEReplay(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+
+	w, disconnect := connect(t, sh, "db/doc", "", "")
+	sh.Notify("db/doc", "update", "1")
+	sh.Notify("db/doc", "delete", "2")
+	expectEvents(t, w, "1 update:1", "2 delete:2")
+	disconnect()
+
+	// Events sent while disconnected are replayed from the last one received
+	sh.Notify("db/doc", "update", "3")
+	sh.Notify("db/doc", "update", "4")
+	w, disconnect = connect(t, sh, "db/doc", "2", "")
+	sh.Notify("db/doc", "update", "5")
+	expectEvents(t, w, "3 update:3", "4 update:4", "5 update:5")
+	disconnect()
+
+	// Clients that fell behind the event log are told to reset
+	for i := 6; i < 6+ReplayLimit; i++ {
+		sh.Notify("db/doc", "update", fmt.Sprint(i))
+	}
+	w, disconnect = connect(t, sh, "db/doc", "4", "")
+	expectEvents(t, w, fmt.Sprintf(`%d reset:{"path":"db/doc"}`, 5+ReplayLimit))
+	disconnect()
+
+	// So are clients sending an id that was never sent
+	w, disconnect = connect(t, sh, "db/doc", "not an id", "")
+	sh.Notify("db/doc", "update", "last")
+	expectEvents(t, w, fmt.Sprintf(`%d reset:{"path":"db/doc"}`, 5+ReplayLimit), fmt.Sprintf("%d update:last", 6+ReplayLimit))
+	disconnect()
+}
+
+func TestSSEOverflow(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	w, disconnect := connect(t, sh, "db", "", "")
+	defer disconnect()
+
+	// Block the stream so the subscription's channel overflows
+	w.mu.Lock()
+	var expected []string
+	for i := 1; i <= 150; i++ {
+		sh.Notify("db/doc", "update", fmt.Sprint(i))
+		expected = append(expected, fmt.Sprintf("%d update:%d", i, i))
+	}
+	w.mu.Unlock()
+
+	// Every event still arrives exactly once and in order
+	expectEvents(t, w, expected...)
+}
+
+func TestSSEConcurrentWriters(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	w, disconnect := connect(t, sh, "db", "", "")
+	defer disconnect()
+
+	// Writers racing on the same resource must not reach the subscriber out of order
+	const writers, writes = 8, 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				sh.Notify("db/doc", "update", "x")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every event arrives exactly once, in the order of its id
+	var expected []string
+	for i := 1; i <= writers*writes; i++ {
+		expected = append(expected, fmt.Sprintf("%d update:x", i))
+	}
+	expectEvents(t, w, expected...)
+}
+
+func TestEvictIdleResources(t *testing.T) {
+	resourceToken := skiplist.NewSkipList[string, DBIndex[string, *Subscriber]]()
+	sh := NewSubscriberHandler(resourceToken, SubscriberFactoryforTest)
+	sh.retention = 50 * time.Millisecond
+	evicted := func() bool {
+		_, subscribed := resourceToken.Find("db/doc")
+		_, logged := sh.eventLogs.Find("db/doc")
+		return !subscribed && !logged
+	}
+
+	// A client that reconnects before the retention period ends can still catch up
+	w, disconnect := connect(t, sh, "db/doc", "", "")
+	sh.Notify("db/doc", "update", "1")
+	expectEvents(t, w, "1 update:1")
+	disconnect()
+	sh.Notify("db/doc", "update", "2")
+	w, disconnect = connect(t, sh, "db/doc", "1", "")
+	time.Sleep(2 * sh.retention)
+	if evicted() {
+		t.Fatalf("Expected a subscribed resource to be kept")
+	}
+	expectEvents(t, w, "2 update:2")
+	disconnect()
+
+	// Afterwards the resource is dropped, and events about it are no longer logged
+	waitFor(t, evicted)
+	sh.Notify("db/doc", "delete", "3")
+	if !evicted() {
+		t.Fatalf("Expected no event log for a resource without subscribers")
+	}
+	w, disconnect = connect(t, sh, "db/doc", "2", "")
+	defer disconnect()
+	expectEvents(t, w, `0 reset:{"path":"db/doc"}`)
+}
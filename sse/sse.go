@@ -1,8 +1,8 @@
 // Package sse implements the structs used to represent a subscription
 // manager and a subscriber handler which stores the subscription information
 // to be used in other files. It also implements the functions NewSubscriberHandler,
-// commentSender, updateEventSender, deleteEventSender, subscribePath,
-// Notify, addSubscription, deleteSusbcription, and the SSEHandler. The SSEHandler
+// commentSender, eventSender, subscribePath,
+// Publish, Notify, addSubscription, deleteSusbcription, and the SSEHandler. The SSEHandler
 // implementes the lowercased methods to aid in managing subscriptions for databases,
 // documents, and collections.
 
@@ -14,9 +14,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
+	"math"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
@@ -29,6 +33,10 @@ type DBIndex[K cmp.Ordered, V any] interface {
 	Upsert(key K, check skiplist.UpdateCheck[K, V]) (updated bool, err error)
 	Remove(key K) (removedValue V, removed bool)
 	Query(ctx context.Context, start K, end K) (results []V, err error)
+	QueryRange(ctx context.Context, keys skiplist.Range[K]) (results []V, err error)
+	All(ctx context.Context, start K, end K) iter.Seq2[K, V]
+	Backward(ctx context.Context, start K, end K) iter.Seq2[K, V]
+	Snapshot(ctx context.Context, start K, end K) iter.Seq2[K, V]
 }
 
 type writeFlusher interface {
@@ -38,11 +46,29 @@ type writeFlusher interface {
 
 // SubscriberManager struct manages subscriptions by storing the path to the db/doc/col,
 // the event as a channel, as well as the context to keep all of the information regarding
-// writers and readers accessible.
+// writers and readers accessible. The policy says what happens to events that do not fit
+// into the channel, and the counters track how many events reached the client.
 type Subscriber struct {
-	path  string
-	event chan string
-	ctx   context.Context
+	path   string
+	token  string // the subscription's key among the subscriptions to path
+	event  chan sentEvent
+	ctx    context.Context
+	policy Backpressure
+	filter Filter
+
+	id          uint64 // identifies the subscription in stats
+	connectedAt int64  // Unix milliseconds
+	delivered   atomic.Uint64
+	dropped     atomic.Uint64
+
+	behind    atomic.Bool   // set when a Replay subscriber has to catch up from the event log
+	mu        sync.Mutex    // guards gap
+	gap       gap           // events a DropNewest subscriber dropped and has not reported yet
+	closed    chan struct{} // closed when a Disconnect subscriber falls behind
+	closeOnce sync.Once
+
+	lastID uint64 // id of the last event the client received when it subscribed
+	known  bool   // false if the client gave a last event id this package did not send
 }
 
 // The SubscriberFactory creates a skiplist of DBIndex interface mapping the path to the
@@ -51,16 +77,30 @@ type SubscriberFactory func() DBIndex[string, *Subscriber]
 
 // The SubscriberHandler struct manages and facilitates subscriptions by mapping resource
 // tokens to collections of subscribers through a DBIndex, utilizing a SubscriberFactory to
-// generate new subscriptions as needed.
+// generate new subscriptions as needed. It also keeps a log of the recent events of every
+// subscribed resource. Resources that have had no subscribers for the retention period are
+// dropped from both, see ReplayRetention.
 type SubscriberHandler struct {
 	resourceToken       DBIndex[string, DBIndex[string, *Subscriber]]
 	subscriptionFactory SubscriberFactory
+	eventLogs           DBIndex[string, *eventLog]
+	subscriptions       atomic.Uint64 // number of subscriptions ever made, used for their ids
+
+	mu        sync.Mutex               // guards idle, and is held while subscribers are added or removed
+	idle      map[string]*idleResource // resources without subscribers, by path
+	retention time.Duration            // how long idle resources are kept
 }
 
 // NewSubscriberManager initializes the subscriber manager with a subscription handler
 // to be used where it needs to be outside of this package.
 func NewSubscriberHandler(resourceTotoken DBIndex[string, DBIndex[string, *Subscriber]], subscriptionFactory SubscriberFactory) *SubscriberHandler {
-	return &SubscriberHandler{resourceToken: resourceTotoken, subscriptionFactory: subscriptionFactory}
+	return &SubscriberHandler{
+		resourceToken:       resourceTotoken,
+		subscriptionFactory: subscriptionFactory,
+		eventLogs:           skiplist.NewSkipList[string, *eventLog](),
+		idle:                map[string]*idleResource{},
+		retention:           ReplayRetention,
+	}
 }
 
 func commentSender(wf writeFlusher) {
@@ -74,38 +114,19 @@ func commentSender(wf writeFlusher) {
 	wf.Flush()
 }
 
-// updateEventSender sends an "update" event message to the specified writeFlusher, typically used in an SSE
-// setup to notify subscribers of data updates. The function logs the event details, constructs the event with an "update"
-// label, assigns a unique ID based on the current time in milliseconds, and includes the provided data string. The event
-// is then written to the writeFlusher and flushed to ensure it is immediately transmitted to clients.
-func updateEventSender(wf writeFlusher, data string) {
-	var evt bytes.Buffer
-
-	slog.Info("Sending", "event", "update", "data", data)
-
-	// Writing subscription information
-	evt.WriteString(fmt.Sprintf("event: %s\n", "update"))
-	evt.WriteString(fmt.Sprintf("id: %d\n", time.Now().UnixMilli()))
-	evt.WriteString(fmt.Sprintf("data: %v\n\n", data))
-
-	// Send event
-	wf.Write(evt.Bytes())
-	wf.Flush()
-}
-
-// deleteEventSender sends a "delete" event message to the specified writeFlusher, typically for notifying subscribers
-// of a deletion in an SSE context. The function logs the event details, constructs the event with
-// a "delete" label, assigns a unique ID based on the current time in milliseconds, and includes the provided data string.
-// The event is then written to the writeFlusher and flushed to ensure immediate transmission to clients.
-func deleteEventSender(wf writeFlusher, data string) {
+// eventSender sends an event message to the specified writeFlusher, typically used in an SSE setup to
+// notify subscribers of data updates and deletions. The function logs the event details, constructs the
+// event with the given label and id, and includes the provided data string. The event is then written to
+// the writeFlusher and flushed to ensure it is immediately transmitted to clients. Clients send the id of
+// the last event they received back in the Last-Event-ID header when they reconnect.
+func eventSender(wf writeFlusher, event EventType, id uint64, data string) {
 	var evt bytes.Buffer
 
-	// Add quotations if the event is a delete event
-	slog.Info("Sending", "event", "delete", "data", data)
+	slog.Info("Sending", "event", event, "id", id, "data", data)
 
 	// Writing subscription information
-	evt.WriteString(fmt.Sprintf("event: %s\n", "delete"))
-	evt.WriteString(fmt.Sprintf("id: %d\n", time.Now().UnixMilli()))
+	evt.WriteString(fmt.Sprintf("event: %s\n", event))
+	evt.WriteString(fmt.Sprintf("id: %d\n", id))
 	evt.WriteString(fmt.Sprintf("data: %v\n\n", data))
 
 	// Send event
@@ -122,6 +143,15 @@ func deleteEventSender(wf writeFlusher, data string) {
 // the new subscriber. If there is an error during insertion or if the path is updated, the function
 // returns the error; otherwise, it completes successfully.
 func (sh *SubscriberHandler) SubscribePath(resource string) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.subscribePath(resource)
+}
+
+// subscribePath works like SubscribePath. The caller must hold sh.mu.
+func (sh *SubscriberHandler) subscribePath(resource string) error {
+	// The resource is about to get a subscriber, so it must not be evicted
+	sh.keep(resource)
 	newSubscriber := sh.subscriptionFactory() // Initialize new subscriber
 	// Insert the new resource path to skiplist if one is not found
 	updated, err := sh.resourceToken.Upsert(resource, func(key string, currValue DBIndex[string, *Subscriber], exists bool) (DBIndex[string, *Subscriber], error) {
@@ -132,6 +162,9 @@ func (sh *SubscriberHandler) SubscribePath(resource string) error {
 		return newSubscriber, nil
 	})
 
+	// Events are logged from now on, so clients can catch up after reconnecting
+	sh.eventLogFor(resource)
+
 	if err != nil || updated {
 		return err
 	}
@@ -141,50 +174,72 @@ func (sh *SubscriberHandler) SubscribePath(resource string) error {
 
 // Notify sends a specified event and data to all subscribers of a given resource path in the SubscriberHandler.
 // The function splits the resource path and constructs paths to notify incrementally. For each path segment,
-// it checks if there are subscribers by querying the resourceToken skiplist.
+// it checks if there are subscribers by looking them up in the resourceToken skiplist.
 //
 // If a subscription is found,
-// it retrieves all active subscriptions and sends the formatted event and data to each subscriber's event channel.
-// If a channel is full, it logs the path but continues processing other subscriptions. This allows hierarchical
-// notifications for resources, handling both document and collection-level subscriptions.
-func (sh *SubscriberHandler) Notify(resource string, event string, data string) {
+// it adds the event to the event log of the path, which gives it the next id, and then iterates over all active
+// subscriptions and sends the event to each subscriber's event channel before the next event of the path is
+// logged, so subscribers receive events in the order of their ids. If a channel is full, the subscriber's
+// backpressure policy decides what happens, and other subscriptions are processed as usual. This allows
+// hierarchical notifications for resources, handling both document and collection-level subscriptions.
+// Changes to resources are sent with Publish, which builds the data from the event.
+func (sh *SubscriberHandler) Notify(resource string, event EventType, data string) {
+	sh.notify(resource, event, data, nil, "")
+}
+
+// notify works like Notify for an event about the resource path. Content holds the contents
+// of the document the event is about, if any, and owner the user who created it.
+// Subscriptions with a content filter only receive the event if the contents match it, and
+// subscriptions that may not read every document only if they may read this one. Contents
+// are nil for events that are not about a document, which pass every content filter.
+func (sh *SubscriberHandler) notify(resource string, event EventType, data string, content []byte, owner string) {
+	// A missing handler has no subscribers to notify
+	if sh == nil {
+		return
+	}
 	slog.Info("starting notifying", "resource", resource)
 	rawparts := strings.Split(resource, "/")
 	pathToBuild := ""
 	for i, path := range rawparts {
 		pathToBuild = pathToBuild + "/" + path
 		pathToBuild = strings.TrimPrefix(pathToBuild, "/")
-		fmt.Println("index i : ", i, " pathTOBuild: ", pathToBuild)
-		if i%2 == 0 || i == (len(rawparts)-1) {
-			pathSubscription, found := sh.resourceToken.Find(pathToBuild)
-			fmt.Println("THERE IS SUBSCRIPTION ON THIS PATH")
-			fmt.Println("This is the skiplist of tokens associated with this path: ", pathSubscription)
-
-			if !found {
-				slog.Info(path)
-				slog.Info("there is no subscription on this path")
-				continue
-			}
+		// Databases, documents, and collections are all told about everything inside them
+		// The subscriptions are not printed, since other goroutines may be changing them
+		pathSubscription, found := sh.resourceToken.Find(pathToBuild)
+
+		if !found {
+			slog.Info(path)
+			slog.Info("there is no subscription on this path")
+			continue
+		}
 
-			fmt.Println("calling query for context.background")
-			subscriptons, err := pathSubscription.Query(context.Background(), "", "")
-			if err != nil {
-				slog.Info("fail to query path subscriptions", "path", path)
-				continue
-			}
-			fmt.Println("These are the subscriptions: ", subscriptons)
+		// Interval filters select by the name directly inside the subscribed path
+		key := ""
+		if i < len(rawparts)-1 {
+			key = rawparts[i+1]
+		}
 
-			for _, subscription := range subscriptons {
-				select {
-				case subscription.event <- fmt.Sprintf("%s;%s", event, data):
-					fmt.Println("Sent event: ", event, " and data: ", data)
+		// A path without a log was evicted or is not subscribed yet, so nobody is listening
+		log, found := sh.eventLogs.Find(pathToBuild)
+		if !found {
+			continue
+		}
 
-					slog.Info("successfully sent event and data")
-				default:
-					slog.Info("channel is full", "path", path)
+		// Every subscriber of the path sees the event under the same id, and no event of the
+		// path reaches the subscribers before the ones with lower ids
+		log.publish(sentEvent{event: event, data: data, path: resource, key: key, content: content, owner: owner}, func(sent sentEvent) {
+			// Stream the subscriptions instead of collecting them first
+			for _, subscription := range pathSubscription.All(context.Background(), "", "") {
+				if !subscription.filter.matches(sent) {
+					continue
+				}
+				if len(subscription.event) == cap(subscription.event) {
+					slog.Info("channel is full", "path", path, "backpressure", subscription.policy)
 				}
+				subscription.offer(sent)
+				slog.Info("Sent", "event", event, "path", pathToBuild)
 			}
-		}
+		})
 	}
 }
 
@@ -193,40 +248,71 @@ func (sh *SubscriberHandler) Notify(resource string, event string, data string)
 //
 // If not, it returns an error,
 // indicating that no prior subscriptions exist for the path. If the path is found, it creates a new Subscriber with
-// a buffered event channel and the HTTP request's context. The function then attempts to insert this new subscription
+// a buffered event channel, the HTTP request's context, and the backpressure policy given by the
+// request's backpressure query parameter. The function then attempts to insert this new subscription
 // into the skiplist using the token as the key. If a subscription with the same token already exists, it returns an
 // error; otherwise, it adds the subscription successfully.
 func (sh *SubscriberHandler) addSubscription(resource string, token string, r *http.Request) error {
+	return sh.addFilteredSubscription(resource, token, r, Filter{})
+}
+
+// addFilteredSubscription works like addSubscription, but the new subscriber only receives
+// the events the filter matches.
+func (sh *SubscriberHandler) addFilteredSubscription(resource string, token string, r *http.Request, filter Filter) error {
+	policy, err := ParseBackpressure(r.URL.Query().Get("backpressure"))
+	if err != nil {
+		return err
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	_, err = sh.register(r.Context(), resource, token, policy, filter)
+	return err
+}
+
+// register adds a new subscriber for the resource path under the token and returns it. The
+// subscription ends when ctx is done. It returns an error if the path is not subscribed or
+// the token already has a subscription to it. The caller must hold sh.mu.
+func (sh *SubscriberHandler) register(ctx context.Context, resource string, token string, policy Backpressure, filter Filter) (*Subscriber, error) {
 	pathSubscription, found := sh.resourceToken.Find(resource)
 
 	if !found {
 		slog.Info("the given resource path is not yet subscribed")
-		return errors.New("the given resource path is not yet subscribed")
+		return nil, errors.New("the given resource path is not yet subscribed")
 	}
 
-	subscription := &Subscriber{path: resource, event: make(chan string, 100), ctx: r.Context()}
+	subscription := &Subscriber{
+		path:        resource,
+		token:       token,
+		event:       make(chan sentEvent, eventBufferSize),
+		ctx:         ctx,
+		policy:      policy,
+		filter:      filter,
+		id:          sh.subscriptions.Add(1),
+		connectedAt: time.Now().UnixMilli(),
+		closed:      make(chan struct{}),
+	}
 	slog.Info("start adding new subscription")
-	updated, err := pathSubscription.Upsert(token, func(key string, currValue *Subscriber, exists bool) (*Subscriber, error) {
+	_, err := pathSubscription.Upsert(token, func(key string, currValue *Subscriber, exists bool) (*Subscriber, error) {
 		if exists {
 			return currValue, errors.New("the subscription already exists")
 		}
 		return subscription, nil
 	})
-
-	if err != nil || updated {
-		return err
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return subscription, nil
 }
 
 // deleteSubscription removes a subscriber for a specific resource path in the SubscriberHandler using the provided token.
 // The function first checks if the resource path exists in the resourceToken skiplist. If the path is not subscribed,
 // it returns an error indicating that no subscriptions are present for the path. If the path exists, it attempts
 // to remove the subscription associated with the given token. If removal is successful, the function completes without
-// error; if the subscription could not be removed, it returns an error.
-
+// error; if the subscription could not be removed, it returns an error. Once the last subscription is
+// removed, the resource is evicted after the retention period unless it is subscribed to again.
 func (sh *SubscriberHandler) deleteSubscription(resource string, token string) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 	pathSubscription, found := sh.resourceToken.Find(resource)
 	if !found {
 		slog.Info("the given resource path is not yet subscribed")
@@ -237,53 +323,214 @@ func (sh *SubscriberHandler) deleteSubscription(resource string, token string) e
 	if !removed {
 		return errors.New("fail to remove the subscription")
 	}
+	sh.evictIfIdle(resource, pathSubscription)
 
 	return nil
 }
 
-// SSEHandler manages an SSE connection for a client subscribing to a specific resource path in
-// the SubscriberHandler. It begins by looking at the resource path and if it is subscribed and adds a new subscription using the
-// given token. If successful, it sets up the HTTP headers for an SSE connection, confirming the client is
-// connected with an initial update event. A ticker is then initialized to send keep-alive comments every 15 seconds.
-// The function listens for various events: on "put"/"update" or "delete" events received via the subscription’s event channel,
-// it forwards these to the client using outlined event-sending functions. When the client's context signals a disconnection,
-// SSEHandler removes the subscription and stops, allowing for disconnection and resource cleanup.
-func (sh *SubscriberHandler) SSEHandler(w http.ResponseWriter, r *http.Request, resource string, token string) {
-	err := sh.SubscribePath(resource)
+// ErrDisconnected is returned by Stream when a subscription with the Disconnect policy fell
+// behind, so its client should subscribe again with the id of the last event it received.
+var ErrDisconnected = errors.New("subscription fell behind and was disconnected")
+
+// A Stream is the connection that the events of a subscription are sent over to its
+// client, such as an SSE response or a WebSocket.
+type Stream interface {
+	// Send sends an event with the given id. The data is JSON.
+	Send(event EventType, id uint64, data string) error
+	// KeepAlive tells the client that the connection is still open.
+	KeepAlive() error
+}
+
+// sseStream sends events as Server-Sent Events.
+type sseStream struct {
+	wf writeFlusher
+}
+
+func (stream sseStream) Send(event EventType, id uint64, data string) error {
+	eventSender(stream.wf, event, id, data)
+	return nil
+}
+
+func (stream sseStream) KeepAlive() error {
+	commentSender(stream.wf)
+	stream.wf.Flush()
+	return nil
+}
+
+// Subscribe subscribes the token to the resource until ctx is done. The client is only sent
+// the events the filter matches, and the policy picks what happens when it falls behind, see
+// Backpressure. A client that reconnects gives the id of the last event it received as
+// lastEventID, so it is sent every event it missed, see SSEHandler. Nothing is sent until
+// Stream is called with the returned subscription. An error is returned if the token is
+// already subscribed to the resource.
+func (sh *SubscriberHandler) Subscribe(ctx context.Context, resource string, token string, filter Filter, policy Backpressure, lastEventID string) (*Subscriber, error) {
+	// The resource cannot be evicted between subscribing to its path and registering
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	err := sh.subscribePath(resource)
 	if err != nil {
 		slog.Info(err.Error())
 	}
 
-	err = sh.addSubscription(resource, token, r)
+	// Find where the client left off before subscribing, so nothing sent in between is missed
+	log := sh.eventLogFor(resource)
+	lastID := log.newest()
+	known := true
+	if lastEventID != "" {
+		lastID, known = parseEventID(lastEventID)
+	}
+
+	// A token subscribes to a resource at most once, so no two streams share a subscription
+	subscription, err := sh.register(ctx, resource, token, policy, filter)
 	if err != nil {
 		slog.Info(err.Error())
+		return nil, err
 	}
-	slog.Info(resource)
+	subscription.lastID = lastID
+	subscription.known = known
+	return subscription, nil
+}
 
-	// Get the subscription
-	subPath, exists := sh.resourceToken.Find(resource)
+// Stream sends the events of the subscription to the stream until the subscription's
+// context is done, and then removes the subscription. It first sends an update event saying
+// the client is connected, then the events the client missed, and then every new event.
+// A keep-alive is sent every 15 seconds. Events are never sent twice or out of order.
+// Stream returns ErrDisconnected if the client fell behind and its policy is Disconnect,
+// and the error of the stream if sending failed.
+func (sh *SubscriberHandler) Stream(subscription *Subscriber, stream Stream) error {
+	defer sh.deleteSubscription(subscription.path, subscription.token)
+	resource := subscription.path
+	log := sh.eventLogFor(resource)
+	lastID, known := subscription.lastID, subscription.known
+
+	if err := stream.Send(Update, lastID, "\"Successfully connected!\""); err != nil {
+		return err
+	}
 
-	if !exists {
-		w.WriteHeader(http.StatusInternalServerError)
-		http.Error(w, "failed to get path subscriptions", http.StatusInternalServerError)
-		return
+	// deliver sends an event unless it was already sent from the log
+	deliver := func(sent sentEvent) error {
+		if sent.id <= lastID {
+			return nil
+		}
+		if err := stream.Send(sent.event, sent.id, sent.data); err != nil {
+			return err
+		}
+		subscription.delivered.Add(1)
+		lastID = sent.id
+		return nil
 	}
-	subscription, exists := subPath.Find(token)
 
-	if !exists {
-		w.WriteHeader(http.StatusInternalServerError)
-		http.Error(w, "fail to get the subscription based on the token", http.StatusInternalServerError)
-		return
+	// catchUp sends every logged event after lastID, or a reset event if they are gone
+	catchUp := func() error {
+		missed, complete := log.since(lastID)
+		if !complete || !known {
+			newest := log.newest()
+			if known && newest > lastID {
+				subscription.dropped.Add(newest - lastID)
+			}
+			known = true
+			lastID = newest
+			return stream.Send(Reset, lastID, Event{Path: resource}.data())
+		}
+		for _, sent := range missed {
+			if !subscription.filter.matches(sent) {
+				continue
+			}
+			if err := deliver(sent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// reportGap sends a gap event for the events a DropNewest subscriber dropped before the
+	// given id. It keeps the id of the last event sent, so a client that reconnects with it
+	// is sent the dropped events.
+	reportGap := func(before uint64) error {
+		if dropped, found := subscription.takeGap(before); found {
+			data := fmt.Sprintf("{\"path\":\"%s\",\"dropped\":%d,\"from\":%d,\"to\":%d}", resource, dropped.dropped, dropped.from, dropped.to)
+			return stream.Send(Gap, lastID, data)
+		}
+		return nil
+	}
+	// Events sent between reading the position and subscribing are only in the log
+	if err := catchUp(); err != nil {
+		return err
 	}
 
+	// Keep the connection alive and collect subscriptions until closed
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ticker.C:
+			err = stream.KeepAlive()
+		case sent := <-subscription.event:
+			slog.Info("eventData", "is", sent.data)
+			err = errors.Join(reportGap(sent.id), deliver(sent))
+			if err == nil && len(subscription.event) == 0 {
+				err = reportGap(math.MaxUint64)
+			}
+			// Events that did not fit into the channel are only in the log
+			if err == nil && subscription.behind.Swap(false) {
+				err = catchUp()
+			}
+		case <-subscription.closed:
+			// The client fell behind and its policy is to disconnect it
+			slog.Info("Disconnected slow client", "resource", resource, "dropped", subscription.dropped.Load())
+			return ErrDisconnected
+		case <-subscription.ctx.Done():
+			// Remove the subscription when the client disconnects
+			slog.Info("Client closed connection")
+			return nil
+		}
+		if err != nil {
+			slog.Info("Sending failed", "resource", resource, "error", err)
+			return err
+		}
+	}
+}
+
+// SSEHandler manages an SSE connection for a client subscribing to a specific resource path in
+// the SubscriberHandler. It begins by looking at the resource path and if it is subscribed and adds a new subscription using the
+// given token. If successful, it sets up the HTTP headers for an SSE connection, confirming the client is
+// connected with an initial update event. A ticker is then initialized to send keep-alive comments every 15 seconds.
+// The function listens for events received via the subscription’s event channel and forwards them to the client
+// with their ids. When the client's context signals a disconnection, SSEHandler removes the subscription and stops,
+// allowing for disconnection and resource cleanup.
+//
+// A client that reconnects with a Last-Event-ID header is first sent every event of the resource it missed. If
+// those events are no longer in the event log, it is sent a "reset" event instead, after which it should read the
+// resource again. Events are never sent twice or out of order. The backpressure query parameter picks what
+// happens when the client falls behind and the subscription's channel overflows, see Backpressure. A token
+// that is already subscribed to the resource is refused with 409 Conflict.
+func (sh *SubscriberHandler) SSEHandler(w http.ResponseWriter, r *http.Request, resource string, token string) {
+	sh.FilteredSSEHandler(w, r, resource, token, Filter{})
+}
+
+// FilteredSSEHandler works like SSEHandler, but the client is only sent the events the filter
+// matches, including when it catches up on missed events.
+func (sh *SubscriberHandler) FilteredSSEHandler(w http.ResponseWriter, r *http.Request, resource string, token string, filter Filter) {
+	policy, err := ParseBackpressure(r.URL.Query().Get("backpressure"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	wf, ok := w.(writeFlusher)
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
 		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
 		return
 	}
 	slog.Info("Converted to writeFlusher")
 
+	subscription, err := sh.Subscribe(r.Context(), resource, token, filter, policy, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, "already subscribed to "+resource, http.StatusConflict)
+		return
+	}
+	slog.Info(resource)
+
 	slog.Info("In header setup")
 
 	// Set up SSE headers
@@ -295,32 +542,5 @@ func (sh *SubscriberHandler) SSEHandler(w http.ResponseWriter, r *http.Request,
 	wf.WriteHeader(http.StatusOK)
 	wf.Flush()
 
-	updateEventSender(wf, "\"Successfully connected!\"")
-
-	// Keep the connection alive and collect subscriptions until closed
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			commentSender(wf)
-			wf.Flush()
-		case eventData := <-subscription.event:
-			slog.Info("eventData", "is", eventData)
-			parts := strings.SplitN(eventData, ";", 2)
-			event := parts[0]
-			data := parts[1]
-			if event == "update" {
-				updateEventSender(wf, data)
-			} else {
-				deleteEventSender(wf, data)
-			}
-		case <-subscription.ctx.Done():
-			// Remove the subscription when the client disconnects
-			sh.deleteSubscription(resource, token)
-			slog.Info("Client closed connection")
-
-		}
-	}
-	// Otherwise don't do anything with subscription
+	sh.Stream(subscription, sseStream{wf})
 }
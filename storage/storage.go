@@ -0,0 +1,73 @@
+// Package storage is the index factory that every database, document, and collection
+// list is created through. It decides which DBIndex implementation the whole tree is
+// built on, so the storage engine can be chosen once when the server starts.
+
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/hashindex"
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+)
+
+// An Engine names a DBIndex implementation.
+type Engine string
+
+const (
+	SkipList Engine = "skiplist" // the lock-based concurrent skiplist in the skiplist package
+	Hash     Engine = "hash"     // the lock-striped hash table in the hashindex package
+)
+
+// The engine that New creates indexes with.
+var current atomic.Pointer[Engine]
+
+func init() {
+	engine := SkipList
+	current.Store(&engine)
+}
+
+// Engines returns the name of every available engine.
+func Engines() []Engine {
+	return []Engine{SkipList, Hash}
+}
+
+// ParseEngine returns the engine with the given name, or an error if there is none.
+func ParseEngine(name string) (Engine, error) {
+	for _, engine := range Engines() {
+		if string(engine) == name {
+			return engine, nil
+		}
+	}
+	return "", fmt.Errorf("unknown storage engine %q, expected one of %v", name, Engines())
+}
+
+// SetEngine makes New create indexes with the given engine. Indexes that were already
+// created keep the engine they were created with, so it should be called before any
+// index is created.
+func SetEngine(engine Engine) {
+	current.Store(&engine)
+}
+
+// CurrentEngine returns the engine that New creates indexes with.
+func CurrentEngine() Engine {
+	return *current.Load()
+}
+
+// New returns a new empty index built on the current engine.
+func New[K cmp.Ordered, V any]() skiplist.DBIndex[K, V] {
+	return NewWithEngine[K, V](CurrentEngine())
+}
+
+// NewWithEngine returns a new empty index built on the given engine. Unknown engines
+// fall back to the skiplist.
+func NewWithEngine[K cmp.Ordered, V any](engine Engine) skiplist.DBIndex[K, V] {
+	switch engine {
+	case Hash:
+		return hashindex.New[K, V]()
+	default:
+		return skiplist.NewSkipList[K, V]()
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RICE-COMP318-FALL24/owldb-p1group32/skiplist"
+	"github.com/stretchr/testify/assert"
+)
+
+// updateCheck is the update check used by the scenarios in skiplist_test.go.
+func updateCheck(key string, currValue int, exists bool) (newValue int, err error) {
+	if exists {
+		return currValue + 1, nil
+	}
+	return 1, nil
+}
+
+func TestParseEngine(t *testing.T) {
+	for _, engine := range Engines() {
+		parsed, err := ParseEngine(string(engine))
+		assert.NoError(t, err)
+		assert.Equal(t, engine, parsed)
+	}
+	_, err := ParseEngine("btree")
+	assert.Error(t, err)
+}
+
+func TestSetEngine(t *testing.T) {
+	defer SetEngine(SkipList)
+	_, isSkipList := New[string, int]().(*skiplist.SkipList[string, int])
+	assert.True(t, isSkipList)
+
+	SetEngine(Hash)
+	assert.Equal(t, Hash, CurrentEngine())
+	_, isSkipList = New[string, int]().(*skiplist.SkipList[string, int])
+	assert.False(t, isSkipList)
+}
+
+// TestEngines runs the scenarios of skiplist_test.go against every engine.
+func TestEngines(t *testing.T) {
+	for _, engine := range Engines() {
+		t.Run(string(engine), func(t *testing.T) {
+			index := NewWithEngine[string, int](engine)
+			index.Upsert("key1", updateCheck)
+			index.Upsert("key1", updateCheck)
+			index.Upsert("key2", updateCheck)
+			index.Upsert("key3", updateCheck)
+
+			val, found := index.Find("key1")
+			assert.True(t, found)
+			assert.Equal(t, 2, val)
+
+			results, err := index.Query(context.TODO(), "key1", "key2")
+			assert.NoError(t, err)
+			assert.Equal(t, []int{2, 1}, results)
+
+			removedValue, removed := index.Remove("key1")
+			assert.True(t, removed)
+			assert.Equal(t, 2, removedValue)
+			_, found = index.Find("key1")
+			assert.False(t, found)
+
+			results, err = index.Query(context.TODO(), "", "")
+			assert.NoError(t, err)
+			assert.Equal(t, []int{1, 1}, results)
+		})
+	}
+}
+
+// The benchmarks below run the scenarios of skiplist_test.go against every engine, so
+// the engines can be compared with go test -bench . ./storage
+
+func BenchmarkInsert(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				index := NewWithEngine[string, int](engine)
+				for i := 0; i < 10; i++ {
+					index.Upsert(strconv.Itoa(i), updateCheck)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpsertAndFind(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			index := NewWithEngine[string, int](engine)
+			for n := 0; n < b.N; n++ {
+				index.Upsert("key1", updateCheck)
+				index.Find("key1")
+			}
+		})
+	}
+}
+
+func BenchmarkRemove(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			index := NewWithEngine[string, int](engine)
+			for n := 0; n < b.N; n++ {
+				index.Upsert("key1", updateCheck)
+				index.Upsert("key2", updateCheck)
+				index.Remove("key1")
+				index.Remove("key2")
+			}
+		})
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			index := NewWithEngine[string, int](engine)
+			for i := 0; i < 1000; i++ {
+				index.Upsert("key"+strconv.Itoa(i), updateCheck)
+			}
+			ctx := context.TODO()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				index.Query(ctx, "key1", "key3")
+			}
+		})
+	}
+}
+
+func BenchmarkConcurrency(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			ctx := context.TODO()
+			for n := 0; n < b.N; n++ {
+				index := NewWithEngine[string, int](engine)
+				var wg sync.WaitGroup
+				for i := 0; i < 100; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						index.Upsert("key"+strconv.Itoa(i), updateCheck)
+					}(i)
+				}
+				wg.Wait()
+				for i := 0; i < 100; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						index.Query(ctx, "key0", "key"+strconv.Itoa(i))
+					}(i)
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+func BenchmarkConcurrentInsert(b *testing.B) {
+	for _, engine := range Engines() {
+		b.Run(string(engine), func(b *testing.B) {
+			index := NewWithEngine[string, int](engine)
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					index.Upsert("key"+strconv.FormatInt(next.Add(1), 10), updateCheck)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,393 @@
+// Package websocket implements the WebSocket protocol (RFC 6455). Upgrade turns an HTTP
+// request into a server connection, and Dial opens a client connection. A Conn sends and
+// receives whole messages, answers pings, and closes the connection when the other side
+// does. Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types, which are the opcodes of the frames they are sent in.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes sent in close frames.
+const (
+	CloseNormal        = 1000
+	CloseProtocolError = 1002
+	CloseInvalidData   = 1007
+	CloseTooBig        = 1009
+)
+
+// Largest message a Conn receives. Larger messages close the connection.
+const MaxMessageSize = 1 << 20
+
+// How long a frame may take to write. A peer that stops reading makes writes fail once it
+// passes, instead of blocking the writers forever.
+const writeTimeout = 10 * time.Second
+
+// How long closing a connection waits for its close frame to be written.
+const closeTimeout = time.Second
+
+// The GUID that the accept key of a handshake is derived with, see acceptKey.
+const handshakeGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned when reading from or writing to a connection that was closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// A Conn is a WebSocket connection. Messages may be written from several goroutines at
+// once, but only one goroutine may read them.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client bool // clients mask the frames they send, servers do not
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// Upgrade completes the WebSocket handshake of the request and returns the connection.
+// If the request is not a valid handshake, it responds with 400, or with 426 if it asks
+// for a version of the protocol other than 13, and returns an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "WebSocket handshakes must use GET", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("handshake method %s is not GET", r.Method)
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, fmt.Errorf("request is not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported WebSocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid Sec-WebSocket-Key %q", key)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("response writer cannot be hijacked")
+	}
+
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to complete handshake: %w", err)
+	}
+	return &Conn{conn: netConn, reader: rw.Reader}, nil
+}
+
+// Dial opens a WebSocket connection to the ws:// or http:// URL, sending the given headers
+// with the handshake. If the server does not accept the handshake, its response is
+// returned along with the error.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch target.Scheme {
+	case "ws":
+		target.Scheme = "http"
+	case "http":
+	default:
+		return nil, nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", target.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err := request.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(netConn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		netConn.Close()
+		return nil, response, fmt.Errorf("handshake failed with status %s", response.Status)
+	}
+	return &Conn{conn: netConn, reader: reader, client: true}, response, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value that answers the given key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma separated header holds the token, ignoring case.
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, joining fragmented messages. Pings
+// are answered while waiting. When the other side closes the connection, the close is
+// answered and ErrClosed returned. Frames that break the protocol close the connection
+// with the matching close code.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame(MaxMessageSize - len(message))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.writeFrame(true, PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			// Echo the close code, as the protocol asks
+			code := payload
+			if len(code) > 2 {
+				code = code[:2]
+			}
+			c.writeFrame(true, CloseMessage, code)
+			c.conn.Close()
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "message started inside another message")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame outside a message")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		message = append(message, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(CloseInvalidData, "text message is not UTF-8")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads one frame whose payload may be at most limit bytes long, and unmasks it.
+func (c *Conn) readFrame(limit int) (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits are set")
+	}
+	// Clients must mask their frames and servers must not
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, "frame masking is wrong")
+	}
+	if opcode >= CloseMessage && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "control frames must be short and unfragmented")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > uint64(limit) {
+		return false, 0, nil, c.fail(CloseTooBig, "message is too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends the data as one text or binary message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	return c.writeFrame(true, messageType, data)
+}
+
+// Ping sends a ping, which the other side answers with a pong.
+func (c *Conn) Ping() error {
+	return c.writeFrame(true, PingMessage, nil)
+}
+
+// writeFrame sends one frame. Frames of clients are masked with a random key.
+func (c *Conn) writeFrame(fin bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.write(encodeFrame(fin, opcode, payload, c.client), writeTimeout)
+}
+
+// write sends the encoded frame, giving up after the timeout. The caller must hold
+// writeMu. A frame that could not be written may have been sent in part, so the
+// connection is closed.
+func (c *Conn) write(frame []byte, timeout time.Duration) error {
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		c.conn.Close()
+		return ErrClosed
+	}
+	return nil
+}
+
+// encodeFrame returns the frame that carries the payload, masked if it is sent by a client.
+func encodeFrame(fin bool, opcode int, payload []byte, client bool) []byte {
+	var frame bytes.Buffer
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame.WriteByte(first)
+
+	maskBit := byte(0)
+	if client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame.WriteByte(maskBit | byte(length))
+	case length <= 0xffff:
+		frame.WriteByte(maskBit | 126)
+		binary.Write(&frame, binary.BigEndian, uint16(length))
+	default:
+		frame.WriteByte(maskBit | 127)
+		binary.Write(&frame, binary.BigEndian, uint64(length))
+	}
+
+	if client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame.Write(mask[:])
+		for i, b := range payload {
+			frame.WriteByte(b ^ mask[i%4])
+		}
+	} else {
+		frame.Write(payload)
+	}
+	return frame.Bytes()
+}
+
+// fail closes the connection with the given close code and returns the reason as an error.
+func (c *Conn) fail(code uint16, reason string) error {
+	c.closeWith(code, reason)
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// readError turns an error reading from the network into ErrClosed.
+func (c *Conn) readError(err error) error {
+	c.conn.Close()
+	return fmt.Errorf("%w: %v", ErrClosed, err)
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.closeWith(CloseNormal, "")
+	return nil
+}
+
+// closeWith sends a close frame with the code and reason, and closes the connection. Only
+// the first call has an effect. It never waits for another write: if one is in progress,
+// the connection is closed without a close frame, which makes that write fail.
+func (c *Conn) closeWith(code uint16, reason string) {
+	c.closeOnce.Do(func() {
+		if c.writeMu.TryLock() {
+			payload := binary.BigEndian.AppendUint16(nil, code)
+			c.write(encodeFrame(true, CloseMessage, append(payload, reason...), c.client), closeTimeout)
+			c.writeMu.Unlock()
+		}
+		c.conn.Close()
+	})
+}
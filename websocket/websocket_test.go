@@ -0,0 +1,199 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer starts a server that sends every message it receives back.
+func echoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server) *Conn {
+	conn, _, err := Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example handshake of RFC 6455
+	if accept := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected accept key %s", accept)
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		expected int
+	}{
+		{"not a handshake", http.MethodGet, map[string]string{}, http.StatusBadRequest},
+		{"wrong method", http.MethodPost, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, http.StatusMethodNotAllowed},
+		{"wrong version", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="}, http.StatusUpgradeRequired},
+		{"invalid key", http.MethodGet, map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/ws", nil)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			if _, err := Upgrade(w, r); err == nil {
+				t.Fatalf("Expected the handshake to fail")
+			}
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d but received %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestEcho(t *testing.T) {
+	conn := dial(t, echoServer(t))
+
+	tests := []struct {
+		name        string
+		messageType int
+		data        []byte
+	}{
+		{"empty", TextMessage, []byte{}},
+		{"short text", TextMessage, []byte(`{"type":"subscribe"}`)},
+		{"16 bit length", BinaryMessage, bytes.Repeat([]byte{7}, 300)},
+		{"64 bit length", TextMessage, bytes.Repeat([]byte("a"), 70000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteMessage(tt.messageType, tt.data); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if messageType != tt.messageType || !bytes.Equal(data, tt.data) {
+				t.Fatalf("Expected %d message of %d bytes but received %d message of %d bytes", tt.messageType, len(tt.data), messageType, len(data))
+			}
+		})
+	}
+}
+
+func TestFragmentsAndPings(t *testing.T) {
+	conn := dial(t, echoServer(t))
+
+	// A ping between the fragments of a message is answered without breaking the message
+	conn.writeFrame(false, TextMessage, []byte("hello, "))
+	conn.writeFrame(true, PingMessage, []byte("ping"))
+	conn.writeFrame(true, continuationFrame, []byte("world"))
+	fin, opcode, payload, err := conn.readFrame(MaxMessageSize)
+	if err != nil || !fin || opcode != PongMessage || string(payload) != "ping" {
+		t.Fatalf("Expected pong but received opcode %d %q: %v", opcode, payload, err)
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != TextMessage || string(data) != "hello, world" {
+		t.Fatalf("Unexpected message %q: %v", data, err)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(conn *Conn)
+		code  uint16
+	}{
+		{"continuation outside message", func(conn *Conn) { conn.writeFrame(true, continuationFrame, []byte("x")) }, CloseProtocolError},
+		{"unknown opcode", func(conn *Conn) { conn.writeFrame(true, 3, nil) }, CloseProtocolError},
+		{"fragmented control frame", func(conn *Conn) { conn.writeFrame(false, PingMessage, nil) }, CloseProtocolError},
+		{"invalid text", func(conn *Conn) { conn.WriteMessage(TextMessage, []byte{0xff, 0xfe}) }, CloseInvalidData},
+		{"too big", func(conn *Conn) { conn.WriteMessage(BinaryMessage, make([]byte, MaxMessageSize+1)) }, CloseTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, echoServer(t))
+			tt.write(conn)
+			_, opcode, payload, err := conn.readFrame(MaxMessageSize)
+			if err != nil || opcode != CloseMessage || len(payload) < 2 {
+				t.Fatalf("Expected a close frame but received opcode %d: %v", opcode, err)
+			}
+			if code := uint16(payload[0])<<8 | uint16(payload[1]); code != tt.code {
+				t.Fatalf("Expected close code %d but received %d", tt.code, code)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	conn := dial(t, echoServer(t))
+	conn.Close()
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed but received %v", err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed but received %v", err)
+	}
+}
+
+func TestCloseWhileWriteBlocks(t *testing.T) {
+	closed := make(chan time.Duration, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		// The client never reads, so these writes soon block
+		written := make(chan error)
+		go func() {
+			for {
+				if err := conn.WriteMessage(BinaryMessage, make([]byte, 1<<20)); err != nil {
+					written <- err
+					return
+				}
+			}
+		}()
+		time.Sleep(500 * time.Millisecond)
+		start := time.Now()
+		conn.Close()
+		closed <- time.Since(start)
+		if err := <-written; !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed but received %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	dial(t, server)
+
+	select {
+	case elapsed := <-closed:
+		if elapsed > closeTimeout {
+			t.Fatalf("Close waited %v for the blocked write", elapsed)
+		}
+	case <-time.After(writeTimeout + 5*time.Second):
+		t.Fatalf("Close did not return")
+	}
+}